@@ -28,13 +28,13 @@ func runApp(m App) error {
 	app := &cli.App{
 		Name:  "telemetry",
 		Usage: "get data from telemetry models driven",
-		Flags: append([]cli.Flag{
+		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "config",
 				Aliases: []string{"c"},
 				Usage:   "path of config `file`",
 			},
-		}),
+		},
 		Action: action,
 		Commands: []*cli.Command{
 			{
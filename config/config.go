@@ -1,22 +1,34 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"strings"
-	"time"
 
 	"github.com/BurntSushi/toml"
 
 	"telemetry/models"
 	"telemetry/plugin/input/cisco_telemetry_mdt"
 	"telemetry/plugin/input/cpu"
+	"telemetry/plugin/input/gnmi"
+	"telemetry/plugin/input/huawei_telemetry"
+	"telemetry/plugin/input/jti_native"
+	"telemetry/plugin/input/kafka_consumer"
+	"telemetry/plugin/output/elasticsearch"
 	"telemetry/plugin/output/file"
+	"telemetry/plugin/output/http"
+	"telemetry/plugin/output/influxdb_v2"
 	"telemetry/plugin/output/kafka"
+	"telemetry/plugin/output/mqtt"
+	"telemetry/plugin/output/opentelemetry"
+	"telemetry/plugin/output/prometheus_client"
+	"telemetry/plugin/output/socket_writer"
+	"telemetry/plugin/output/sql"
+	"telemetry/plugin/parsers"
 	"telemetry/plugin/serializers"
-	"telemetry/plugin/serializers/json"
 )
 
 type Config struct {
@@ -148,6 +160,66 @@ func (c *Config) addInput(name string, cfgs any) error {
 			}
 			c.RunningInputs = append(c.RunningInputs, &runInput)
 		}
+	case "gnmi":
+		for _, cfg := range configs {
+			runInput := models.RunningInput{
+				Input: gnmi.NewGNMI(),
+				Name:  name,
+			}
+			// init config
+			err := runInput.Input.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+			c.RunningInputs = append(c.RunningInputs, &runInput)
+		}
+	case "huawei_telemetry":
+		for _, cfg := range configs {
+			runInput := models.RunningInput{
+				Input: huawei_telemetry.NewHuaweiTelemetry(),
+				Name:  name,
+			}
+			// init config
+			err := runInput.Input.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+			c.RunningInputs = append(c.RunningInputs, &runInput)
+		}
+	case "jti_native":
+		for _, cfg := range configs {
+			runInput := models.RunningInput{
+				Input: jti_native.NewJTINative(),
+				Name:  name,
+			}
+			// init config
+			err := runInput.Input.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+			c.RunningInputs = append(c.RunningInputs, &runInput)
+		}
+	case "kafka_consumer":
+		for _, cfg := range configs {
+			runInput := models.RunningInput{
+				Input: kafka_consumer.NewKafkaConsumer(),
+				Name:  name,
+			}
+			// init config
+			err := runInput.Input.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+
+			if ri, ok := runInput.Input.(parsers.ParserInput); ok {
+				parser, err := buildParser(name, cfg)
+				if err != nil {
+					return err
+				}
+				ri.SetParser(parser)
+			}
+			c.RunningInputs = append(c.RunningInputs, &runInput)
+		}
 	}
 
 	return nil
@@ -158,7 +230,6 @@ func (c *Config) addOutput(name string, cfgs any) error {
 		return fmt.Errorf("outputs.%s config error", name)
 	}
 	configs := cfgs.([]map[string]any)
-	serializer, _ := json.NewSerializer(1*time.Millisecond, "2006-01-02 15:04:05.000", "")
 
 	switch name {
 	case "file":
@@ -172,6 +243,10 @@ func (c *Config) addOutput(name string, cfgs any) error {
 			}
 
 			if ro, ok := runOuput.Output.(serializers.SerializerOutput); ok {
+				serializer, err := buildSerializer(name, cfg)
+				if err != nil {
+					return err
+				}
 				ro.SetSerializer(serializer)
 			}
 			c.RunningOutputs = append(c.RunningOutputs, runOuput)
@@ -187,15 +262,157 @@ func (c *Config) addOutput(name string, cfgs any) error {
 			}
 
 			if ro, ok := runOuput.Output.(serializers.SerializerOutput); ok {
+				serializer, err := buildSerializer(name, cfg)
+				if err != nil {
+					return err
+				}
+				ro.SetSerializer(serializer)
+			}
+			c.RunningOutputs = append(c.RunningOutputs, runOuput)
+		}
+	case "http":
+		for _, cfg := range configs {
+			h := http.NewHTTP()
+			runOuput := models.NewRunningOutput(h, name, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+			// init config
+			err := runOuput.Output.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+
+			if ro, ok := runOuput.Output.(serializers.SerializerOutput); ok {
+				serializer, err := buildSerializer(name, cfg)
+				if err != nil {
+					return err
+				}
+				ro.SetSerializer(serializer)
+			}
+			c.RunningOutputs = append(c.RunningOutputs, runOuput)
+		}
+	case "mqtt":
+		for _, cfg := range configs {
+			m := mqtt.NewMQTT()
+			runOuput := models.NewRunningOutput(m, name, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+			// init config
+			err := runOuput.Output.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+
+			if ro, ok := runOuput.Output.(serializers.SerializerOutput); ok {
+				serializer, err := buildSerializer(name, cfg)
+				if err != nil {
+					return err
+				}
 				ro.SetSerializer(serializer)
 			}
 			c.RunningOutputs = append(c.RunningOutputs, runOuput)
 		}
+	case "elasticsearch":
+		for _, cfg := range configs {
+			e := elasticsearch.NewElasticsearch()
+			runOuput := models.NewRunningOutput(e, name, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+			// init config
+			err := runOuput.Output.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+			c.RunningOutputs = append(c.RunningOutputs, runOuput)
+		}
+	case "influxdb_v2":
+		for _, cfg := range configs {
+			i := influxdb_v2.NewInfluxDBV2()
+			runOuput := models.NewRunningOutput(i, name, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+			// init config
+			err := runOuput.Output.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+			c.RunningOutputs = append(c.RunningOutputs, runOuput)
+		}
+	case "opentelemetry":
+		for _, cfg := range configs {
+			o := opentelemetry.NewOpenTelemetry()
+			runOuput := models.NewRunningOutput(o, name, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+			// init config
+			err := runOuput.Output.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+			c.RunningOutputs = append(c.RunningOutputs, runOuput)
+		}
+	case "prometheus_client":
+		for _, cfg := range configs {
+			p := prometheus_client.NewPrometheusClient()
+			runOuput := models.NewRunningOutput(p, name, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+			// init config
+			err := runOuput.Output.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+			c.RunningOutputs = append(c.RunningOutputs, runOuput)
+		}
+	case "socket_writer":
+		for _, cfg := range configs {
+			sw := socket_writer.NewSocketWriter()
+			runOuput := models.NewRunningOutput(sw, name, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+			// init config
+			err := runOuput.Output.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+
+			if ro, ok := runOuput.Output.(serializers.SerializerOutput); ok {
+				serializer, err := buildSerializer(name, cfg)
+				if err != nil {
+					return err
+				}
+				ro.SetSerializer(serializer)
+			}
+			c.RunningOutputs = append(c.RunningOutputs, runOuput)
+		}
+	case "sql":
+		for _, cfg := range configs {
+			s := sql.NewSQL()
+			runOuput := models.NewRunningOutput(s, name, c.Agent.MetricBatchSize, c.Agent.MetricBufferLimit)
+			// init config
+			err := runOuput.Output.ParseConfig(cfg)
+			if err != nil {
+				return err
+			}
+			c.RunningOutputs = append(c.RunningOutputs, runOuput)
+		}
 	}
 
 	return nil
 }
 
+func buildSerializer(name string, cfg map[string]any) (serializers.Serializer, error) {
+	var sc serializers.Config
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(tmp, &sc)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] serializer config error: %v", name, err)
+	}
+	return serializers.NewSerializer(&sc)
+}
+
+func buildParser(name string, cfg map[string]any) (parsers.Parser, error) {
+	var pc parsers.Config
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(tmp, &pc)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] parser config error: %v", name, err)
+	}
+	return parsers.NewParser(&pc)
+}
+
 func (c *Config) LoadAll() error {
 	for input, inputCfg := range c.Inputs {
 		err := c.addInput(input, inputCfg)
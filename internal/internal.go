@@ -3,6 +3,9 @@ package internal
 import (
 	"context"
 	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -69,3 +72,38 @@ func DeepCopy(value any) any {
 
 	return value
 }
+
+// Flatten walks value, which may be nested map[string]any and []any, and calls
+// fn for every leaf with its path joined by sep. Slice elements use their
+// index as path element.
+func Flatten(prefix string, value any, sep string, fn func(key string, value any)) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + sep + key
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for k, item := range v {
+			Flatten(join(k), item, sep, fn)
+		}
+	case []any:
+		for i, item := range v {
+			Flatten(join(strconv.Itoa(i)), item, sep, fn)
+		}
+	case nil:
+	default:
+		fn(prefix, v)
+	}
+}
+
+// CompileGlob compiles a glob, where "*" matches any sequence of characters
+// and "?" a single one, into an anchored regular expression.
+func CompileGlob(glob string) (*regexp.Regexp, error) {
+	pattern := regexp.QuoteMeta(glob)
+	pattern = strings.ReplaceAll(pattern, `\*`, ".*")
+	pattern = strings.ReplaceAll(pattern, `\?`, ".")
+	return regexp.Compile("^" + pattern + "$")
+}
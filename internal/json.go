@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ConvertJSONNumbers replaces the json.Number values of a value decoded
+// with UseNumber, nested in maps and slices, by int64 values, or uint64
+// values when too large, and float64 values for the other numbers. Numbers
+// out of the float64 range are kept as strings.
+func ConvertJSONNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		return JSONNumber(v)
+	case map[string]any:
+		for k, item := range v {
+			v[k] = ConvertJSONNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = ConvertJSONNumbers(item)
+		}
+	}
+	return value
+}
+
+// JSONNumber returns a number as int64, uint64 or float64, see
+// ConvertJSONNumbers.
+func JSONNumber(n json.Number) any {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return u
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return string(n)
+}
+
+// JSONUint64 is a 64-bit counter, encoded either as a number or as a string
+// like in the proto3 JSON mapping.
+type JSONUint64 uint64
+
+func (u *JSONUint64) UnmarshalJSON(data []byte) error {
+	s := string(bytes.Trim(data, `"`))
+	if s == "" || s == "null" {
+		return nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid counter %s: %v", data, err)
+	}
+	*u = JSONUint64(v)
+	return nil
+}
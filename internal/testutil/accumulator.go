@@ -0,0 +1,56 @@
+// Package testutil holds helpers shared by the plugin tests.
+package testutil
+
+import (
+	"sync"
+
+	"telemetry/models"
+)
+
+// Accumulator records the metrics and errors added by a plugin, it is safe
+// for concurrent use.
+type Accumulator struct {
+	mutex   sync.Mutex
+	metrics []models.Metric
+	errs    []error
+}
+
+func (a *Accumulator) AddMetric(m models.Metric) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.metrics = append(a.metrics, m)
+}
+
+func (a *Accumulator) AddError(err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.errs = append(a.errs, err)
+}
+
+// Count returns the number of metrics added.
+func (a *Accumulator) Count() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return len(a.metrics)
+}
+
+// Metric returns the i-th metric added.
+func (a *Accumulator) Metric(i int) models.Metric {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.metrics[i]
+}
+
+// Metrics returns a copy of the metrics added.
+func (a *Accumulator) Metrics() []models.Metric {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]models.Metric(nil), a.metrics...)
+}
+
+// Errors returns a copy of the errors added.
+func (a *Accumulator) Errors() []error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]error(nil), a.errs...)
+}
@@ -53,6 +53,9 @@ func (b *Buffer) addMetric(m Metric) int {
 		}
 	}
 
+	if old := b.buf[b.last]; old != nil {
+		dropMetrics([]Metric{old})
+	}
 	b.buf[b.last] = m
 	b.last = b.next(b.last)
 
@@ -122,6 +125,7 @@ func (b *Buffer) Reject(batch []Metric) {
 	defer b.Unlock()
 
 	if len(batch) == 0 {
+		b.resetBatch()
 		return
 	}
 
@@ -137,6 +141,7 @@ func (b *Buffer) Reject(batch []Metric) {
 	// Copy metrics from the batch back into the buffer
 	for i := range batch {
 		if i < skip {
+			dropMetrics(batch[i : i+1])
 			continue
 		} else {
 			b.buf[re] = batch[i]
@@ -1,8 +1,52 @@
 package models
 
+import "time"
+
 type Metric interface {
 	IsMetric()
 
 	// Copy returns a deep copy of the Metric.
 	Copy() Metric
 }
+
+// ValueType is the kind of values a series holds.
+type ValueType int
+
+const (
+	Untyped ValueType = iota
+	Counter
+	Gauge
+	Histogram
+	Summary
+)
+
+// Series is a named measurement made of tags and fields sharing a timestamp.
+// Field values are scalars or nested map[string]any and []any values, flat
+// formats expand them with internal.Flatten.
+type Series struct {
+	Name   string
+	Tags   map[string]string
+	Fields map[string]any
+	Time   time.Time
+	Type   ValueType
+
+	// Header holds values describing the collection the series comes from,
+	// such as collection timestamps, they are not part of the series data.
+	Header map[string]any
+}
+
+// SeriesMetric is implemented by metrics which can be broken down into
+// Series, serializers of flat formats such as graphite rely on it.
+type SeriesMetric interface {
+	Metric
+
+	Series() []Series
+}
+
+// TaggedMetric is implemented by metrics which can add a tag to all their
+// series while keeping their own encoding.
+type TaggedMetric interface {
+	SeriesMetric
+
+	AddTag(key, value string)
+}
@@ -9,3 +9,36 @@ type Output interface {
 
 	ParseConfig(map[string]any) error
 }
+
+// PermanentError is returned by outputs for batches that can never be
+// written, such as batches rejected by the server as malformed.
+// RunningOutput drops these batches instead of returning them to the buffer.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// PartialWriteError is returned by outputs which wrote only part of a batch.
+// RunningOutput accepts the written metrics, returns the failed ones to the
+// buffer and drops the ones that can never be written, both given by their
+// index in the batch.
+type PartialWriteError struct {
+	Err     error
+	Failed  []int
+	Dropped []int
+}
+
+func (e *PartialWriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -109,12 +110,9 @@ func (r *RunningOutput) Write() error {
 			break
 		}
 
-		err := r.writeMetrics(batch)
-		if err != nil {
-			r.buffer.Reject(batch)
+		if err := r.complete(batch, r.writeMetrics(batch)); err != nil {
 			return err
 		}
-		r.buffer.Accept(batch)
 	}
 	return nil
 }
@@ -126,14 +124,66 @@ func (r *RunningOutput) WriteBatch() error {
 		return nil
 	}
 
-	err := r.writeMetrics(batch)
-	if err != nil {
+	return r.complete(batch, r.writeMetrics(batch))
+}
+
+// complete accepts, drops or returns to the buffer the metrics of a written
+// batch depending on the write error.
+func (r *RunningOutput) complete(batch []Metric, err error) error {
+	if err == nil {
+		r.buffer.Accept(batch)
+		acceptMetrics(batch)
+		return nil
+	}
+	if r.dropPermanent(err, batch) {
+		r.buffer.Accept(batch)
+		dropMetrics(batch)
+		return nil
+	}
+
+	var perr *PartialWriteError
+	if !errors.As(err, &perr) {
 		r.buffer.Reject(batch)
 		return err
 	}
-	r.buffer.Accept(batch)
+	isDone := make(map[int]bool, len(perr.Failed)+len(perr.Dropped))
+	pick := func(indices []int) []Metric {
+		metrics := make([]Metric, 0, len(indices))
+		for _, i := range indices {
+			if i >= 0 && i < len(batch) && !isDone[i] {
+				isDone[i] = true
+				metrics = append(metrics, batch[i])
+			}
+		}
+		return metrics
+	}
+	failed := pick(perr.Failed)
+	dropped := pick(perr.Dropped)
+	written := make([]Metric, 0, len(batch)-len(isDone))
+	for i, m := range batch {
+		if !isDone[i] {
+			written = append(written, m)
+		}
+	}
+	r.log.Debugf("Wrote %d of %d metrics", len(written), len(batch))
+	if len(dropped) > 0 {
+		r.log.Errorf("Dropping %d metrics: %v", len(dropped), err)
+	}
+	r.buffer.Reject(failed)
+	acceptMetrics(written)
+	dropMetrics(dropped)
+	return err
+}
 
-	return nil
+// dropPermanent reports whether err is a PermanentError, the batch is then
+// dropped since writing it again would fail the same way.
+func (r *RunningOutput) dropPermanent(err error, batch []Metric) bool {
+	var perr *PermanentError
+	if !errors.As(err, &perr) {
+		return false
+	}
+	r.log.Errorf("Dropping batch of %d metrics: %v", len(batch), err)
+	return true
 }
 
 func (r *RunningOutput) writeMetrics(metrics []Metric) error {
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"encoding/json"
+
+	"telemetry/internal"
+)
+
+// seriesMetric is a metric holding its series as is, such as the metrics
+// built by parsers.
+type seriesMetric struct {
+	series []Series
+}
+
+// NewSeriesMetric returns a metric made of series.
+func NewSeriesMetric(series ...Series) SeriesMetric {
+	return &seriesMetric{series: series}
+}
+
+func (m *seriesMetric) IsMetric() {
+}
+
+func (m *seriesMetric) Copy() Metric {
+	series := make([]Series, len(m.series))
+	for i, s := range m.series {
+		tags := make(map[string]string, len(s.Tags))
+		for k, v := range s.Tags {
+			tags[k] = v
+		}
+		s.Tags = tags
+		if s.Fields != nil {
+			s.Fields = internal.DeepCopy(s.Fields).(map[string]any)
+		}
+		if s.Header != nil {
+			s.Header = internal.DeepCopy(s.Header).(map[string]any)
+		}
+		series[i] = s
+	}
+	return &seriesMetric{series: series}
+}
+
+func (m *seriesMetric) Series() []Series {
+	return m.series
+}
+
+// AddTag adds a tag to all series, the tags are copied since series may
+// share them.
+func (m *seriesMetric) AddTag(key, value string) {
+	for i, s := range m.series {
+		tags := make(map[string]string, len(s.Tags)+1)
+		for k, v := range s.Tags {
+			tags[k] = v
+		}
+		tags[key] = value
+		m.series[i].Tags = tags
+	}
+}
+
+func (m *seriesMetric) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.series)
+}
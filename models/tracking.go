@@ -0,0 +1,160 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// TrackingID identifies a group of metrics whose delivery is tracked.
+type TrackingID uint64
+
+// DeliveryInfo is the outcome of a tracked group, it is delivered once
+// every output accepted or dropped all metrics of the group.
+type DeliveryInfo interface {
+	ID() TrackingID
+
+	// Delivered is false when a metric of the group was dropped by an output
+	Delivered() bool
+}
+
+// DeliveryMetric is implemented by metrics whose delivery is tracked.
+// RunningOutput reports each of them as accepted once written or as dropped
+// when it is discarded.
+type DeliveryMetric interface {
+	Metric
+
+	Accept()
+	Drop()
+}
+
+// TrackingAccumulator is an Accumulator notifying the input of the delivery
+// of the metrics it added with AddTrackingMetricGroup.
+type TrackingAccumulator interface {
+	Accumulator
+
+	// AddTrackingMetricGroup adds a group of metrics whose outcome is sent
+	// on Delivered under the returned id.
+	AddTrackingMetricGroup(group []Metric) TrackingID
+
+	Delivered() <-chan DeliveryInfo
+}
+
+var lastTrackingID uint64
+
+func newTrackingID() TrackingID {
+	return TrackingID(atomic.AddUint64(&lastTrackingID, 1))
+}
+
+type trackingAccumulator struct {
+	Accumulator
+	delivered chan DeliveryInfo
+}
+
+// NewTrackingAccumulator wraps acc to track the delivery of metric groups.
+// The input must keep at most maxTracked groups whose outcome it has not
+// read from Delivered, outputs block on delivery otherwise.
+func NewTrackingAccumulator(acc Accumulator, maxTracked int) TrackingAccumulator {
+	return &trackingAccumulator{
+		Accumulator: acc,
+		delivered:   make(chan DeliveryInfo, maxTracked),
+	}
+}
+
+func (a *trackingAccumulator) AddTrackingMetricGroup(group []Metric) TrackingID {
+	g := &trackingGroup{
+		id:     newTrackingID(),
+		count:  int32(len(group)),
+		notify: a.onDelivery,
+	}
+	if len(group) == 0 {
+		g.notify(g)
+		return g.id
+	}
+	for _, m := range group {
+		a.AddMetric(&trackingMetric{Metric: m, group: g})
+	}
+	return g.id
+}
+
+func (a *trackingAccumulator) onDelivery(info DeliveryInfo) {
+	a.delivered <- info
+}
+
+func (a *trackingAccumulator) Delivered() <-chan DeliveryInfo {
+	return a.delivered
+}
+
+// trackingGroup counts the metrics of a group not yet accepted or dropped,
+// including the copies made for each output.
+type trackingGroup struct {
+	id      TrackingID
+	count   int32
+	dropped int32
+	once    sync.Once
+	notify  func(DeliveryInfo)
+}
+
+func (g *trackingGroup) ID() TrackingID {
+	return g.id
+}
+
+func (g *trackingGroup) Delivered() bool {
+	return atomic.LoadInt32(&g.dropped) == 0
+}
+
+func (g *trackingGroup) done() {
+	if atomic.AddInt32(&g.count, -1) == 0 {
+		g.once.Do(func() { g.notify(g) })
+	}
+}
+
+type trackingMetric struct {
+	Metric
+	group *trackingGroup
+}
+
+// Copy returns a copy tracked in the same group, the group is delivered
+// once all copies are.
+func (m *trackingMetric) Copy() Metric {
+	atomic.AddInt32(&m.group.count, 1)
+	return &trackingMetric{Metric: m.Metric.Copy(), group: m.group}
+}
+
+func (m *trackingMetric) Accept() {
+	m.group.done()
+}
+
+func (m *trackingMetric) Drop() {
+	atomic.AddInt32(&m.group.dropped, 1)
+	m.group.done()
+}
+
+// Series returns the series of the tracked metric, if it has any.
+func (m *trackingMetric) Series() []Series {
+	if sm, ok := m.Metric.(SeriesMetric); ok {
+		return sm.Series()
+	}
+	return nil
+}
+
+// MarshalJSON keeps the encoding of the tracked metric.
+func (m *trackingMetric) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Metric)
+}
+
+func acceptMetrics(metrics []Metric) {
+	for _, m := range metrics {
+		if dm, ok := m.(DeliveryMetric); ok {
+			dm.Accept()
+		}
+	}
+}
+
+func dropMetrics(metrics []Metric) {
+	for _, m := range metrics {
+		if dm, ok := m.(DeliveryMetric); ok {
+			dm.Drop()
+		}
+	}
+}
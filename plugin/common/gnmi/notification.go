@@ -0,0 +1,203 @@
+// Package gnmi converts gNMI notifications to series, it is shared by the
+// inputs receiving gNMI subscription responses.
+package gnmi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+// Decoder turns the updates of notifications into series. The updates
+// under an aliased path make series named after the alias, with the path
+// relative to the alias as field name. Other updates are named after their
+// parent path and use their last element as field name. The keys of the
+// path elements are tags.
+type Decoder struct {
+	aliases []alias
+}
+
+type alias struct {
+	path string
+	name string
+}
+
+// NewDecoder returns a decoder naming the series under the paths of
+// aliases, a map of path to name. Alias paths are given without keys.
+func NewDecoder(aliases map[string]string) (*Decoder, error) {
+	d := &Decoder{}
+	for path, name := range aliases {
+		p, err := ParsePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid alias path %q: %v", path, err)
+		}
+		d.aliases = append(d.aliases, alias{path: FormatPath(p.Elem), name: name})
+	}
+	// The longest path matches first
+	sort.Slice(d.aliases, func(i, j int) bool {
+		return len(d.aliases[i].path) > len(d.aliases[j].path)
+	})
+	return d, nil
+}
+
+// Series returns the series of the updates of a notification, updates
+// sharing name and tags are fields of the same series. tags are added to
+// all series. Deletes are ignored.
+func (d *Decoder) Series(n *gnmipb.Notification, tags map[string]string) ([]models.Series, error) {
+	tm := time.Now()
+	if n.Timestamp > 0 {
+		tm = time.Unix(0, n.Timestamp)
+	}
+
+	var series []models.Series
+	index := make(map[string]int)
+	for _, update := range n.Update {
+		elems := append(append([]*gnmipb.PathElem{}, n.GetPrefix().GetElem()...), update.GetPath().GetElem()...)
+		if len(elems) == 0 {
+			return nil, fmt.Errorf("update without path")
+		}
+		value, err := Value(update.Val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %v", FormatPathWithKeys(elems), err)
+		}
+
+		name, field := d.name(FormatPath(elems))
+		seriesTags := pathTags(elems, tags)
+
+		key := seriesKey(name, seriesTags)
+		i, ok := index[key]
+		if !ok {
+			i = len(series)
+			index[key] = i
+			series = append(series, models.Series{
+				Name:   name,
+				Tags:   seriesTags,
+				Fields: make(map[string]any),
+				Time:   tm,
+			})
+		}
+		series[i].Fields[field] = value
+	}
+	return series, nil
+}
+
+// name returns the series name and field name of a path.
+func (d *Decoder) name(path string) (string, string) {
+	for _, a := range d.aliases {
+		if path == a.path {
+			return a.name, path[strings.LastIndexByte(path, '/')+1:]
+		}
+		if strings.HasPrefix(path, a.path+"/") {
+			return a.name, path[len(a.path)+1:]
+		}
+	}
+	i := strings.LastIndexByte(path, '/')
+	if i == 0 {
+		return path, path[1:]
+	}
+	return path[:i], path[i+1:]
+}
+
+// pathTags returns the keys of the path elements as tags. A key already
+// used by a previous element is prefixed with the element name.
+func pathTags(elems []*gnmipb.PathElem, tags map[string]string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for k, v := range tags {
+		result[k] = v
+	}
+	for _, elem := range elems {
+		for k, v := range elem.Key {
+			if _, exists := result[k]; exists {
+				k = elem.Name + "_" + k
+			}
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func seriesKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, k := range keys {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte(0)
+		sb.WriteString(tags[k])
+	}
+	return sb.String()
+}
+
+// Value returns a typed value as int64, uint64, float64, bool or string.
+// JSON values are decoded into nested map[string]any and []any values,
+// bytes are base64 encoded.
+func Value(v *gnmipb.TypedValue) (any, error) {
+	switch val := v.GetValue().(type) {
+	case *gnmipb.TypedValue_StringVal:
+		return val.StringVal, nil
+	case *gnmipb.TypedValue_AsciiVal:
+		return val.AsciiVal, nil
+	case *gnmipb.TypedValue_IntVal:
+		return val.IntVal, nil
+	case *gnmipb.TypedValue_UintVal:
+		return val.UintVal, nil
+	case *gnmipb.TypedValue_BoolVal:
+		return val.BoolVal, nil
+	case *gnmipb.TypedValue_FloatVal:
+		return float64(val.FloatVal), nil
+	case *gnmipb.TypedValue_DoubleVal:
+		return val.DoubleVal, nil
+	case *gnmipb.TypedValue_DecimalVal:
+		return float64(val.DecimalVal.Digits) / math.Pow10(int(val.DecimalVal.Precision)), nil
+	case *gnmipb.TypedValue_BytesVal:
+		return base64.StdEncoding.EncodeToString(val.BytesVal), nil
+	case *gnmipb.TypedValue_ProtoBytes:
+		return base64.StdEncoding.EncodeToString(val.ProtoBytes), nil
+	case *gnmipb.TypedValue_LeaflistVal:
+		items := make([]any, 0, len(val.LeaflistVal.Element))
+		for _, element := range val.LeaflistVal.Element {
+			item, err := Value(element)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case *gnmipb.TypedValue_JsonVal:
+		return jsonValue(val.JsonVal)
+	case *gnmipb.TypedValue_JsonIetfVal:
+		return jsonValue(val.JsonIetfVal)
+	case nil:
+		return nil, fmt.Errorf("no value")
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", val)
+	}
+}
+
+// jsonValue decodes a JSON value, integers are int64, or uint64 when too
+// large, and other numbers float64.
+func jsonValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return internal.ConvertJSONNumbers(value), nil
+}
@@ -0,0 +1,98 @@
+package gnmi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+)
+
+// ParsePath parses a path such as
+// /interfaces/interface[name=Ethernet1]/state/counters, an origin is given
+// as a prefix ending with ':' like openconfig:/interfaces.
+func ParsePath(path string) (*gnmipb.Path, error) {
+	p := &gnmipb.Path{}
+	if i := strings.Index(path, ":/"); i > 0 && !strings.ContainsAny(path[:i], "/[") {
+		p.Origin = path[:i]
+		path = path[i+1:]
+	}
+
+	for _, elem := range splitPath(path) {
+		if elem == "" {
+			continue
+		}
+		name := elem
+		var keys map[string]string
+		if i := strings.IndexByte(elem, '['); i >= 0 {
+			name = elem[:i]
+			keys = make(map[string]string)
+			for rest := elem[i:]; rest != ""; {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("invalid keys in path element %q", elem)
+				}
+				k, v, ok := strings.Cut(rest[1:end], "=")
+				if !ok || k == "" {
+					return nil, fmt.Errorf("invalid key in path element %q", elem)
+				}
+				keys[k] = v
+				rest = rest[end+1:]
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("invalid path element %q", elem)
+		}
+		p.Elem = append(p.Elem, &gnmipb.PathElem{Name: name, Key: keys})
+	}
+	return p, nil
+}
+
+// splitPath splits a path on the '/' outside of keys.
+func splitPath(path string) []string {
+	var elems []string
+	var depth, start int
+	for i, c := range path {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				elems = append(elems, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(elems, path[start:])
+}
+
+// FormatPath returns the path of a list of elements without their keys.
+func FormatPath(elems []*gnmipb.PathElem) string {
+	var sb strings.Builder
+	for _, elem := range elems {
+		sb.WriteByte('/')
+		sb.WriteString(elem.Name)
+	}
+	return sb.String()
+}
+
+// FormatPathWithKeys returns the path of a list of elements with their
+// keys sorted by name.
+func FormatPathWithKeys(elems []*gnmipb.PathElem) string {
+	var sb strings.Builder
+	for _, elem := range elems {
+		sb.WriteByte('/')
+		sb.WriteString(elem.Name)
+		keys := make([]string, 0, len(elem.Key))
+		for k := range elem.Key {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&sb, "[%s=%s]", k, elem.Key[k])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"telemetry/internal"
+	"telemetry/plugin/common/oauth"
+	"telemetry/plugin/common/tls"
+)
+
+const defaultTimeout = internal.Duration(5 * time.Second)
+
+// HTTPClientConfig is the common configuration of HTTP clients.
+type HTTPClientConfig struct {
+	Timeout         internal.Duration `json:"timeout"`
+	IdleConnTimeout internal.Duration `json:"idle_conn_timeout"`
+	MaxIdleConns    int               `json:"max_idle_conn"`
+
+	oauth.OAuth2Config
+	tls.ClientConfig
+}
+
+// CreateClient returns an HTTP client with the TLS settings, timeouts and, if
+// configured, OAuth2 client credentials authentication.
+func (h *HTTPClientConfig) CreateClient() (*http.Client, error) {
+	tlsConfig, err := h.ClientConfig.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+		MaxIdleConns:    h.MaxIdleConns,
+		IdleConnTimeout: time.Duration(h.IdleConnTimeout),
+	}
+	if h.OAuth2Config.Enabled() {
+		transport = h.OAuth2Config.Transport(transport)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(timeout),
+	}, nil
+}
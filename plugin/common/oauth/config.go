@@ -0,0 +1,116 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// expiryDelta renews tokens this long before they expire.
+const expiryDelta = 10 * time.Second
+
+// OAuth2Config is the configuration of the OAuth2 client credentials flow.
+type OAuth2Config struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	TokenURL     string   `json:"token_url"`
+	Scopes       []string `json:"scopes"`
+}
+
+// Enabled reports whether the client credentials flow is configured.
+func (o *OAuth2Config) Enabled() bool {
+	return o.ClientID != "" && o.ClientSecret != "" && o.TokenURL != ""
+}
+
+// Transport returns a RoundTripper adding a bearer token obtained with the
+// client credentials flow to every request, the token requests are sent
+// through base.
+func (o *OAuth2Config) Transport(base http.RoundTripper) http.RoundTripper {
+	return &tokenTransport{
+		config: o,
+		base:   base,
+	}
+}
+
+type tokenTransport struct {
+	config *OAuth2Config
+	base   http.RoundTripper
+
+	mutex  sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.getToken(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("retrieving oauth2 token failed: %v", err)
+	}
+
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(r)
+}
+
+func (t *tokenTransport) getToken(ctx context.Context) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.token != "" && (t.expiry.IsZero() || time.Now().Add(expiryDelta).Before(t.expiry)) {
+		return t.token, nil
+	}
+
+	params := url.Values{}
+	params.Set("grant_type", "client_credentials")
+	if len(t.config.Scopes) > 0 {
+		params.Set("scope", strings.Join(t.config.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.config.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(t.config.ClientID), url.QueryEscape(t.config.ClientSecret))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s: %s", resp.Status, body)
+	}
+
+	var tr tokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil {
+		return "", fmt.Errorf("decoding token response failed: %v", err)
+	}
+	if tr.AccessToken == "" {
+		return "", fmt.Errorf("token endpoint returned no access token")
+	}
+
+	t.token = tr.AccessToken
+	t.expiry = time.Time{}
+	if tr.ExpiresIn > 0 {
+		t.expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return t.token, nil
+}
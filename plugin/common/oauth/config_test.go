@@ -0,0 +1,102 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type tokenServer struct {
+	expiresIn int
+
+	mutex          sync.Mutex
+	tokenRequests  []string
+	authorizations []string
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if r.URL.Path != "/token" {
+		s.authorizations = append(s.authorizations, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	id, secret, _ := r.BasicAuth()
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.tokenRequests = append(s.tokenRequests, fmt.Sprintf("%s:%s %s %s", id, secret, r.PostForm.Get("grant_type"), r.PostForm.Get("scope")))
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":%d}`, len(s.tokenRequests), s.expiresIn)
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name           string
+		expiresIn      int
+		tokenRequests  int
+		authorizations []string
+	}{
+		{
+			name:           "token reused",
+			expiresIn:      3600,
+			tokenRequests:  1,
+			authorizations: []string{"Bearer token-1", "Bearer token-1", "Bearer token-1"},
+		},
+		{
+			name:           "token renewed before expiry",
+			expiresIn:      5,
+			tokenRequests:  3,
+			authorizations: []string{"Bearer token-1", "Bearer token-2", "Bearer token-3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &tokenServer{expiresIn: tt.expiresIn}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			config := &OAuth2Config{
+				ClientID:     "id",
+				ClientSecret: "secret",
+				TokenURL:     ts.URL + "/token",
+				Scopes:       []string{"read", "write"},
+			}
+			require.True(t, config.Enabled())
+			client := &http.Client{Transport: config.Transport(http.DefaultTransport)}
+
+			for i := 0; i < 3; i++ {
+				resp, err := client.Post(ts.URL+"/write", "text/plain", nil)
+				require.NoError(t, err)
+				resp.Body.Close()
+				require.Equal(t, http.StatusNoContent, resp.StatusCode)
+			}
+
+			server.mutex.Lock()
+			defer server.mutex.Unlock()
+			require.Len(t, server.tokenRequests, tt.tokenRequests)
+			require.Equal(t, "id:secret client_credentials read write", server.tokenRequests[0])
+			require.Equal(t, tt.authorizations, server.authorizations)
+		})
+	}
+}
+
+func TestTransportTokenError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_client", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	config := &OAuth2Config{ClientID: "id", ClientSecret: "wrong", TokenURL: ts.URL + "/token"}
+	client := &http.Client{Transport: config.Transport(http.DefaultTransport)}
+	_, err := client.Get(ts.URL + "/write")
+	require.ErrorContains(t, err, "401 Unauthorized")
+}
@@ -0,0 +1,62 @@
+package protobuf
+
+import (
+	"fmt"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ParseFiles parses .proto files and returns them with the files they
+// import.
+func ParseFiles(parser protoparse.Parser, filenames ...string) (*protoregistry.Files, error) {
+	set, err := ParseSet(parser, filenames...)
+	if err != nil {
+		return nil, err
+	}
+	return protodesc.NewFiles(set)
+}
+
+// ParseSet parses .proto files and returns the set of them and of the files
+// they import, imports first.
+func ParseSet(parser protoparse.Parser, filenames ...string) (*descriptorpb.FileDescriptorSet, error) {
+	files, err := parser.ParseFiles(filenames...)
+	if err != nil {
+		return nil, err
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	for _, f := range files {
+		addWithImports(set, f, seen)
+	}
+	return set, nil
+}
+
+// addWithImports adds a parsed file and the files it imports to a set.
+func addWithImports(set *descriptorpb.FileDescriptorSet, f *desc.FileDescriptor, seen map[string]bool) {
+	if seen[f.GetName()] {
+		return
+	}
+	seen[f.GetName()] = true
+	for _, dep := range f.GetDependencies() {
+		addWithImports(set, dep, seen)
+	}
+	set.File = append(set.File, f.AsFileDescriptorProto())
+}
+
+// FindMessage returns the message of a full name.
+func FindMessage(files *protoregistry.Files, name string) (protoreflect.MessageDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, err
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+	return md, nil
+}
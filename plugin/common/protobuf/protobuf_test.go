@@ -0,0 +1,99 @@
+package protobuf
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var protos = map[string]string{
+	"state.proto": `syntax = "proto3";
+package test;
+
+enum State {
+  DOWN = 0;
+  UP = 1;
+}
+`,
+	"port.proto": `syntax = "proto3";
+package test;
+import "state.proto";
+
+message Port {
+  message Counters {
+    uint64 in_octets = 1;
+  }
+  string if_name = 1;
+  State oper_state = 2;
+  Counters counters = 3;
+  repeated int32 vlans = 4;
+  map<string, string> labels = 5;
+  bytes mac = 6;
+}
+`,
+}
+
+func TestMessageValues(t *testing.T) {
+	files, err := ParseFiles(protoparse.Parser{Accessor: protoparse.FileContentsFromMap(protos)}, "port.proto")
+	require.NoError(t, err)
+	require.Equal(t, 2, files.NumFiles())
+	md, err := FindMessage(files, "test.Port")
+	require.NoError(t, err)
+	_, err = FindMessage(files, "test.State")
+	require.Error(t, err)
+
+	fields := md.Fields()
+	msg := dynamicpb.NewMessage(md)
+	msg.Set(fields.ByName("if_name"), protoreflect.ValueOfString("et-0/0/0"))
+	msg.Set(fields.ByName("oper_state"), protoreflect.ValueOfEnum(1))
+	msg.Set(fields.ByName("mac"), protoreflect.ValueOfBytes([]byte{0xde, 0xad}))
+	vlans := msg.Mutable(fields.ByName("vlans")).List()
+	vlans.Append(protoreflect.ValueOfInt32(10))
+	vlans.Append(protoreflect.ValueOfInt32(20))
+	msg.Mutable(fields.ByName("labels")).Map().Set(
+		protoreflect.ValueOfString("role").MapKey(), protoreflect.ValueOfString("uplink"))
+
+	require.Equal(t, map[string]any{
+		"if_name":    "et-0/0/0",
+		"oper_state": "UP",
+		"vlans":      []any{int64(10), int64(20)},
+		"labels":     map[string]any{"role": "uplink"},
+		"mac":        "3q0=",
+	}, Walker{}.MessageValues(msg))
+
+	counters := fields.ByName("counters")
+	msg.Mutable(counters).Message().Set(counters.Message().Fields().ByName("in_octets"), protoreflect.ValueOfUint64(7))
+	w := Walker{Name: func(fd protoreflect.FieldDescriptor) string {
+		return strings.ReplaceAll(string(fd.Name()), "_", "-")
+	}}
+	values := w.MessageValues(msg)
+	require.Equal(t, map[string]any{"in-octets": uint64(7)}, values["counters"])
+	require.Equal(t, "UP", values["oper-state"])
+}
+
+func TestJSONValues(t *testing.T) {
+	files, err := ParseFiles(protoparse.Parser{Accessor: protoparse.FileContentsFromMap(protos)}, "port.proto")
+	require.NoError(t, err)
+	md, err := FindMessage(files, "test.Port")
+	require.NoError(t, err)
+
+	decoder := json.NewDecoder(strings.NewReader(`{"ifName":"et-0/0/0","oper_state":1,` +
+		`"counters":{"in_octets":"18446744073709551615"},"vlans":[10,-20],"labels":{"role":"uplink"},"unknown":2.0}`))
+	decoder.UseNumber()
+	var values map[string]any
+	require.NoError(t, decoder.Decode(&values))
+
+	require.Equal(t, map[string]any{
+		"ifName":     "et-0/0/0",
+		"oper_state": "UP",
+		"counters":   map[string]any{"in_octets": uint64(18446744073709551615)},
+		"vlans":      []any{int64(10), int64(-20)},
+		"labels":     map[string]any{"role": "uplink"},
+		"unknown":    float64(2),
+	}, Walker{}.JSONValues(values, md))
+}
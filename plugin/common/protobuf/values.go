@@ -0,0 +1,182 @@
+package protobuf
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"telemetry/internal"
+)
+
+// Walker returns the values of dynamic messages as maps by field name.
+type Walker struct {
+	// Name returns the name of the value of a field, the field name when
+	// nil.
+	Name func(fd protoreflect.FieldDescriptor) string
+}
+
+// MessageValues returns the fields of a message by name. Unset scalars have
+// their default value, unset messages and empty lists and maps are left
+// out.
+func (w Walker) MessageValues(msg protoreflect.Message) map[string]any {
+	fields := msg.Descriptor().Fields()
+	values := make(map[string]any, fields.Len())
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := string(fd.Name())
+		if w.Name != nil {
+			name = w.Name(fd)
+		}
+
+		switch {
+		case fd.IsList():
+			list := msg.Get(fd).List()
+			if list.Len() == 0 {
+				continue
+			}
+			items := make([]any, list.Len())
+			for j := range items {
+				items[j] = w.Value(fd, list.Get(j))
+			}
+			values[name] = items
+		case fd.IsMap():
+			entries := make(map[string]any)
+			msg.Get(fd).Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				entries[k.String()] = w.Value(fd.MapValue(), v)
+				return true
+			})
+			if len(entries) > 0 {
+				values[name] = entries
+			}
+		case fd.Message() != nil:
+			if msg.Has(fd) {
+				values[name] = w.MessageValues(msg.Get(fd).Message())
+			}
+		default:
+			values[name] = w.Value(fd, msg.Get(fd))
+		}
+	}
+	return values
+}
+
+// Value returns a single value of a field as int64, uint64, float64, bool,
+// string or the map of a message. Enums are their value name and bytes are
+// base64 encoded.
+func (w Walker) Value(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return w.MessageValues(v.Message())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int64(v.Enum())
+	case protoreflect.BoolKind:
+		return v.Bool()
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return v.Int()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return v.Uint()
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return v.Float()
+	}
+	return v.Interface()
+}
+
+// JSONValues returns the values of a JSON object decoded with UseNumber
+// with the types MessageValues returns for the fields of md. Numbers, and
+// the 64-bit integers given as strings by the proto3 JSON mapping, have the
+// type of their field, enums given by number are their value name. The
+// values of unknown fields are converted by internal.ConvertJSONNumbers.
+func (w Walker) JSONValues(values map[string]any, md protoreflect.MessageDescriptor) map[string]any {
+	for k, v := range values {
+		fd := w.jsonField(md, k)
+		switch {
+		case fd == nil:
+			values[k] = internal.ConvertJSONNumbers(v)
+		case fd.IsMap():
+			entries, ok := v.(map[string]any)
+			if !ok {
+				values[k] = internal.ConvertJSONNumbers(v)
+				continue
+			}
+			for ek, ev := range entries {
+				entries[ek] = w.jsonValue(fd.MapValue(), ev)
+			}
+		default:
+			if items, ok := v.([]any); ok {
+				for i, item := range items {
+					items[i] = w.jsonValue(fd, item)
+				}
+				continue
+			}
+			values[k] = w.jsonValue(fd, v)
+		}
+	}
+	return values
+}
+
+// jsonField returns the field of md named key by Name, by its proto name or
+// by its JSON name.
+func (w Walker) jsonField(md protoreflect.MessageDescriptor, key string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if string(fd.Name()) == key || fd.JSONName() == key || (w.Name != nil && w.Name(fd) == key) {
+			return fd
+		}
+	}
+	return nil
+}
+
+// jsonValue returns a single JSON value of a field with the type Value
+// returns.
+func (w Walker) jsonValue(fd protoreflect.FieldDescriptor, value any) any {
+	var s string
+	switch v := value.(type) {
+	case map[string]any:
+		if fd.Message() != nil {
+			return w.JSONValues(v, fd.Message())
+		}
+		return internal.ConvertJSONNumbers(v)
+	case json.Number:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return internal.ConvertJSONNumbers(value)
+	}
+
+	switch fd.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return u
+		}
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case protoreflect.EnumKind:
+		if n, err := strconv.ParseInt(s, 10, 32); err == nil {
+			if ev := fd.Enum().Values().ByNumber(protoreflect.EnumNumber(n)); ev != nil {
+				return string(ev.Name())
+			}
+			return n
+		}
+	case protoreflect.StringKind:
+		return s
+	}
+	return internal.ConvertJSONNumbers(value)
+}
@@ -47,7 +47,7 @@ func (c *ClientConfig) TLSConfig() (*tls.Config, error) {
 		if err != nil {
 			return nil, err
 		}
-		tlsConfig.ClientCAs = pool
+		tlsConfig.RootCAs = pool
 	}
 
 	if c.TLSCert != "" && c.TLSKey != "" {
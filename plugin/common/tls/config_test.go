@@ -0,0 +1,67 @@
+package tls
+
+import (
+	"crypto/tls"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/internal/testutil"
+)
+
+// writeCertificates writes a CA, ca.pem, and certificates signed by it for
+// each name, <name>.pem and <name>.key.
+func TestClientConfigCA(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteCertificates(t, dir, "server", "client")
+
+	tlsConfig, err := (&ClientConfig{
+		TLSCA:   filepath.Join(dir, "ca.pem"),
+		TLSCert: filepath.Join(dir, "client.pem"),
+		TLSKey:  filepath.Join(dir, "client.key"),
+	}).TLSConfig()
+	require.NoError(t, err)
+	require.NotNil(t, tlsConfig.RootCAs)
+	require.Nil(t, tlsConfig.ClientCAs)
+	require.Len(t, tlsConfig.Certificates, 1)
+}
+
+func TestClientServerHandshake(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteCertificates(t, dir, "server", "client")
+
+	serverConfig, err := (&ServerConfig{
+		TLSCert:            filepath.Join(dir, "server.pem"),
+		TLSKey:             filepath.Join(dir, "server.key"),
+		TLSAllowedCACerts:  []string{filepath.Join(dir, "ca.pem")},
+		TLSAllowedDNSNames: []string{"client"},
+	}).TLSConfig()
+	require.NoError(t, err)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		//nolint:errcheck // the client checks the handshake
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	// The server certificate is verified with the CA of tls_ca
+	clientConfig, err := (&ClientConfig{
+		TLSCA:      filepath.Join(dir, "ca.pem"),
+		TLSCert:    filepath.Join(dir, "client.pem"),
+		TLSKey:     filepath.Join(dir, "client.key"),
+		ServerName: "server",
+	}).TLSConfig()
+	require.NoError(t, err)
+	conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+	require.NoError(t, err)
+	require.NoError(t, conn.Handshake())
+	require.NoError(t, conn.Close())
+}
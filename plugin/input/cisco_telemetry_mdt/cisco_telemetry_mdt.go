@@ -2,11 +2,14 @@ package cisco_telemetry_mdt
 
 import (
 	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -21,6 +24,7 @@ import (
 
 	"telemetry/internal"
 	"telemetry/models"
+	"telemetry/plugin/common/gnmi"
 	interTLS "telemetry/plugin/common/tls"
 )
 
@@ -36,8 +40,26 @@ type CiscoTelemetryMDT struct {
 	MaxMsgSize        int                   `json:"max_msg_size"`
 	EnforcementPolicy GRPCEnforcementPolicy `json:"grpc_enforcement_policy"`
 
+	// Directory of the models decoding compact GPB rows
+	ProtoDir string `json:"proto_dir"`
+
+	// Metrics of a message, or of each of its rows, the series of the rows
+	// are named after the aliases of their encoding path
+	MetricMode   string            `json:"metric_mode"`
+	Aliases      map[string]string `json:"aliases"`
+	EmbeddedTags []string          `json:"embedded_tags"`
+
+	// Dialout connections limits, by default any peer may connect
+	AllowedSources          []string          `json:"allowed_sources"`
+	MaxConnections          int               `json:"max_connections"`
+	MaxConnectionsPerSource int               `json:"max_connections_per_source"`
+	IdleTimeout             internal.Duration `json:"idle_timeout"`
+
 	log *logrus.Entry
 
+	decoder     *Decoder
+	gnmiDecoder *gnmi.Decoder
+
 	// GRPC TLS settings
 	interTLS.ServerConfig
 
@@ -61,13 +83,44 @@ func NewCiscoTelemetryMDT() *CiscoTelemetryMDT {
 func (c *CiscoTelemetryMDT) Start(acc models.Accumulator) error {
 	var err error
 	c.acc = acc
-	c.listener, err = net.Listen("tcp", c.ServiceAddress)
+	switch c.MetricMode {
+	case "", metricModeMessage, metricModeRow:
+	default:
+		return fmt.Errorf("invalid metric mode: %s", c.MetricMode)
+	}
+	c.decoder, err = NewDecoder(c.ProtoDir)
+	if err != nil {
+		return err
+	}
+	c.decoder.SetNaming(c.Aliases, c.EmbeddedTags)
+	tlsConfig, err := c.ServerConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+	allowed, err := parseSources(c.AllowedSources)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", c.ServiceAddress)
 	if err != nil {
 		return err
 	}
+	c.listener = &sourceListener{
+		Listener:       listener,
+		allowed:        allowed,
+		maxConnections: c.MaxConnections,
+		maxPerSource:   c.MaxConnectionsPerSource,
+		idleTimeout:    time.Duration(c.IdleTimeout),
+		log:            c.log,
+		sources:        make(map[string]int),
+	}
 
 	switch c.Transport {
 	case "tcp":
+		if tlsConfig != nil {
+			c.listener = tls.NewListener(c.listener, tlsConfig)
+		}
+
 		// TCP dialout server accept routine
 		c.wg.Add(1)
 		go func() {
@@ -76,11 +129,7 @@ func (c *CiscoTelemetryMDT) Start(acc models.Accumulator) error {
 		}()
 	case "grpc":
 		var opts []grpc.ServerOption
-		tlsConfig, err := c.ServerConfig.TLSConfig()
-		if err != nil {
-			_ = c.listener.Close()
-			return err
-		} else if tlsConfig != nil {
+		if tlsConfig != nil {
 			opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
 		}
 
@@ -97,8 +146,15 @@ func (c *CiscoTelemetryMDT) Start(acc models.Accumulator) error {
 			}))
 		}
 
+		c.gnmiDecoder, err = gnmi.NewDecoder(nil)
+		if err != nil {
+			_ = c.listener.Close()
+			return err
+		}
+
 		c.grpcServer = grpc.NewServer(opts...)
 		mdtdialout.RegisterGRPCMdtDialoutServer(c.grpcServer, c)
+		c.grpcServer.RegisterService(&gnmiDialoutServiceDesc, c)
 
 		c.wg.Add(1)
 		go func() {
@@ -134,7 +190,7 @@ func (c *CiscoTelemetryMDT) acceptTCPClients() {
 		c.wg.Add(1)
 		go func() {
 			c.log.Infof("Accepted Cisco MDT TCP dialout connection from %s", conn.RemoteAddr())
-			if err := c.handleTCPClient(conn); err != nil {
+			if err := c.handleTCPClient(conn); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
 				c.log.Errorf("handle tcp client error: %v", err)
 			}
 			c.log.Infof("Closed Cisco MDT TCP dialout connection from %s", conn.RemoteAddr())
@@ -190,6 +246,16 @@ func (c *CiscoTelemetryMDT) handleTCPClient(conn net.Conn) error {
 			return fmt.Errorf("invalid dialout flags: %v", hdr.MsgFlags)
 		}
 
+		var decode func([]byte, string) (models.Metric, error)
+		switch hdr.MsgEncap {
+		case encapGPB, encapGPBCompact, encapGPBKV:
+			decode = c.decoder.DecodeGPB
+		case encapJSON:
+			decode = c.decoder.DecodeJSON
+		default:
+			return fmt.Errorf("invalid dialout encapsulation: %v", hdr.MsgEncap)
+		}
+
 		// Read and handle telemetry packet
 		payload.Reset()
 		if size, err := payload.ReadFrom(io.LimitReader(conn, int64(hdr.MsgLen))); size != int64(hdr.MsgLen) {
@@ -199,7 +265,7 @@ func (c *CiscoTelemetryMDT) handleTCPClient(conn net.Conn) error {
 			return fmt.Errorf("TCP dialout premature EOF")
 		}
 
-		c.handleTelemetry(payload.Bytes(), sourceIp)
+		c.handleTelemetry(payload.Bytes(), sourceIp, decode)
 	}
 }
 
@@ -229,13 +295,13 @@ func (c *CiscoTelemetryMDT) MdtDialout(stream mdtdialout.GRPCMdtDialout_MdtDialo
 
 		// Reassemble chunked telemetry data received from NX-OS
 		if packet.TotalSize == 0 {
-			c.handleTelemetry(packet.Data, sourceIP)
+			c.handleTelemetry(packet.Data, sourceIP, c.decoder.Decode)
 		} else if int(packet.TotalSize) <= c.MaxMsgSize {
 			if _, err := chunkBuffer.Write(packet.Data); err != nil {
 				c.log.Errorf("writing packet %q failed: %v", packet.Data, err)
 			}
 			if chunkBuffer.Len() >= int(packet.TotalSize) {
-				c.handleTelemetry(chunkBuffer.Bytes(), sourceIP)
+				c.handleTelemetry(chunkBuffer.Bytes(), sourceIP, c.decoder.Decode)
 				chunkBuffer.Reset()
 			}
 		} else {
@@ -267,39 +333,105 @@ func (c *CiscoTelemetryMDT) Gather(_ models.Accumulator) error {
 	return nil
 }
 
-func (c *CiscoTelemetryMDT) handleTelemetry(data []byte, sourceIP string) {
-	msg := &telemetry_bis.Telemetry{}
-	err := proto.Unmarshal(data, msg)
-	if err != nil {
+func (c *CiscoTelemetryMDT) handleTelemetry(data []byte, sourceIP string, decode func([]byte, string) (models.Metric, error)) {
+	m, err := decode(data, sourceIP)
+	if m == nil {
 		c.log.Errorf("failed to decode: %v", err)
 		return
 	}
-
-	m := NewCiscoTelemetryMetric(sourceIP)
-	gbpkv, err := json.Marshal(msg)
 	if err != nil {
-		c.log.Errorf("Gpbkv Parse Failure")
+		c.log.Errorf("parse row data error: %v", err)
+	}
+
+	if c.MetricMode == metricModeRow {
+		if rm, ok := m.(*metric); ok {
+			for _, row := range rm.RowMetrics() {
+				c.acc.AddMetric(row)
+			}
+			return
+		}
 	}
+	c.acc.AddMetric(m)
+}
 
-	var v any
-	err = json.Unmarshal(gbpkv, &v)
+// Decoder decodes telemetry_bis messages. Compact GPB rows are decoded
+// with the models loaded from the proto directory, kvGPB rows need none.
+type Decoder struct {
+	registry *gpbRegistry
+	naming   *naming
+}
+
+// NewDecoder loads the compact GPB models of protoDir, either compiled
+// FileDescriptorSets or .proto files. Without a directory only kvGPB rows
+// are decoded.
+func NewDecoder(protoDir string) (*Decoder, error) {
+	if protoDir == "" {
+		return &Decoder{}, nil
+	}
+	registry, err := loadGPBRegistry(protoDir)
 	if err != nil {
-		c.log.Infoln("unmarshal json err: ", err)
+		return nil, fmt.Errorf("loading models of %s failed: %v", protoDir, err)
 	}
+	return &Decoder{registry: registry}, nil
+}
 
-	telemetryData := v.(map[string]any)
-	for k, v := range telemetryData {
-		if k != "data_gpbkv" {
-			m.parseTelemetry(k, v)
-		} else {
-			err = m.parseRow(v)
-			if err != nil {
-				c.log.Errorf("parse row data error")
-			}
+// SetNaming names the series of the rows after aliases, a map of encoding
+// path to name, and promotes the keys of nested lists given by the paths of
+// embeddedTags to tags of series of their own.
+func (d *Decoder) SetNaming(aliases map[string]string, embeddedTags []string) {
+	if len(aliases) == 0 && len(embeddedTags) == 0 {
+		d.naming = nil
+		return
+	}
+	d.naming = newNaming(aliases, embeddedTags)
+}
+
+// Decode returns the metric of a telemetry message, source is the address
+// of the device sending it. The message is either GPB or JSON encoded. When
+// some rows cannot be parsed the metric of the other rows is returned along
+// with the error.
+func (d *Decoder) Decode(data []byte, source string) (models.Metric, error) {
+	if isJSON(data) {
+		return d.DecodeJSON(data, source)
+	}
+	return d.DecodeGPB(data, source)
+}
+
+// DecodeGPB returns the metric of a GPB encoded telemetry_bis message, see
+// Decode.
+func (d *Decoder) DecodeGPB(data []byte, source string) (models.Metric, error) {
+	msg := &telemetry_bis.Telemetry{}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	m := NewCiscoTelemetryMetric(source)
+	m.naming = d.naming
+	m.parseHeader(msg)
+	if len(msg.GetDataGpb().GetRow()) > 0 {
+		if d.registry == nil {
+			return m, fmt.Errorf("compact GPB rows of %q not decoded, no proto_dir set", msg.EncodingPath)
 		}
+		return m, m.parseGPBRows(d.registry, msg.DataGpb)
 	}
+	return m, m.parseRows(msg.DataGpbkv)
+}
 
-	c.acc.AddMetric(m)
+// DecodeJSON returns the metric of a JSON encoded telemetry message, see
+// Decode.
+func (d *Decoder) DecodeJSON(data []byte, source string) (models.Metric, error) {
+	m := NewCiscoTelemetryMetric(source)
+	m.naming = d.naming
+	if err := m.parseJSON(d.registry, data); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Decode returns the metric of a kvGPB or JSON encoded telemetry message,
+// see Decoder.Decode.
+func Decode(data []byte, source string) (models.Metric, error) {
+	return (&Decoder{}).Decode(data, source)
 }
 
 func (c *CiscoTelemetryMDT) ParseConfig(cfg map[string]any) error {
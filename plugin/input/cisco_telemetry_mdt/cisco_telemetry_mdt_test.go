@@ -0,0 +1,743 @@
+package cisco_telemetry_mdt
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cisco-ie/nx-telemetry-proto/telemetry_bis"
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"telemetry/internal"
+	"telemetry/internal/testutil"
+	"telemetry/models"
+	"telemetry/plugin/common/gnmi"
+	interTLS "telemetry/plugin/common/tls"
+)
+
+func stringField(name, value string) *telemetry_bis.TelemetryField {
+	return &telemetry_bis.TelemetryField{
+		Name:        name,
+		ValueByType: &telemetry_bis.TelemetryField_StringValue{StringValue: value},
+	}
+}
+
+func uint64Field(name string, value uint64) *telemetry_bis.TelemetryField {
+	return &telemetry_bis.TelemetryField{
+		Name:        name,
+		ValueByType: &telemetry_bis.TelemetryField_Uint64Value{Uint64Value: value},
+	}
+}
+
+// interfaceCounters returns an IOS XR generic-counters message with a row
+// per interface.
+func interfaceCounters(interfaces int) *telemetry_bis.Telemetry {
+	counters := []string{
+		"packets-received", "bytes-received", "packets-sent", "bytes-sent",
+		"multicast-packets-received", "broadcast-packets-received",
+		"multicast-packets-sent", "broadcast-packets-sent", "output-drops",
+		"output-queue-drops", "input-drops", "input-queue-drops",
+		"runt-packets-received", "giant-packets-received", "throttled-packets-received",
+		"parity-packets-received", "unknown-protocol-packets-received", "input-errors",
+		"crc-errors", "input-overruns", "framing-errors-received", "input-ignored-packets",
+		"input-aborts", "output-errors", "output-underruns", "output-buffer-failures",
+		"output-buffers-swapped-out", "applique", "resets", "carrier-transitions",
+	}
+
+	msg := &telemetry_bis.Telemetry{
+		NodeId:              &telemetry_bis.Telemetry_NodeIdStr{NodeIdStr: "router-1"},
+		Subscription:        &telemetry_bis.Telemetry_SubscriptionIdStr{SubscriptionIdStr: "interfaces"},
+		EncodingPath:        "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+		CollectionId:        1001,
+		CollectionStartTime: 1678183200000,
+		MsgTimestamp:        1678183200000,
+		CollectionEndTime:   1678183200010,
+	}
+	for i := 0; i < interfaces; i++ {
+		content := &telemetry_bis.TelemetryField{Name: "content"}
+		for j, c := range counters {
+			content.Fields = append(content.Fields, uint64Field(c, uint64(1<<62+i*100+j)))
+		}
+		content.Fields = append(content.Fields, &telemetry_bis.TelemetryField{
+			Name:        "last-data-time",
+			ValueByType: &telemetry_bis.TelemetryField_Uint32Value{Uint32Value: 1678183200},
+		})
+		msg.DataGpbkv = append(msg.DataGpbkv, &telemetry_bis.TelemetryField{
+			Timestamp: 1678183200005,
+			Fields: []*telemetry_bis.TelemetryField{
+				{Name: "keys", Fields: []*telemetry_bis.TelemetryField{
+					stringField("interface-name", fmt.Sprintf("HundredGigE0/0/0/%d", i)),
+				}},
+				content,
+			},
+		})
+	}
+	return msg
+}
+
+func BenchmarkDecode(b *testing.B) {
+	data, err := proto.Marshal(interfaceCounters(50))
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decode(data, "10.0.0.1:57500"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeRoundTrip measures the previous decoder, which converted the
+// message into generic maps with a json.Marshal/json.Unmarshal round-trip
+// before walking the rows.
+func BenchmarkDecodeRoundTrip(b *testing.B) {
+	data, err := proto.Marshal(interfaceCounters(50))
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := roundTripDecode(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// roundTripDecode decodes data the way the decoder did before the rows were
+// walked directly on the protobuf message.
+func roundTripDecode(data []byte) ([]row, error) {
+	msg := &telemetry_bis.Telemetry{}
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var v map[string]any
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return nil, err
+	}
+
+	rows, _ := v["data_gpbkv"].([]any)
+	out := make([]row, 0, len(rows))
+	for _, r := range rows {
+		fields := roundTripFields(r.(map[string]any)["fields"].([]any))
+		out = append(out, row{Keys: fields["keys"], Content: fields["content"]})
+	}
+	return out, nil
+}
+
+func roundTripFields(fields []any) map[string]any {
+	values := make(map[string]any, len(fields))
+	for _, f := range fields {
+		field := f.(map[string]any)
+		name, _ := field["name"].(string)
+		var value any
+		if children, ok := field["fields"].([]any); ok {
+			value = roundTripFields(children)
+		} else if typed, ok := field["ValueByType"].(map[string]any); ok {
+			for _, v := range typed {
+				value = v
+			}
+		}
+		if existing, ok := values[name]; ok {
+			delete(values, name)
+			values[name+"_arr"] = []any{existing, value}
+		} else if list, ok := values[name+"_arr"].([]any); ok {
+			values[name+"_arr"] = append(list, value)
+		} else {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// BenchmarkDecodeSeries includes the conversion into series done by the
+// serializers.
+func BenchmarkDecodeSeries(b *testing.B) {
+	data, err := proto.Marshal(interfaceCounters(50))
+	require.NoError(b, err)
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m, err := Decode(data, "10.0.0.1:57500")
+		if err != nil {
+			b.Fatal(err)
+		}
+		m.(*metric).Series()
+	}
+}
+
+func TestDecode(t *testing.T) {
+	data, err := proto.Marshal(interfaceCounters(2))
+	require.NoError(t, err)
+
+	m, err := Decode(data, "10.0.0.1:57500")
+	require.NoError(t, err)
+
+	series := m.(*metric).Series()
+	require.Len(t, series, 2)
+	require.Equal(t, "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters", series[1].Name)
+	require.Equal(t, map[string]string{
+		"source":         "10.0.0.1",
+		"node_id":        "router-1",
+		"subscription":   "interfaces",
+		"interface-name": "HundredGigE0/0/0/1",
+	}, series[1].Tags)
+	require.Equal(t, uint64(1<<62+101), series[1].Fields["bytes-received"])
+	require.Equal(t, uint64(1678183200), series[1].Fields["last-data-time"])
+	require.Equal(t, uint64(1001), series[1].Header["collection_id"])
+	require.Equal(t, int64(1678183200005), series[1].Time.UnixMilli())
+}
+
+func TestAddTag(t *testing.T) {
+	data, err := proto.Marshal(interfaceCounters(1))
+	require.NoError(t, err)
+	m, err := Decode(data, "")
+	require.NoError(t, err)
+	before, err := json.Marshal(m)
+	require.NoError(t, err)
+
+	m.(models.TaggedMetric).AddTag("topic", "telemetry")
+	require.Equal(t, "telemetry", m.(*metric).Series()[0].Tags["topic"])
+	require.Equal(t, "telemetry", m.Copy().(*metric).Series()[0].Tags["topic"])
+
+	// The metric keeps its encoding, with the tags added
+	after, err := json.Marshal(m)
+	require.NoError(t, err)
+	require.Equal(t, string(before[:len(before)-1])+`,"Tags":{"topic":"telemetry"}}`, string(after))
+}
+
+func TestDecodeRepeatedAndNexusFields(t *testing.T) {
+	msg := &telemetry_bis.Telemetry{
+		EncodingPath: "show system resources",
+		MsgTimestamp: 1678183200000,
+		DataGpbkv: []*telemetry_bis.TelemetryField{{
+			Fields: []*telemetry_bis.TelemetryField{
+				{Name: "keys", Fields: []*telemetry_bis.TelemetryField{stringField("name", "cpu")}},
+				{Name: "content", Fields: []*telemetry_bis.TelemetryField{
+					{Fields: []*telemetry_bis.TelemetryField{
+						{Name: "load", Fields: []*telemetry_bis.TelemetryField{uint64Field("avg", 1)}},
+						{Name: "load", Fields: []*telemetry_bis.TelemetryField{uint64Field("avg", 5)}},
+						{
+							Name:        "temperature",
+							ValueByType: &telemetry_bis.TelemetryField_Sint32Value{Sint32Value: -3},
+						},
+					}},
+				}},
+			},
+		}},
+	}
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+
+	m, err := Decode(data, "")
+	require.NoError(t, err)
+
+	series := m.(*metric).Series()
+	require.Len(t, series, 1)
+	require.Equal(t, map[string]any{
+		"load":        []any{map[string]any{"avg": uint64(1)}, map[string]any{"avg": uint64(5)}},
+		"temperature": int64(-3),
+	}, series[0].Fields)
+	require.Equal(t, int64(1678183200000), series[0].Time.UnixMilli())
+}
+
+func TestDecodeAliasesAndEmbeddedTags(t *testing.T) {
+	classStats := func(name string, packets uint64) *telemetry_bis.TelemetryField {
+		return &telemetry_bis.TelemetryField{Name: "class-stats", Fields: []*telemetry_bis.TelemetryField{
+			stringField("class-name", name),
+			{Name: "general-stats", Fields: []*telemetry_bis.TelemetryField{uint64Field("transmit-packets", packets)}},
+		}}
+	}
+	path := "Cisco-IOS-XR-qos-ma-oper:qos/interface-table/interface/input/service-policy-names/service-policy-instance/statistics"
+	msg := &telemetry_bis.Telemetry{
+		NodeId:       &telemetry_bis.Telemetry_NodeIdStr{NodeIdStr: "router-1"},
+		EncodingPath: path,
+		MsgTimestamp: 1678183200000,
+		DataGpbkv: []*telemetry_bis.TelemetryField{{
+			Fields: []*telemetry_bis.TelemetryField{
+				{Name: "keys", Fields: []*telemetry_bis.TelemetryField{
+					stringField("interface-name", "HundredGigE0/0/0/0"),
+				}},
+				{Name: "content", Fields: []*telemetry_bis.TelemetryField{
+					stringField("policy-name", "qos-in"),
+					classStats("voice", 10),
+					classStats("class-default", 20),
+				}},
+			},
+		}},
+	}
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+
+	d, err := NewDecoder("")
+	require.NoError(t, err)
+	d.SetNaming(map[string]string{path: "qos_input"}, []string{path + "/class-stats/class-name"})
+
+	c := NewCiscoTelemetryMDT()
+	c.MetricMode = metricModeRow
+	c.decoder = d
+	acc := &testutil.Accumulator{}
+	c.acc = acc
+	c.handleTelemetry(data, "10.0.0.1:57500", d.Decode)
+
+	require.Len(t, acc.Metrics(), 1)
+	series := acc.Metrics()[0].(models.SeriesMetric).Series()
+	require.Len(t, series, 3)
+	require.Equal(t, "qos_input", series[0].Name)
+	require.Equal(t, map[string]any{"policy-name": "qos-in"}, series[0].Fields)
+
+	classes := make(map[string]any)
+	for _, s := range series[1:] {
+		require.Equal(t, "qos_input/class-stats", s.Name)
+		require.Equal(t, "HundredGigE0/0/0/0", s.Tags["interface-name"])
+		require.Equal(t, "router-1", s.Tags["node_id"])
+		require.Equal(t, "10.0.0.1", s.Tags["source"])
+		classes[s.Tags["class-name"]] = s.Fields["general-stats"]
+	}
+	// The encoding path is kept in the header of renamed series
+	for _, s := range series {
+		require.Equal(t, path, s.Header["encoding_path"])
+	}
+	require.Equal(t, map[string]any{
+		"voice":         map[string]any{"transmit-packets": uint64(10)},
+		"class-default": map[string]any{"transmit-packets": uint64(20)},
+	}, classes)
+}
+
+const genericCountersProto = `syntax = "proto3";
+
+package cisco_ios_xr_infra_statsd_oper.infra_statistics.interfaces.interface.latest.generic_counters;
+
+message ifstatsbag_generic_KEYS {
+  string interface_name = 1;
+}
+
+message ifstatsbag_generic {
+  enum state {
+    down = 0;
+    up = 1;
+  }
+  uint64 packets_received = 1;
+  uint64 bytes_received = 2;
+  sint32 carrier_transitions = 3;
+  double utilization = 4;
+  state line_state = 5;
+  repeated uint32 queue_drops = 6;
+}
+`
+
+// genericCountersMessage returns an IOS XR generic-counters message with a
+// compact GPB row encoded with the models of registry.
+func genericCountersMessage(t *testing.T, r *gpbRegistry) *telemetry_bis.Telemetry {
+	messages, ok := r.lookup(interfaceCounters(0).EncodingPath)
+	require.True(t, ok)
+
+	keys := dynamicpb.NewMessage(messages.keys)
+	keys.Set(messages.keys.Fields().ByName("interface_name"), protoreflect.ValueOfString("HundredGigE0/0/0/1"))
+	keysData, err := proto.Marshal(keys)
+	require.NoError(t, err)
+
+	fields := messages.content.Fields()
+	content := dynamicpb.NewMessage(messages.content)
+	content.Set(fields.ByName("bytes_received"), protoreflect.ValueOfUint64(1<<62))
+	content.Set(fields.ByName("carrier_transitions"), protoreflect.ValueOfInt32(-2))
+	content.Set(fields.ByName("utilization"), protoreflect.ValueOfFloat64(0.5))
+	content.Set(fields.ByName("line_state"), protoreflect.ValueOfEnum(1))
+	drops := content.Mutable(fields.ByName("queue_drops")).List()
+	drops.Append(protoreflect.ValueOfUint32(3))
+	drops.Append(protoreflect.ValueOfUint32(4))
+	contentData, err := proto.Marshal(content)
+	require.NoError(t, err)
+
+	msg := interfaceCounters(0)
+	msg.DataGpb = &telemetry_bis.TelemetryGPBTable{
+		Row: []*telemetry_bis.TelemetryRowGPB{{Timestamp: 1678183200005, Keys: keysData, Content: contentData}},
+	}
+	return msg
+}
+
+// writeGenericCountersModel returns a proto directory holding the
+// generic-counters model.
+func writeGenericCountersModel(t *testing.T) string {
+	protoDir := t.TempDir()
+	modelDir := filepath.Join(protoDir, "cisco_ios_xr_infra_statsd_oper", "infra_statistics")
+	require.NoError(t, os.MkdirAll(modelDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(modelDir, "ifstatsbag_generic.proto"), []byte(genericCountersProto), 0o600))
+	return protoDir
+}
+
+func TestDecodeCompactGPB(t *testing.T) {
+	protoDir := writeGenericCountersModel(t)
+
+	// The same model compiled to a FileDescriptorSet
+	r, err := loadGPBRegistry(protoDir)
+	require.NoError(t, err)
+	messages, ok := r.lookup(interfaceCounters(0).EncodingPath)
+	require.True(t, ok)
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(messages.keys.ParentFile())},
+	}
+	setData, err := proto.Marshal(set)
+	require.NoError(t, err)
+	setDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(setDir, "ifstatsbag_generic.pb"), setData, 0o600))
+
+	data, err := proto.Marshal(genericCountersMessage(t, r))
+	require.NoError(t, err)
+
+	for _, dir := range []string{protoDir, setDir} {
+		decoder, err := NewDecoder(dir)
+		require.NoError(t, err)
+
+		m, err := decoder.Decode(data, "10.0.0.1:57500")
+		require.NoError(t, err)
+
+		series := m.(*metric).Series()
+		require.Len(t, series, 1)
+		require.Equal(t, map[string]string{
+			"source":         "10.0.0.1",
+			"node_id":        "router-1",
+			"subscription":   "interfaces",
+			"interface-name": "HundredGigE0/0/0/1",
+		}, series[0].Tags)
+		require.Equal(t, map[string]any{
+			"packets-received":    uint64(0),
+			"bytes-received":      uint64(1 << 62),
+			"carrier-transitions": int64(-2),
+			"utilization":         0.5,
+			"line-state":          "up",
+			"queue-drops":         []any{uint64(3), uint64(4)},
+		}, series[0].Fields)
+		require.Equal(t, int64(1678183200005), series[0].Time.UnixMilli())
+
+		// The rows are the same as the ones of the kvGPB encoding
+		kv := interfaceCounters(0)
+		kv.DataGpbkv = []*telemetry_bis.TelemetryField{{
+			Timestamp: 1678183200005,
+			Fields: []*telemetry_bis.TelemetryField{
+				{Name: "keys", Fields: []*telemetry_bis.TelemetryField{stringField("interface-name", "HundredGigE0/0/0/1")}},
+				{Name: "content", Fields: []*telemetry_bis.TelemetryField{
+					uint64Field("packets-received", 0),
+					uint64Field("bytes-received", 1<<62),
+					{Name: "carrier-transitions", ValueByType: &telemetry_bis.TelemetryField_Sint32Value{Sint32Value: -2}},
+					{Name: "utilization", ValueByType: &telemetry_bis.TelemetryField_DoubleValue{DoubleValue: 0.5}},
+					stringField("line-state", "up"),
+					{Name: "queue-drops", ValueByType: &telemetry_bis.TelemetryField_Uint32Value{Uint32Value: 3}},
+					{Name: "queue-drops", ValueByType: &telemetry_bis.TelemetryField_Uint32Value{Uint32Value: 4}},
+				}},
+			},
+		}}
+		kvData, err := proto.Marshal(kv)
+		require.NoError(t, err)
+		kvMetric, err := Decode(kvData, "10.0.0.1:57500")
+		require.NoError(t, err)
+		require.Equal(t, kvMetric.(*metric).Rows, m.(*metric).Rows)
+	}
+
+	// Without models the compact GPB rows are reported
+	_, err = Decode(data, "")
+	require.ErrorContains(t, err, "no proto_dir set")
+}
+
+// genericCountersJSON is a generic-counters message in the IOS XR JSON
+// encoding, with signed, double and enum leaves and lists of one and two
+// items. Whole doubles are written without fraction.
+const genericCountersJSON = `{"node_id_str":"router-1","subscription_id_str":"interfaces",
+"encoding_path":"Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+"collection_id":1001,"collection_start_time":1678183200000,"msg_timestamp":1678183200000,
+"data_json":[
+{"timestamp":1678183200005,"keys":[{"interface-name":"HundredGigE0/0/0/0"}],
+"content":{"packets-received":4611686018427387904,"bytes-received":12,"carrier-transitions":3,
+"utilization":1,"line-state":"up","queue-drops":[7]}},
+{"timestamp":1678183200005,"keys":[{"interface-name":"HundredGigE0/0/0/1"}],
+"content":{"packets-received":0,"bytes-received":"4611686018427387904","carrier-transitions":-2,
+"utilization":0.5,"line-state":"down","queue-drops":[3,4]}}
+],"collection_end_time":1678183200010}`
+
+// genericCountersKV returns the kvGPB encoding of genericCountersJSON.
+func genericCountersKV() *telemetry_bis.Telemetry {
+	row := func(name string, packets, bytes uint64, transitions int32, utilization float64, state string, drops ...uint32) *telemetry_bis.TelemetryField {
+		content := &telemetry_bis.TelemetryField{Name: "content", Fields: []*telemetry_bis.TelemetryField{
+			uint64Field("packets-received", packets),
+			uint64Field("bytes-received", bytes),
+			{Name: "carrier-transitions", ValueByType: &telemetry_bis.TelemetryField_Sint32Value{Sint32Value: transitions}},
+			{Name: "utilization", ValueByType: &telemetry_bis.TelemetryField_DoubleValue{DoubleValue: utilization}},
+			stringField("line-state", state),
+		}}
+		for _, d := range drops {
+			content.Fields = append(content.Fields, &telemetry_bis.TelemetryField{
+				Name:        "queue-drops",
+				ValueByType: &telemetry_bis.TelemetryField_Uint32Value{Uint32Value: d},
+			})
+		}
+		return &telemetry_bis.TelemetryField{
+			Timestamp: 1678183200005,
+			Fields: []*telemetry_bis.TelemetryField{
+				{Name: "keys", Fields: []*telemetry_bis.TelemetryField{stringField("interface-name", name)}},
+				content,
+			},
+		}
+	}
+
+	msg := interfaceCounters(0)
+	msg.DataGpbkv = []*telemetry_bis.TelemetryField{
+		row("HundredGigE0/0/0/0", 1<<62, 12, 3, 1, "up", 7),
+		row("HundredGigE0/0/0/1", 0, 1<<62, -2, 0.5, "down", 3, 4),
+	}
+	return msg
+}
+
+func TestDecodeJSON(t *testing.T) {
+	data, err := proto.Marshal(genericCountersKV())
+	require.NoError(t, err)
+	expected, err := Decode(data, "10.0.0.1:57500")
+	require.NoError(t, err)
+
+	// The leaves are typed by the model of the encoding path
+	decoder, err := NewDecoder(writeGenericCountersModel(t))
+	require.NoError(t, err)
+	m, err := decoder.Decode([]byte(genericCountersJSON), "10.0.0.1:57500")
+	require.NoError(t, err)
+	require.Equal(t, expected.(*metric).Rows, m.(*metric).Rows)
+	require.Equal(t, expected.(*metric).Series(), m.(*metric).Series())
+
+	series := m.(*metric).Series()
+	require.Equal(t, map[string]any{
+		"packets-received":    uint64(1 << 62),
+		"bytes-received":      uint64(12),
+		"carrier-transitions": int64(3),
+		"utilization":         float64(1),
+		"line-state":          "up",
+		"queue-drops":         uint64(7),
+	}, series[0].Fields)
+
+	// Without model integers are int64
+	m, err = Decode([]byte(genericCountersJSON), "10.0.0.1:57500")
+	require.NoError(t, err)
+	series = m.(*metric).Series()
+	require.Equal(t, map[string]any{
+		"packets-received":    int64(1 << 62),
+		"bytes-received":      int64(12),
+		"carrier-transitions": int64(3),
+		"utilization":         int64(1),
+		"line-state":          "up",
+		"queue-drops":         int64(7),
+	}, series[0].Fields)
+}
+
+func TestTCPDialoutEncapsulation(t *testing.T) {
+	c := NewCiscoTelemetryMDT()
+	c.Transport = "tcp"
+	c.ServiceAddress = "127.0.0.1:0"
+	c.ProtoDir = writeGenericCountersModel(t)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, c.Start(acc))
+	defer c.Stop()
+
+	conn, err := net.Dial("tcp", c.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	gpb, err := proto.Marshal(genericCountersKV())
+	require.NoError(t, err)
+	for _, frame := range []struct {
+		encap   uint16
+		payload []byte
+	}{
+		{encapGPBKV, gpb},
+		{encapJSON, []byte(genericCountersJSON)},
+	} {
+		hdr := []uint16{1, frame.encap, 1, 0}
+		require.NoError(t, binary.Write(conn, binary.BigEndian, hdr))
+		require.NoError(t, binary.Write(conn, binary.BigEndian, uint32(len(frame.payload))))
+		_, err := conn.Write(frame.payload)
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool { return acc.Count() == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, acc.Errors())
+	require.Equal(t, acc.Metrics()[0].(*metric).Series(), acc.Metrics()[1].(*metric).Series())
+}
+
+// writeCertificates writes a CA and the certificate and key of a server
+// and of clients named after dnsNames, all signed by the CA, to dir.
+func TestTCPDialoutTLS(t *testing.T) {
+	dir := t.TempDir()
+	testutil.WriteCertificates(t, dir, "server", "router-1.example.com", "router-2.example.com")
+
+	c := NewCiscoTelemetryMDT()
+	c.Transport = "tcp"
+	c.ServiceAddress = "127.0.0.1:0"
+	c.TLSCert = filepath.Join(dir, "server.pem")
+	c.TLSKey = filepath.Join(dir, "server.key")
+	c.TLSAllowedCACerts = []string{filepath.Join(dir, "ca.pem")}
+	c.TLSAllowedDNSNames = []string{"router-1.example.com"}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, c.Start(acc))
+	defer c.Stop()
+
+	payload, err := proto.Marshal(interfaceCounters(1))
+	require.NoError(t, err)
+	dial := func(client string) net.Conn {
+		tlsConfig, err := (&interTLS.ClientConfig{
+			TLSCA:   filepath.Join(dir, "ca.pem"),
+			TLSCert: filepath.Join(dir, client+".pem"),
+			TLSKey:  filepath.Join(dir, client+".key"),
+		}).TLSConfig()
+		require.NoError(t, err)
+
+		conn, err := tls.Dial("tcp", c.listener.Addr().String(), tlsConfig)
+		require.NoError(t, err)
+		require.NoError(t, binary.Write(conn, binary.BigEndian, []uint16{1, encapGPBKV, 1, 0}))
+		require.NoError(t, binary.Write(conn, binary.BigEndian, uint32(len(payload))))
+		_, err = conn.Write(payload)
+		require.NoError(t, err)
+		return conn
+	}
+
+	conn := dial("router-1.example.com")
+	defer conn.Close()
+	require.Eventually(t, func() bool { return acc.Count() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// The certificate of the second router is not allowed, the connection
+	// is closed without reading the message
+	rejected := dial("router-2.example.com")
+	defer rejected.Close()
+	_, err = rejected.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.Equal(t, 1, acc.Count())
+}
+
+func TestTCPDialoutLimits(t *testing.T) {
+	c := NewCiscoTelemetryMDT()
+	c.Transport = "tcp"
+	c.ServiceAddress = "127.0.0.1:0"
+	c.AllowedSources = []string{"127.0.0.0/8"}
+	c.MaxConnectionsPerSource = 1
+	c.IdleTimeout = internal.Duration(200 * time.Millisecond)
+	acc := &testutil.Accumulator{}
+	require.NoError(t, c.Start(acc))
+	defer c.Stop()
+
+	payload, err := proto.Marshal(interfaceCounters(1))
+	require.NoError(t, err)
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", c.listener.Addr().String())
+		require.NoError(t, err)
+		require.NoError(t, binary.Write(conn, binary.BigEndian, []uint16{1, encapGPBKV, 1, 0}))
+		require.NoError(t, binary.Write(conn, binary.BigEndian, uint32(len(payload))))
+		_, err = conn.Write(payload)
+		require.NoError(t, err)
+		return conn
+	}
+	closed := func(conn net.Conn) {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		_, err := conn.Read(make([]byte, 1))
+		require.Error(t, err)
+		require.False(t, errors.Is(err, os.ErrDeadlineExceeded))
+	}
+
+	conn := dial()
+	defer conn.Close()
+	require.Eventually(t, func() bool { return acc.Count() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// The source has no connection left
+	rejected := dial()
+	defer rejected.Close()
+	closed(rejected)
+
+	// The first connection sends nothing more and is closed once idle,
+	// which frees the connection of the source
+	closed(conn)
+	conn = dial()
+	defer conn.Close()
+	require.Eventually(t, func() bool { return acc.Count() == 2 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDialoutAllowedSources(t *testing.T) {
+	c := NewCiscoTelemetryMDT()
+	c.Transport = "grpc"
+	c.ServiceAddress = "127.0.0.1:0"
+	c.AllowedSources = []string{"10.0.0.0/8"}
+	acc := &testutil.Accumulator{}
+	require.NoError(t, c.Start(acc))
+	defer c.Stop()
+
+	conn, err := net.Dial("tcp", c.listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	require.Error(t, err)
+	require.False(t, errors.Is(err, os.ErrDeadlineExceeded))
+
+	c = NewCiscoTelemetryMDT()
+	c.Transport = "grpc"
+	c.AllowedSources = []string{"10.0.0.1"}
+	require.Error(t, c.Start(acc))
+}
+
+func TestGNMIDialout(t *testing.T) {
+	c := NewCiscoTelemetryMDT()
+	c.Transport = "grpc"
+	c.ServiceAddress = "127.0.0.1:0"
+	acc := &testutil.Accumulator{}
+	require.NoError(t, c.Start(acc))
+	defer c.Stop()
+
+	conn, err := grpc.Dial(c.listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "system-name", "sr-1", "subscription-name", "ports")
+	stream, err := conn.NewStream(ctx, &gnmiDialoutServiceDesc.Streams[0], "/Nokia.SROS.DialoutTelemetry/Publish")
+	require.NoError(t, err)
+
+	path, err := gnmi.ParsePath("/state/port[port-id=1/1/1]/statistics/in-octets")
+	require.NoError(t, err)
+	responses := []*gnmipb.SubscribeResponse{
+		{Response: &gnmipb.SubscribeResponse_Update{Update: &gnmipb.Notification{
+			Timestamp: 1678183200000000000,
+			Update:    []*gnmipb.Update{{Path: path, Val: &gnmipb.TypedValue{Value: &gnmipb.TypedValue_UintVal{UintVal: 42}}}},
+		}}},
+		{Response: &gnmipb.SubscribeResponse_SyncResponse{SyncResponse: true}},
+	}
+	for _, response := range responses {
+		require.NoError(t, stream.SendMsg(response))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	require.Eventually(t, func() bool { return acc.Count() == 1 }, 5*time.Second, 10*time.Millisecond)
+	series := acc.Metrics()[0].(models.SeriesMetric).Series()
+	require.Len(t, series, 1)
+	require.Equal(t, "/state/port/statistics", series[0].Name)
+	require.Equal(t, map[string]string{
+		"source":       "127.0.0.1",
+		"node_id":      "sr-1",
+		"subscription": "ports",
+		"port-id":      "1/1/1",
+	}, series[0].Tags)
+	require.Equal(t, map[string]any{"in-octets": uint64(42)}, series[0].Fields)
+}
@@ -0,0 +1,87 @@
+package cisco_telemetry_mdt
+
+import (
+	"io"
+	"net"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"telemetry/models"
+)
+
+// gnmiDialoutServer is the gNMI dial-out service pushed to by Nokia SR OS,
+// devices publish the responses of their configured subscriptions:
+//
+//	service DialoutTelemetry {
+//	  rpc Publish(stream gnmi.SubscribeResponse) returns (stream PublishResponse);
+//	}
+type gnmiDialoutServer interface {
+	Publish(stream grpc.ServerStream) error
+}
+
+var gnmiDialoutServiceDesc = grpc.ServiceDesc{
+	ServiceName: "Nokia.SROS.DialoutTelemetry",
+	HandlerType: (*gnmiDialoutServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Publish",
+		Handler:       publishHandler,
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+	Metadata: "sros_dialout.proto",
+}
+
+func publishHandler(srv any, stream grpc.ServerStream) error {
+	return srv.(gnmiDialoutServer).Publish(stream)
+}
+
+// Publish RPC server method for gNMI dial-out, the notifications are named
+// after their path and tagged with the keys of the path.
+func (c *CiscoTelemetryMDT) Publish(stream grpc.ServerStream) error {
+	tags := make(map[string]string)
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		c.log.Infof("Accepted gNMI dialout connection from %s", p.Addr)
+		defer c.log.Infof("Closed gNMI dialout connection from %s", p.Addr)
+
+		source := p.Addr.String()
+		if host, _, err := net.SplitHostPort(source); err == nil {
+			source = host
+		}
+		tags["source"] = source
+	}
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		if v := md.Get("system-name"); len(v) > 0 && v[0] != "" {
+			tags["node_id"] = v[0]
+		}
+		if v := md.Get("subscription-name"); len(v) > 0 && v[0] != "" {
+			tags["subscription"] = v[0]
+		}
+	}
+
+	for {
+		var response gnmipb.SubscribeResponse
+		if err := stream.RecvMsg(&response); err != nil {
+			if err != io.EOF {
+				c.log.Errorf("gNMI dialout receive error: %v", err)
+			}
+			return nil
+		}
+
+		notification := response.GetUpdate()
+		if notification == nil {
+			// Sync responses only mark the end of the initial updates
+			continue
+		}
+		series, err := c.gnmiDecoder.Series(notification, tags)
+		if err != nil {
+			c.log.Errorf("decoding gNMI notification failed: %v", err)
+			continue
+		}
+		if len(series) > 0 {
+			c.acc.AddMetric(models.NewSeriesMetric(series...))
+		}
+	}
+}
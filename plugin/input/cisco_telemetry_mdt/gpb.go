@@ -0,0 +1,202 @@
+package cisco_telemetry_mdt
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cisco-ie/nx-telemetry-proto/telemetry_bis"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"telemetry/plugin/common/protobuf"
+)
+
+// keysSuffix is the suffix of the keys message of IOS XR compact GPB models
+const keysSuffix = "_KEYS"
+
+// yangWalker returns the values of messages by their YANG name, the field
+// name with "_" replaced by "-", like in kvGPB.
+var yangWalker = protobuf.Walker{
+	Name: func(fd protoreflect.FieldDescriptor) string {
+		return strings.ReplaceAll(string(fd.Name()), "_", "-")
+	},
+}
+
+// gpbMessages are the keys and content messages of an encoding path.
+type gpbMessages struct {
+	keys    protoreflect.MessageDescriptor
+	content protoreflect.MessageDescriptor
+}
+
+// gpbRegistry holds the messages of the compact GPB models by package. The
+// IOS XR models declare a package named after the encoding path, such as
+// cisco_ios_xr_infra_statsd_oper.infra_statistics.interfaces.interface.latest.generic_counters
+// holding the ifstatsbag_generic_KEYS and ifstatsbag_generic messages.
+type gpbRegistry struct {
+	packages map[string]gpbMessages
+}
+
+// loadGPBRegistry loads the models of a directory, from compiled
+// FileDescriptorSets (.pb, .protoset and .desc files built with
+// --include_imports) and from .proto files imported relative to the
+// directory.
+func loadGPBRegistry(dir string) (*gpbRegistry, error) {
+	r := &gpbRegistry{packages: make(map[string]gpbMessages)}
+
+	var protoFiles []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch filepath.Ext(p) {
+		case ".pb", ".protoset", ".desc":
+			return r.loadDescriptorSet(p)
+		case ".proto":
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				return err
+			}
+			protoFiles = append(protoFiles, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(protoFiles) > 0 {
+		set, err := protobuf.ParseSet(protoparse.Parser{ImportPaths: []string{dir}}, protoFiles...)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proto files failed: %v", err)
+		}
+		if err := r.addSet(set); err != nil {
+			return nil, fmt.Errorf("loading proto files failed: %v", err)
+		}
+	}
+	return r, nil
+}
+
+func (r *gpbRegistry) loadDescriptorSet(filename string) error {
+	buf, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(buf, &set); err != nil {
+		return fmt.Errorf("reading descriptor set %s failed: %v", filename, err)
+	}
+	if err := r.addSet(&set); err != nil {
+		return fmt.Errorf("loading descriptor set %s failed: %v", filename, err)
+	}
+	return nil
+}
+
+func (r *gpbRegistry) addSet(set *descriptorpb.FileDescriptorSet) error {
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return err
+	}
+	files.RangeFiles(func(f protoreflect.FileDescriptor) bool {
+		r.addFile(f)
+		return true
+	})
+	return nil
+}
+
+// addFile registers the keys and content messages of a file, a file is a
+// model when it holds a message with the "_KEYS" suffix.
+func (r *gpbRegistry) addFile(f protoreflect.FileDescriptor) {
+	messages := f.Messages()
+	for i := 0; i < messages.Len(); i++ {
+		keys := messages.Get(i)
+		name := string(keys.Name())
+		if !strings.HasSuffix(name, keysSuffix) {
+			continue
+		}
+		content := messages.ByName(protoreflect.Name(strings.TrimSuffix(name, keysSuffix)))
+		if content == nil {
+			continue
+		}
+
+		m := gpbMessages{keys: keys, content: content}
+		r.packages[string(f.Package())] = m
+		// The proto path, the directory of the file, names the package as well
+		if dir := path.Dir(f.Path()); dir != "." {
+			r.packages[strings.ReplaceAll(dir, "/", ".")] = m
+		}
+	}
+}
+
+// lookup returns the messages of an encoding path.
+func (r *gpbRegistry) lookup(encodingPath string) (gpbMessages, bool) {
+	m, ok := r.packages[packageName(encodingPath)]
+	return m, ok
+}
+
+// packageName returns the package of the model of an encoding path, with
+// the naming of the IOS XR models.
+func packageName(encodingPath string) string {
+	return strings.NewReplacer("-", "_", ":", ".", "/", ".").Replace(strings.ToLower(encodingPath))
+}
+
+// parseGPBRows adds the rows of the compact GPB data of a message, decoded
+// into the same keys and content structure as kvGPB rows.
+func (m *metric) parseGPBRows(r *gpbRegistry, table *telemetry_bis.TelemetryGPBTable) error {
+	encodingPath, _ := m.Telemetry["encoding_path"].(string)
+	messages, ok := r.lookup(encodingPath)
+	if !ok {
+		return fmt.Errorf("no model for encoding path %q", encodingPath)
+	}
+
+	for _, gpbRow := range table.Row {
+		keys := dynamicpb.NewMessage(messages.keys)
+		if err := proto.Unmarshal(gpbRow.Keys, keys); err != nil {
+			return fmt.Errorf("decoding keys failed: %v", err)
+		}
+		content := dynamicpb.NewMessage(messages.content)
+		if err := proto.Unmarshal(gpbRow.Content, content); err != nil {
+			return fmt.Errorf("decoding content failed: %v", err)
+		}
+		m.Rows = append(m.Rows, row{
+			Timestamp: gpbRow.Timestamp,
+			Keys:      kvLists(yangWalker.MessageValues(keys)),
+			Content:   kvLists(yangWalker.MessageValues(content)),
+		})
+	}
+	return nil
+}
+
+// kvLists returns values with their lists named like the repeated fields of
+// kvGPB rows by parseFields: a list of several items is named with the
+// "_arr" suffix and a single item is not in a list.
+func kvLists(values map[string]any) map[string]any {
+	named := make(map[string]any, len(values))
+	for k, v := range values {
+		switch v := v.(type) {
+		case map[string]any:
+			named[k] = kvLists(v)
+		case []any:
+			for i, item := range v {
+				if m, ok := item.(map[string]any); ok {
+					v[i] = kvLists(m)
+				}
+			}
+			if len(v) == 1 {
+				named[k] = v[0]
+			} else {
+				named[k+"_arr"] = v
+			}
+		default:
+			named[k] = v
+		}
+	}
+	return named
+}
@@ -0,0 +1,118 @@
+package cisco_telemetry_mdt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cisco-ie/nx-telemetry-proto/telemetry_bis"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"telemetry/internal"
+)
+
+// jsonTelemetry is the JSON encoding of a telemetry message. IOS XR sends
+// its rows in data_json, NX-OS sends the output of the command in data.
+type jsonTelemetry struct {
+	NodeIDStr           string              `json:"node_id_str"`
+	SubscriptionIDStr   string              `json:"subscription_id_str"`
+	EncodingPath        string              `json:"encoding_path"`
+	CollectionID        internal.JSONUint64 `json:"collection_id"`
+	CollectionStartTime internal.JSONUint64 `json:"collection_start_time"`
+	MsgTimestamp        internal.JSONUint64 `json:"msg_timestamp"`
+	CollectionEndTime   internal.JSONUint64 `json:"collection_end_time"`
+	DataJSON            []jsonRow           `json:"data_json"`
+	Data                any                 `json:"data"`
+}
+
+type jsonRow struct {
+	Timestamp internal.JSONUint64 `json:"timestamp"`
+	Keys      any                 `json:"keys"`
+	Content   any                 `json:"content"`
+}
+
+// isJSON tells whether a payload without encapsulation is JSON encoded,
+// a telemetry protobuf message never starts with '{'.
+func isJSON(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == '{'
+}
+
+// parseJSON sets the header and rows of a JSON encoded message, they are
+// the same as the ones of the GPB encoding of the message. JSON does not
+// tell the type of numbers, the leaves have the types of the model of the
+// encoding path when registry holds it, otherwise the ones given by
+// internal.ConvertJSONNumbers.
+func (m *metric) parseJSON(registry *gpbRegistry, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var msg jsonTelemetry
+	if err := decoder.Decode(&msg); err != nil {
+		return err
+	}
+
+	m.parseHeader(&telemetry_bis.Telemetry{
+		NodeId:              &telemetry_bis.Telemetry_NodeIdStr{NodeIdStr: msg.NodeIDStr},
+		Subscription:        &telemetry_bis.Telemetry_SubscriptionIdStr{SubscriptionIdStr: msg.SubscriptionIDStr},
+		EncodingPath:        msg.EncodingPath,
+		CollectionId:        uint64(msg.CollectionID),
+		CollectionStartTime: uint64(msg.CollectionStartTime),
+		MsgTimestamp:        uint64(msg.MsgTimestamp),
+		CollectionEndTime:   uint64(msg.CollectionEndTime),
+	})
+
+	var messages gpbMessages
+	if registry != nil {
+		messages, _ = registry.lookup(msg.EncodingPath)
+	}
+	for _, r := range msg.DataJSON {
+		if r.Content == nil {
+			return fmt.Errorf("no field named content")
+		}
+		if r.Keys == nil {
+			return fmt.Errorf("no field named keys")
+		}
+		m.Rows = append(m.Rows, row{
+			Timestamp: uint64(r.Timestamp),
+			Keys:      jsonRowValues(jsonKeys(r.Keys), messages.keys),
+			Content:   jsonRowValues(r.Content, messages.content),
+		})
+	}
+	if msg.Data != nil {
+		m.Rows = append(m.Rows, row{Keys: map[string]any{}, Content: jsonRowValues(msg.Data, nil)})
+	}
+	return nil
+}
+
+// jsonKeys returns the keys of a row, IOS XR sends them as a list of
+// objects holding one key each.
+func jsonKeys(keys any) any {
+	list, ok := keys.([]any)
+	if !ok {
+		return keys
+	}
+	merged := make(map[string]any, len(list))
+	for _, item := range list {
+		if values, ok := item.(map[string]any); ok {
+			for k, v := range values {
+				merged[k] = v
+			}
+		}
+	}
+	return merged
+}
+
+// jsonRowValues returns the keys or the content of a row typed by their
+// message when known, with their lists named like in kvGPB rows.
+func jsonRowValues(value any, md protoreflect.MessageDescriptor) any {
+	values, ok := value.(map[string]any)
+	if !ok {
+		return internal.ConvertJSONNumbers(value)
+	}
+	if md != nil {
+		return kvLists(yangWalker.JSONValues(values, md))
+	}
+	internal.ConvertJSONNumbers(values)
+	return kvLists(values)
+}
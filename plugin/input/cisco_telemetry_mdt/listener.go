@@ -0,0 +1,134 @@
+package cisco_telemetry_mdt
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sourceListener accepts the dialout connections of the allowed sources
+// within the connection limits, the other connections are closed right
+// away. It serves both transports, before any TLS handshake.
+type sourceListener struct {
+	net.Listener
+
+	allowed        []*net.IPNet
+	maxConnections int
+	maxPerSource   int
+	idleTimeout    time.Duration
+	log            *logrus.Entry
+
+	mutex       sync.Mutex
+	connections int
+	sources     map[string]int
+}
+
+// parseSources returns the networks of CIDRs such as 10.0.0.0/8.
+func parseSources(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed source %q: %v", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (l *sourceListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		source := conn.RemoteAddr().String()
+		if host, _, err := net.SplitHostPort(source); err == nil {
+			source = host
+		}
+		if err := l.admit(source); err != nil {
+			l.log.Warnf("Rejected Cisco MDT dialout connection from %s: %v", conn.RemoteAddr(), err)
+			//nolint:errcheck,revive // the connection is rejected anyway
+			_ = conn.Close()
+			continue
+		}
+		return &sourceConn{Conn: conn, listener: l, source: source}, nil
+	}
+}
+
+// admit counts a connection of a source, unless the source is not allowed
+// or has no connection left.
+func (l *sourceListener) admit(source string) error {
+	if len(l.allowed) > 0 && !l.isAllowed(net.ParseIP(source)) {
+		return errors.New("source not allowed")
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.maxConnections > 0 && l.connections >= l.maxConnections {
+		return fmt.Errorf("too many connections, %d open", l.connections)
+	}
+	if l.maxPerSource > 0 && l.sources[source] >= l.maxPerSource {
+		return fmt.Errorf("too many connections of the source, %d open", l.sources[source])
+	}
+	l.connections++
+	l.sources[source]++
+	return nil
+}
+
+func (l *sourceListener) isAllowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range l.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *sourceListener) release(source string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.connections--
+	if l.sources[source]--; l.sources[source] <= 0 {
+		delete(l.sources, source)
+	}
+}
+
+// sourceConn is an accepted dialout connection. Reads time out once the
+// device sent nothing for the idle timeout, which closes the session.
+type sourceConn struct {
+	net.Conn
+
+	listener *sourceListener
+	source   string
+	once     sync.Once
+}
+
+func (c *sourceConn) Read(b []byte) (int, error) {
+	timeout := c.listener.idleTimeout
+	if timeout <= 0 {
+		return c.Conn.Read(b)
+	}
+	if err := c.Conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+	n, err := c.Conn.Read(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		c.listener.log.Infof("Closing Cisco MDT dialout connection from %s idle for %s", c.RemoteAddr(), timeout)
+	}
+	return n, err
+}
+
+func (c *sourceConn) Close() error {
+	c.once.Do(func() { c.listener.release(c.source) })
+	return c.Conn.Close()
+}
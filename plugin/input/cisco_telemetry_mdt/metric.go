@@ -1,15 +1,20 @@
 package cisco_telemetry_mdt
 
 import (
+	"encoding/base64"
 	"fmt"
+	"net"
 	"strings"
+	"time"
+
+	"github.com/cisco-ie/nx-telemetry-proto/telemetry_bis"
 
 	"telemetry/internal"
 	"telemetry/models"
 )
 
 type row struct {
-	Timestamp float64
+	Timestamp uint64
 	Content   any
 	Keys      any
 }
@@ -18,6 +23,11 @@ type metric struct {
 	Rows      []row
 	Telemetry map[string]any
 	Source    string
+
+	// Tags are added to the tags of all series, such as the Kafka topic.
+	Tags map[string]string `json:",omitempty"`
+
+	naming *naming
 }
 
 func NewCiscoTelemetryMetric(sourceIP string) *metric {
@@ -35,6 +45,7 @@ func (m *metric) Copy() models.Metric {
 		Rows:      make([]row, len(m.Rows)),
 		Telemetry: make(map[string]any, len(m.Telemetry)),
 		Source:    m.Source,
+		naming:    m.naming,
 	}
 
 	for i, r := range m.Rows {
@@ -42,219 +53,289 @@ func (m *metric) Copy() models.Metric {
 	}
 
 	m2.Telemetry = internal.DeepCopy(m.Telemetry).(map[string]any)
+	if m.Tags != nil {
+		m2.Tags = make(map[string]string, len(m.Tags))
+		for k, v := range m.Tags {
+			m2.Tags[k] = v
+		}
+	}
 
 	return m2
 }
 
-func (m *metric) parseRow(value any) error {
-	for _, arr := range value.([]interface{}) {
-		var r row
-		data := arr.(map[string]interface{})
-		if data[GBPVALUE] == nil && data[GBPFIELDS] != nil {
-			if data["timestamp"] != nil {
-				r.Timestamp = data["timestamp"].(float64)
-			}
-			field := m.parseFields(data[GBPFIELDS])
-			if _, ok := field["content"]; ok {
-				r.Content = field["content"]
-			} else {
-				return fmt.Errorf("no field named rows")
-			}
-			if _, ok := field["keys"]; ok {
-				r.Keys = field["keys"]
-			} else {
-				return fmt.Errorf("no field named keys")
-			}
-			m.Rows = append(m.Rows, r)
-		}
+// Series returns one series per row named after the encoding path, row keys
+// and the telemetry header identifiers are used as tags and the remaining
+// telemetry header values as series header. The entries of nested lists
+// holding embedded tags make series of their own.
+func (m *metric) Series() []models.Series {
+	header := m.header()
+	series := make([]models.Series, 0, len(m.Rows))
+	for _, r := range m.Rows {
+		series = append(series, m.rowSeries(r, header)...)
 	}
-	return nil
+	return series
 }
 
-func (m *metric) parseFields(v any) map[string]any {
-	s := make(map[string]interface{})
-	placeInArrayMap := map[string]bool{}
-	for _, arr := range v.([]interface{}) {
-		field := arr.(map[string]interface{})
-		var fieldVal interface{}
-		var hint int
-		var key string
-		if field[GBPNAME] == nil && field[GBPFIELDS] != nil {
-			// nx-os every field have a map like this {"": {}}
-			key = Nexus
-		} else {
-			key = field[GBPNAME].(string)
-		}
-		existingEntry, exists := s[key]
-		_, placeInArray := placeInArrayMap[key]
-		_, children := field[GBPFIELDS]
-		if !children {
-			fieldVal = field[GBPVALUE]
-			if fieldVal != nil {
-				for _, value := range fieldVal.(map[string]interface{}) {
-					fieldVal = value
-				}
-			}
-			hint = 10
-		} else {
-			fieldVal = m.parseFields(field[GBPFIELDS])
-			for nilK, nilV := range fieldVal.(map[string]interface{}) {
-				if nilK == Nexus {
-					fieldVal = nilV
-				}
-			}
-			hint = len(field[GBPFIELDS].([]interface{}))
-		}
+// RowMetrics returns a metric per row holding the series of the row.
+func (m *metric) RowMetrics() []models.Metric {
+	header := m.header()
+	metrics := make([]models.Metric, 0, len(m.Rows))
+	for _, r := range m.Rows {
+		metrics = append(metrics, models.NewSeriesMetric(m.rowSeries(r, header)...))
+	}
+	return metrics
+}
 
-		if !placeInArray && !exists {
-			// this is the common case by far!
-			s[key] = fieldVal
-		} else {
-			newName := key + "_arr"
-			if exists {
-				if !placeInArray {
-					// Create list
-					s[newName] = make([]interface{}, 0, hint)
-					// Remember that this field name is arrayified(!?)
-					placeInArrayMap[key] = true
-					// Add existing entry to new array)
-					s[newName] = append(s[newName].([]interface{}), existingEntry)
-					// Delete existing entry from old
-					delete(s, key)
-					placeInArray = true
-				}
-			}
-			if placeInArray && fieldVal != nil {
-				s[newName] = append(s[newName].([]interface{}), fieldVal)
+func (m *metric) header() map[string]any {
+	header := make(map[string]any)
+	for k, v := range m.Telemetry {
+		switch k {
+		case "encoding_path":
+			// Already used as name, unless the series are renamed
+			if m.naming == nil {
+				continue
 			}
+		case "node_id_str", "subscription_id_str":
+			// Already used as tags
+			continue
+		}
+		switch v.(type) {
+		case map[string]any, []any:
+		default:
+			header[k] = v
 		}
 	}
-	return s
+	return header
 }
 
-func (m *metric) parseTelemetry(key string, value any) {
-	if e, ok := value.(map[string]interface{}); ok {
-		for k, v := range e {
-			k = CamelCaseToUnderscore(k)
-			m.Telemetry[k] = m.decodeValue(v)
-		}
-	} else {
-		key = CamelCaseToUnderscore(key)
-		m.Telemetry[key] = m.decodeValue(value)
+func (m *metric) rowSeries(r row, header map[string]any) []models.Series {
+	path, _ := m.Telemetry["encoding_path"].(string)
+	tm := m.rowTime(r)
+
+	tags := m.headerTags()
+	internal.Flatten("", trimArraySuffix(r.Keys), "_", func(k string, v any) {
+		tags[k] = fmt.Sprint(v)
+	})
+
+	fields, ok := trimArraySuffix(r.Content).(map[string]any)
+	if !ok {
+		fields = map[string]any{"value": r.Content}
+	}
+
+	var embedded []models.Series
+	if m.naming != nil && path != "" {
+		m.naming.embed(path, fields, tags, func(p string, tags map[string]string, fields map[string]any) {
+			embedded = append(embedded, models.Series{
+				Name:   m.naming.name(p),
+				Tags:   tags,
+				Fields: fields,
+				Time:   tm,
+				Header: header,
+			})
+		})
 	}
+
+	name := path
+	if name == "" {
+		name = "cisco_telemetry_mdt"
+	} else if m.naming != nil {
+		name = m.naming.name(path)
+	}
+	series := make([]models.Series, 0, len(embedded)+1)
+	if len(fields) > 0 || len(embedded) == 0 {
+		series = append(series, models.Series{
+			Name:   name,
+			Tags:   tags,
+			Fields: fields,
+			Time:   tm,
+			Header: header,
+		})
+	}
+	return append(series, embedded...)
 }
 
-func CamelCaseToUnderscore(s string) string {
-	data := make([]byte, 0, len(s)*2)
-	j := false
-	num := len(s)
-	for i := 0; i < num; i++ {
-		d := s[i]
-		if i > 0 && d >= 'A' && d <= 'Z' && j {
-			data = append(data, '_')
+func (m *metric) headerTags() map[string]string {
+	tags := make(map[string]string)
+	if m.Source != "" {
+		source := m.Source
+		if host, _, err := net.SplitHostPort(source); err == nil {
+			source = host
 		}
-		if d != '_' {
-			j = true
-		}
-		data = append(data, d)
+		tags["source"] = source
+	}
+	if v, ok := m.Telemetry["node_id_str"].(string); ok && v != "" {
+		tags["node_id"] = v
 	}
-	return strings.ToLower(string(data[:]))
+	if v, ok := m.Telemetry["subscription_id_str"].(string); ok && v != "" {
+		tags["subscription"] = v
+	}
+	for k, v := range m.Tags {
+		tags[k] = v
+	}
+	return tags
 }
 
-func (m *metric) decodeValue(v interface{}) interface{} {
-	switch v := v.(type) {
-	case float64:
-		return v
-	case int64:
-		return v
-	case string:
-		return v
-	case bool:
-		return v
-	case int:
-		return int64(v)
-	case uint:
-		return uint64(v)
-	case uint64:
-		return v
-	case []byte:
-		return string(v)
-	case int32:
-		return int64(v)
-	case int16:
-		return int64(v)
-	case int8:
-		return int64(v)
-	case uint32:
-		return uint64(v)
-	case uint16:
-		return uint64(v)
-	case uint8:
-		return uint64(v)
-	case float32:
-		return float64(v)
-	case *float64:
-		if v != nil {
-			return *v
-		}
-	case *int64:
-		if v != nil {
-			return *v
-		}
-	case *string:
-		if v != nil {
-			return *v
-		}
-	case *bool:
-		if v != nil {
-			return *v
-		}
-	case *int:
-		if v != nil {
-			return int64(*v)
-		}
-	case *uint:
-		if v != nil {
-			return uint64(*v)
+// AddTag adds a tag to all series of the metric.
+func (m *metric) AddTag(key, value string) {
+	if m.Tags == nil {
+		m.Tags = make(map[string]string)
+	}
+	m.Tags[key] = value
+}
+
+// rowTime returns the row timestamp, falling back to the message timestamp.
+// Both are milliseconds since epoch.
+func (m *metric) rowTime(r row) time.Time {
+	if r.Timestamp > 0 {
+		return time.UnixMilli(int64(r.Timestamp))
+	}
+	if ts, ok := m.Telemetry["msg_timestamp"].(uint64); ok && ts > 0 {
+		return time.UnixMilli(int64(ts))
+	}
+	return time.Now()
+}
+
+// trimArraySuffix returns a copy of value where the "_arr" suffix added by
+// parseFields to repeated field names is removed.
+func trimArraySuffix(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[strings.TrimSuffix(k, "_arr")] = trimArraySuffix(item)
 		}
-	case *uint64:
-		if v != nil {
-			return *v
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = trimArraySuffix(item)
 		}
-	case *[]byte:
-		if v != nil {
-			return string(*v)
+		return out
+	}
+	return value
+}
+
+// parseHeader sets the header values of a message, empty values are left
+// out.
+func (m *metric) parseHeader(msg *telemetry_bis.Telemetry) {
+	if v := msg.GetNodeIdStr(); v != "" {
+		m.Telemetry["node_id_str"] = v
+	}
+	if v := msg.GetSubscriptionIdStr(); v != "" {
+		m.Telemetry["subscription_id_str"] = v
+	}
+	if msg.EncodingPath != "" {
+		m.Telemetry["encoding_path"] = msg.EncodingPath
+	}
+
+	counters := []struct {
+		name  string
+		value uint64
+	}{
+		{"collection_id", msg.CollectionId},
+		{"collection_start_time", msg.CollectionStartTime},
+		{"msg_timestamp", msg.MsgTimestamp},
+		{"collection_end_time", msg.CollectionEndTime},
+	}
+	for _, c := range counters {
+		if c.value != 0 {
+			m.Telemetry[c.name] = c.value
 		}
-	case *int32:
-		if v != nil {
-			return int64(*v)
+	}
+}
+
+// parseRows adds the rows of the kvGPB data of a message, a row is a field
+// without value holding "keys" and "content" fields.
+func (m *metric) parseRows(fields []*telemetry_bis.TelemetryField) error {
+	for _, field := range fields {
+		if field.ValueByType != nil || len(field.Fields) == 0 {
+			continue
 		}
-	case *int16:
-		if v != nil {
-			return int64(*v)
+
+		values := parseFields(field.Fields)
+		content, ok := values["content"]
+		if !ok {
+			return fmt.Errorf("no field named content")
 		}
-	case *int8:
-		if v != nil {
-			return int64(*v)
+		keys, ok := values["keys"]
+		if !ok {
+			return fmt.Errorf("no field named keys")
 		}
-	case *uint32:
-		if v != nil {
-			return uint64(*v)
+		m.Rows = append(m.Rows, row{Timestamp: field.Timestamp, Content: content, Keys: keys})
+	}
+	return nil
+}
+
+// parseFields returns the values of kvGPB fields by name. Fields repeated
+// under the same name, such as the entries of YANG lists, are gathered in a
+// slice named with an "_arr" suffix. NX-OS wraps values in fields without
+// name, they are unwrapped.
+func parseFields(fields []*telemetry_bis.TelemetryField) map[string]any {
+	values := make(map[string]any, len(fields))
+	var arrays map[string]bool
+	for _, field := range fields {
+		key := field.Name
+		var value any
+		if len(field.Fields) == 0 {
+			value = fieldValue(field)
+		} else {
+			if key == "" {
+				key = Nexus
+			}
+			children := parseFields(field.Fields)
+			if v, ok := children[Nexus]; ok {
+				value = v
+			} else {
+				value = children
+			}
 		}
-	case *uint16:
-		if v != nil {
-			return uint64(*v)
+
+		existing, exists := values[key]
+		if !exists && !arrays[key] {
+			// this is the common case by far!
+			values[key] = value
+			continue
 		}
-	case *uint8:
-		if v != nil {
-			return uint64(*v)
+
+		arrayKey := key + "_arr"
+		if exists {
+			if arrays == nil {
+				arrays = make(map[string]bool)
+			}
+			arrays[key] = true
+			values[arrayKey] = []any{existing}
+			delete(values, key)
 		}
-	case *float32:
-		if v != nil {
-			return float64(*v)
+		if value != nil {
+			values[arrayKey] = append(values[arrayKey].([]any), value)
 		}
-	default:
-		return nil
+	}
+	return values
+}
+
+// fieldValue returns the value of a kvGPB leaf as int64, uint64, float64,
+// bool or string. Bytes are base64 encoded as in the JSON encoding of the
+// message.
+func fieldValue(field *telemetry_bis.TelemetryField) any {
+	switch v := field.ValueByType.(type) {
+	case *telemetry_bis.TelemetryField_StringValue:
+		return v.StringValue
+	case *telemetry_bis.TelemetryField_BoolValue:
+		return v.BoolValue
+	case *telemetry_bis.TelemetryField_Uint32Value:
+		return uint64(v.Uint32Value)
+	case *telemetry_bis.TelemetryField_Uint64Value:
+		return v.Uint64Value
+	case *telemetry_bis.TelemetryField_Sint32Value:
+		return int64(v.Sint32Value)
+	case *telemetry_bis.TelemetryField_Sint64Value:
+		return v.Sint64Value
+	case *telemetry_bis.TelemetryField_DoubleValue:
+		return v.DoubleValue
+	case *telemetry_bis.TelemetryField_FloatValue:
+		return float64(v.FloatValue)
+	case *telemetry_bis.TelemetryField_BytesValue:
+		return base64.StdEncoding.EncodeToString(v.BytesValue)
 	}
 	return nil
 }
@@ -0,0 +1,137 @@
+package cisco_telemetry_mdt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// naming names the series of the rows after the aliases of their encoding
+// path, and promotes the embedded keys of nested lists to tags.
+type naming struct {
+	aliases  []alias
+	embedded map[string]bool
+}
+
+type alias struct {
+	path string
+	name string
+}
+
+// newNaming returns the naming of aliases, a map of encoding path to name,
+// and of embedded tags, the paths of keys within the content of rows such
+// as <encoding path>/class-stats/class-name.
+func newNaming(aliases map[string]string, embeddedTags []string) *naming {
+	n := &naming{embedded: make(map[string]bool, len(embeddedTags))}
+	for path, name := range aliases {
+		n.aliases = append(n.aliases, alias{path: strings.TrimSuffix(path, "/"), name: name})
+	}
+	// The longest path matches first
+	sort.Slice(n.aliases, func(i, j int) bool {
+		return len(n.aliases[i].path) > len(n.aliases[j].path)
+	})
+	for _, path := range embeddedTags {
+		n.embedded[strings.TrimSuffix(path, "/")] = true
+	}
+	return n
+}
+
+// name returns the series name of a path. A path under an aliased path is
+// named after the alias followed by the rest of the path.
+func (n *naming) name(path string) string {
+	for _, a := range n.aliases {
+		if path == a.path {
+			return a.name
+		}
+		if strings.HasPrefix(path, a.path+"/") {
+			return a.name + path[len(a.path):]
+		}
+	}
+	return path
+}
+
+// embed moves the nested lists of fields whose entries hold an embedded
+// tag out of fields. Each entry is added as series named after the path of
+// the list, tagged with tags and its embedded keys. Containers are searched
+// for lists too.
+func (n *naming) embed(path string, fields map[string]any, tags map[string]string,
+	add func(path string, tags map[string]string, fields map[string]any)) {
+	for k, v := range fields {
+		p := path + "/" + k
+
+		var entries []any
+		switch v := v.(type) {
+		case []any:
+			entries = v
+		case map[string]any:
+			if !n.hasEmbedded(p, v) {
+				n.embed(p, v, tags, add)
+				if len(v) == 0 {
+					delete(fields, k)
+				}
+				continue
+			}
+			entries = []any{v}
+		default:
+			continue
+		}
+
+		found := false
+		for _, entry := range entries {
+			if e, ok := entry.(map[string]any); ok && n.hasEmbedded(p, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		delete(fields, k)
+
+		for _, entry := range entries {
+			e, ok := entry.(map[string]any)
+			if !ok {
+				continue
+			}
+			entryTags := make(map[string]string, len(tags)+1)
+			for tk, tv := range tags {
+				entryTags[tk] = tv
+			}
+			entryFields := make(map[string]any, len(e))
+			for ek, ev := range e {
+				if !n.embedded[p+"/"+ek] || isContainer(ev) {
+					entryFields[ek] = ev
+					continue
+				}
+				tag := ek
+				if _, exists := tags[tag]; exists {
+					tag = k + "_" + ek
+				}
+				entryTags[tag] = fmt.Sprint(ev)
+			}
+
+			n.embed(p, entryFields, entryTags, add)
+			if len(entryFields) > 0 {
+				add(p, entryTags, entryFields)
+			}
+		}
+	}
+}
+
+// hasEmbedded returns whether an entry at path holds an embedded tag.
+func (n *naming) hasEmbedded(path string, entry map[string]any) bool {
+	for k, v := range entry {
+		if n.embedded[path+"/"+k] && !isContainer(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func isContainer(v any) bool {
+	switch v.(type) {
+	case map[string]any, []any:
+		return true
+	}
+	return false
+}
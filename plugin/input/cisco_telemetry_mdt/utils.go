@@ -11,11 +11,21 @@ const (
 	tcpMaxMsgLen uint32 = 1024 * 1024
 )
 
+// Encapsulations of the TCP dialout header
 const (
-	GBPVALUE  = "ValueByType"
-	GBPFIELDS = "fields"
-	GBPNAME   = "name"
-	Nexus     = "NX-OS"
+	encapGPB        uint16 = 1
+	encapJSON       uint16 = 2
+	encapGPBCompact uint16 = 3
+	encapGPBKV      uint16 = 4
 )
 
+// Metric modes, a metric per telemetry message or per row
+const (
+	metricModeMessage = "message"
+	metricModeRow     = "row"
+)
+
+// Nexus is the name of the unnamed fields NX-OS wraps values in
+const Nexus = "NX-OS"
+
 const defaultKeepaliveMinTime = internal.Duration(time.Second * 300)
@@ -1,6 +1,8 @@
 package cpu
 
 import (
+	"time"
+
 	cpuUtil "github.com/shirou/gopsutil/v3/cpu"
 
 	"telemetry/internal"
@@ -10,10 +12,14 @@ import (
 type metric struct {
 	LastStats []cpuUtil.TimesStat
 	CpuInfo   []cpuUtil.InfoStat
+
+	time time.Time
 }
 
 func NewCPUMetric() *metric {
-	return &metric{}
+	return &metric{
+		time: time.Now(),
+	}
 }
 
 func (m *metric) IsMetric() {
@@ -23,6 +29,7 @@ func (m *metric) Copy() models.Metric {
 	m2 := &metric{
 		LastStats: make([]cpuUtil.TimesStat, len(m.LastStats)),
 		CpuInfo:   make([]cpuUtil.InfoStat, len(m.CpuInfo)),
+		time:      m.time,
 	}
 
 	m2.CpuInfo = internal.DeepCopy(m.CpuInfo).([]cpuUtil.InfoStat)
@@ -30,3 +37,30 @@ func (m *metric) Copy() models.Metric {
 
 	return m2
 }
+
+// Series returns one "cpu" series per cpu, the fields are the cumulative
+// times in seconds.
+func (m *metric) Series() []models.Series {
+	series := make([]models.Series, 0, len(m.LastStats))
+	for _, s := range m.LastStats {
+		series = append(series, models.Series{
+			Name: "cpu",
+			Tags: map[string]string{"cpu": s.CPU},
+			Fields: map[string]any{
+				"time_user":       s.User,
+				"time_system":     s.System,
+				"time_idle":       s.Idle,
+				"time_nice":       s.Nice,
+				"time_iowait":     s.Iowait,
+				"time_irq":        s.Irq,
+				"time_softirq":    s.Softirq,
+				"time_steal":      s.Steal,
+				"time_guest":      s.Guest,
+				"time_guest_nice": s.GuestNice,
+			},
+			Time: m.time,
+			Type: models.Counter,
+		})
+	}
+	return series
+}
@@ -0,0 +1,296 @@
+package gnmi
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"telemetry/internal"
+	"telemetry/models"
+	"telemetry/plugin/common/gnmi"
+	interTLS "telemetry/plugin/common/tls"
+)
+
+const (
+	defaultRedial    = internal.Duration(10 * time.Second)
+	defaultMaxRedial = internal.Duration(5 * time.Minute)
+)
+
+// Subscription is a path subscribed to on every target.
+type Subscription struct {
+	// Name of the series of the path, series are named after the parent
+	// path of the updates when empty
+	Name   string `json:"name"`
+	Origin string `json:"origin"`
+	Path   string `json:"path"`
+
+	// One of "target_defined", "sample" or "on_change"
+	SubscriptionMode  string            `json:"subscription_mode"`
+	SampleInterval    internal.Duration `json:"sample_interval"`
+	SuppressRedundant bool              `json:"suppress_redundant"`
+	HeartbeatInterval internal.Duration `json:"heartbeat_interval"`
+}
+
+// GNMI subscribes to the paths of the subscriptions on gNMI targets, the
+// dial-in counterpart of the dial-out transports of cisco_telemetry_mdt.
+type GNMI struct {
+	Addresses     []string       `json:"addresses"`
+	Subscriptions []Subscription `json:"subscriptions"`
+
+	// One of "proto", "json", "json_ietf", "bytes" or "ascii"
+	Encoding    string `json:"encoding"`
+	Origin      string `json:"origin"`
+	Prefix      string `json:"prefix"`
+	Target      string `json:"target"`
+	UpdatesOnly bool   `json:"updates_only"`
+
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Delay before subscribing again after an error, doubled on each
+	// failure up to MaxRedial
+	Redial    internal.Duration `json:"redial"`
+	MaxRedial internal.Duration `json:"max_redial"`
+
+	MaxMsgSize int `json:"max_msg_size"`
+
+	EnableTLS bool `json:"enable_tls"`
+	interTLS.ClientConfig
+
+	log *logrus.Entry
+
+	request   *gnmipb.SubscribeRequest
+	decoder   *gnmi.Decoder
+	tlsConfig *tls.Config
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewGNMI() *GNMI {
+	return &GNMI{
+		Encoding:  "proto",
+		Redial:    defaultRedial,
+		MaxRedial: defaultMaxRedial,
+		log:       models.NewLogger("inputs.gnmi"),
+	}
+}
+
+func (g *GNMI) Init() error {
+	if len(g.Addresses) == 0 {
+		return fmt.Errorf("addresses are required")
+	}
+	if len(g.Subscriptions) == 0 {
+		return fmt.Errorf("subscriptions are required")
+	}
+	if g.Redial <= 0 {
+		g.Redial = defaultRedial
+	}
+	if g.MaxRedial < g.Redial {
+		g.MaxRedial = g.Redial
+	}
+
+	encoding, ok := gnmipb.Encoding_value[strings.ToUpper(g.Encoding)]
+	if !ok {
+		return fmt.Errorf("invalid encoding %q", g.Encoding)
+	}
+
+	prefix, err := gnmi.ParsePath(g.Prefix)
+	if err != nil {
+		return fmt.Errorf("invalid prefix %q: %v", g.Prefix, err)
+	}
+	prefix.Origin = g.Origin
+	prefix.Target = g.Target
+
+	list := &gnmipb.SubscriptionList{
+		Prefix:      prefix,
+		Mode:        gnmipb.SubscriptionList_STREAM,
+		Encoding:    gnmipb.Encoding(encoding),
+		UpdatesOnly: g.UpdatesOnly,
+	}
+	aliases := make(map[string]string)
+	for _, s := range g.Subscriptions {
+		subscription, err := s.build()
+		if err != nil {
+			return err
+		}
+		list.Subscription = append(list.Subscription, subscription)
+		if s.Name != "" {
+			aliases[gnmi.FormatPath(append(append([]*gnmipb.PathElem{}, prefix.Elem...), subscription.Path.Elem...))] = s.Name
+		}
+	}
+	g.request = &gnmipb.SubscribeRequest{Request: &gnmipb.SubscribeRequest_Subscribe{Subscribe: list}}
+
+	g.decoder, err = gnmi.NewDecoder(aliases)
+	if err != nil {
+		return err
+	}
+
+	g.tlsConfig, err = g.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+	if g.EnableTLS && g.tlsConfig == nil {
+		g.tlsConfig = &tls.Config{}
+	}
+	return nil
+}
+
+func (s *Subscription) build() (*gnmipb.Subscription, error) {
+	path, err := gnmi.ParsePath(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription path %q: %v", s.Path, err)
+	}
+	if s.Origin != "" {
+		path.Origin = s.Origin
+	}
+
+	mode, ok := gnmipb.SubscriptionMode_value[strings.ToUpper(s.SubscriptionMode)]
+	if s.SubscriptionMode == "" {
+		mode, ok = int32(gnmipb.SubscriptionMode_TARGET_DEFINED), true
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid subscription mode %q of %q, must be \"target_defined\", \"sample\" or \"on_change\"",
+			s.SubscriptionMode, s.Path)
+	}
+	if gnmipb.SubscriptionMode(mode) == gnmipb.SubscriptionMode_SAMPLE && s.SampleInterval <= 0 {
+		return nil, fmt.Errorf("sample_interval of %q is required in sample mode", s.Path)
+	}
+
+	return &gnmipb.Subscription{
+		Path:              path,
+		Mode:              gnmipb.SubscriptionMode(mode),
+		SampleInterval:    uint64(time.Duration(s.SampleInterval).Nanoseconds()),
+		SuppressRedundant: s.SuppressRedundant,
+		HeartbeatInterval: uint64(time.Duration(s.HeartbeatInterval).Nanoseconds()),
+	}, nil
+}
+
+// Start subscribes to every target until Stop, subscriptions are made again
+// after errors with an increasing delay.
+func (g *GNMI) Start(acc models.Accumulator) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancel = cancel
+
+	if g.Username != "" || g.Password != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "username", g.Username, "password", g.Password)
+	}
+
+	for _, address := range g.Addresses {
+		g.wg.Add(1)
+		go func(address string) {
+			defer g.wg.Done()
+			redial := time.Duration(g.Redial)
+			for ctx.Err() == nil {
+				received, err := g.subscribe(ctx, address, acc)
+				if ctx.Err() != nil {
+					return
+				}
+				if received {
+					redial = time.Duration(g.Redial)
+				}
+				acc.AddError(fmt.Errorf("subscription to %s failed: %v", address, err))
+				//nolint:errcheck // the context is only canceled on Stop
+				internal.SleepContext(ctx, redial)
+				if redial *= 2; redial > time.Duration(g.MaxRedial) {
+					redial = time.Duration(g.MaxRedial)
+				}
+			}
+		}(address)
+	}
+	return nil
+}
+
+// subscribe handles the responses of a subscription to a target until the
+// stream fails, received is true when a response was received.
+func (g *GNMI) subscribe(ctx context.Context, address string, acc models.Accumulator) (received bool, err error) {
+	creds := insecure.NewCredentials()
+	if g.tlsConfig != nil {
+		creds = credentials.NewTLS(g.tlsConfig)
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if g.MaxMsgSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(g.MaxMsgSize)))
+	}
+
+	conn, err := grpc.DialContext(ctx, address, opts...)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	stream, err := gnmipb.NewGNMIClient(conn).Subscribe(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err := stream.Send(g.request); err != nil {
+		return false, err
+	}
+	g.log.Infof("Subscribed to %s", address)
+
+	source := address
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		source = host
+	}
+	tags := map[string]string{"source": source}
+
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			return received, fmt.Errorf("stream closed")
+		} else if err != nil {
+			return received, err
+		}
+		received = true
+
+		switch r := response.Response.(type) {
+		case *gnmipb.SubscribeResponse_SyncResponse:
+			g.log.Debugf("Received the initial updates of %s", address)
+		case *gnmipb.SubscribeResponse_Update:
+			series, err := g.decoder.Series(r.Update, tags)
+			if err != nil {
+				acc.AddError(fmt.Errorf("decoding notification of %s failed: %v", address, err))
+				continue
+			}
+			if len(series) > 0 {
+				acc.AddMetric(models.NewSeriesMetric(series...))
+			}
+		}
+	}
+}
+
+func (g *GNMI) Stop() {
+	if g.cancel != nil {
+		g.cancel()
+	}
+	g.wg.Wait()
+}
+
+func (g *GNMI) Gather(_ models.Accumulator) error {
+	return nil
+}
+
+func (g *GNMI) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, g)
+	if err != nil {
+		return fmt.Errorf("[gnmi] config error: %v", err)
+	}
+	return nil
+}
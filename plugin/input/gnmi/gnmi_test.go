@@ -0,0 +1,152 @@
+package gnmi
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	gnmipb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"telemetry/internal"
+	"telemetry/internal/testutil"
+	"telemetry/models"
+	"telemetry/plugin/common/gnmi"
+)
+
+// fakeServer answers each subscription with one notification and a sync
+// response, then closes the stream.
+type fakeServer struct {
+	gnmipb.UnimplementedGNMIServer
+
+	mutex     sync.Mutex
+	requests  []*gnmipb.SubscribeRequest
+	usernames []string
+}
+
+func (s *fakeServer) Subscribe(stream gnmipb.GNMI_SubscribeServer) error {
+	request, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.mutex.Lock()
+	s.requests = append(s.requests, request)
+	s.usernames = append(s.usernames, md.Get("username")...)
+	s.mutex.Unlock()
+
+	prefix, err := gnmi.ParsePath("/interfaces/interface[name=Ethernet1]/state")
+	if err != nil {
+		return err
+	}
+	notification := &gnmipb.Notification{
+		Timestamp: 1678183200000000000,
+		Prefix:    prefix,
+		Update: []*gnmipb.Update{
+			{
+				Path: &gnmipb.Path{Elem: []*gnmipb.PathElem{{Name: "counters"}, {Name: "in-octets"}}},
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_UintVal{UintVal: 1234}},
+			},
+			{
+				Path: &gnmipb.Path{Elem: []*gnmipb.PathElem{{Name: "counters"}, {Name: "out-errors"}}},
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(`{"crc":2,"rate":0.5}`)}},
+			},
+			{
+				Path: &gnmipb.Path{Elem: []*gnmipb.PathElem{{Name: "oper-status"}}},
+				Val:  &gnmipb.TypedValue{Value: &gnmipb.TypedValue_StringVal{StringVal: "UP"}},
+			},
+		},
+	}
+	responses := []*gnmipb.SubscribeResponse{
+		{Response: &gnmipb.SubscribeResponse_Update{Update: notification}},
+		{Response: &gnmipb.SubscribeResponse_SyncResponse{SyncResponse: true}},
+	}
+	for _, response := range responses {
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fakeServer) subscriptions() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.requests)
+}
+
+func TestSubscribe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &fakeServer{}
+	grpcServer := grpc.NewServer()
+	gnmipb.RegisterGNMIServer(grpcServer, server)
+	go grpcServer.Serve(listener) //nolint:errcheck // stopped at the end of the test
+	defer grpcServer.Stop()
+
+	g := NewGNMI()
+	g.Addresses = []string{listener.Addr().String()}
+	g.Encoding = "json_ietf"
+	g.Username = "admin"
+	g.Password = "secret"
+	g.Redial = internal.Duration(10 * time.Millisecond)
+	g.Subscriptions = []Subscription{
+		{
+			Name:             "interface",
+			Origin:           "openconfig",
+			Path:             "/interfaces/interface/state",
+			SubscriptionMode: "sample",
+			SampleInterval:   internal.Duration(10 * time.Second),
+		},
+	}
+	require.NoError(t, g.Init())
+
+	acc := &testutil.Accumulator{}
+	require.NoError(t, g.Start(acc))
+	defer g.Stop()
+
+	// The server closes each stream, the input subscribes again
+	require.Eventually(t, func() bool { return server.subscriptions() >= 2 }, 5*time.Second, 10*time.Millisecond)
+	g.Stop()
+
+	server.mutex.Lock()
+	list := server.requests[0].GetSubscribe()
+	require.Equal(t, gnmipb.Encoding_JSON_IETF, list.Encoding)
+	require.Len(t, list.Subscription, 1)
+	require.Equal(t, "openconfig", list.Subscription[0].Path.Origin)
+	require.Equal(t, gnmipb.SubscriptionMode_SAMPLE, list.Subscription[0].Mode)
+	require.Equal(t, uint64(10*time.Second), list.Subscription[0].SampleInterval)
+	require.Equal(t, "admin", server.usernames[0])
+	server.mutex.Unlock()
+
+	require.GreaterOrEqual(t, len(acc.Metrics()), 2)
+	series := acc.Metrics()[0].(models.SeriesMetric).Series()
+	require.Len(t, series, 1)
+	require.Equal(t, "interface", series[0].Name)
+	require.Equal(t, map[string]string{"source": "127.0.0.1", "name": "Ethernet1"}, series[0].Tags)
+	require.Equal(t, map[string]any{
+		"counters/in-octets":  uint64(1234),
+		"counters/out-errors": map[string]any{"crc": int64(2), "rate": 0.5},
+		"oper-status":         "UP",
+	}, series[0].Fields)
+	require.Equal(t, int64(1678183200000000000), series[0].Time.UnixNano())
+}
+
+func TestDecoderNamesUnaliasedPaths(t *testing.T) {
+	decoder, err := gnmi.NewDecoder(nil)
+	require.NoError(t, err)
+
+	path, err := gnmi.ParsePath("/network-instances/network-instance[name=default]/protocols/protocol[name=BGP]/state/as")
+	require.NoError(t, err)
+	series, err := decoder.Series(&gnmipb.Notification{
+		Update: []*gnmipb.Update{{Path: path, Val: &gnmipb.TypedValue{Value: &gnmipb.TypedValue_IntVal{IntVal: 65000}}}},
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	require.Equal(t, "/network-instances/network-instance/protocols/protocol/state", series[0].Name)
+	require.Equal(t, map[string]string{"name": "default", "protocol_name": "BGP"}, series[0].Tags)
+	require.Equal(t, map[string]any{"as": int64(65000)}, series[0].Fields)
+}
@@ -0,0 +1,271 @@
+package huawei_telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"telemetry/internal"
+	"telemetry/models"
+	"telemetry/plugin/common/protobuf"
+)
+
+// envelope is a telemetry message, decoded from GPB or from JSON.
+type envelope struct {
+	NodeIDStr           string              `json:"node_id_str"`
+	SubscriptionIDStr   string              `json:"subscription_id_str"`
+	SensorPath          string              `json:"sensor_path"`
+	ProtoPath           string              `json:"proto_path"`
+	CollectionID        internal.JSONUint64 `json:"collection_id"`
+	CollectionStartTime internal.JSONUint64 `json:"collection_start_time"`
+	MsgTimestamp        internal.JSONUint64 `json:"msg_timestamp"`
+	CollectionEndTime   internal.JSONUint64 `json:"collection_end_time"`
+	CurrentPeriod       internal.JSONUint64 `json:"current_period"`
+	ProductName         string              `json:"product_name"`
+	SoftwareVersion     string              `json:"software_version"`
+	DataGPB             struct {
+		Row []envelopeRow `json:"row"`
+	} `json:"data_gpb"`
+	DataStr string `json:"data_str"`
+}
+
+// envelopeRow holds a sensor message, either GPB encoded or JSON.
+type envelopeRow struct {
+	Timestamp internal.JSONUint64 `json:"timestamp"`
+	Content   json.RawMessage     `json:"content"`
+
+	gpb []byte
+}
+
+// decoder decodes the telemetry messages of the dialout service, the
+// sensor messages are looked up in the sensor files.
+type decoder struct {
+	serviceArgs protoreflect.MessageDescriptor
+	telemetry   protoreflect.MessageDescriptor
+	sensors     *protoregistry.Files
+}
+
+func newDecoder(protoDir string) (*decoder, error) {
+	files, err := envelopeFiles()
+	if err != nil {
+		return nil, fmt.Errorf("parsing envelope failed: %v", err)
+	}
+	d := &decoder{sensors: new(protoregistry.Files)}
+	if d.serviceArgs, err = protobuf.FindMessage(files, "huawei_dialout.serviceArgs"); err != nil {
+		return nil, err
+	}
+	if d.telemetry, err = protobuf.FindMessage(files, "telemetry.Telemetry"); err != nil {
+		return nil, err
+	}
+
+	if protoDir != "" {
+		if d.sensors, err = sensorFiles(protoDir); err != nil {
+			return nil, fmt.Errorf("loading sensors of %s failed: %v", protoDir, err)
+		}
+	}
+	return d, nil
+}
+
+// decodeArgs returns the metric of the telemetry message of the arguments
+// of a dataPublish call, the message is either GPB encoded in data or JSON
+// in data_json.
+func (d *decoder) decodeArgs(args *dynamicpb.Message, source string) (models.Metric, error) {
+	fields := d.serviceArgs.Fields()
+	if errs := args.Get(fields.ByName("errors")).String(); errs != "" {
+		return nil, fmt.Errorf("device error: %s", errs)
+	}
+	if data := fields.ByName("data"); args.Has(data) {
+		return d.decodeGPB(args.Get(data).Bytes(), source)
+	}
+	if data := fields.ByName("data_json"); args.Has(data) {
+		return d.decodeJSON([]byte(args.Get(data).String()), source)
+	}
+	return nil, fmt.Errorf("no data")
+}
+
+// decodeGPB returns the metric of a GPB encoded telemetry message.
+func (d *decoder) decodeGPB(data []byte, source string) (models.Metric, error) {
+	msg := dynamicpb.NewMessage(d.telemetry)
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	fields := d.telemetry.Fields()
+	str := func(name string) string { return msg.Get(fields.ByName(protoreflect.Name(name))).String() }
+	counter := func(name string) internal.JSONUint64 {
+		return internal.JSONUint64(msg.Get(fields.ByName(protoreflect.Name(name))).Uint())
+	}
+	e := &envelope{
+		NodeIDStr:           str("node_id_str"),
+		SubscriptionIDStr:   str("subscription_id_str"),
+		SensorPath:          str("sensor_path"),
+		ProtoPath:           str("proto_path"),
+		CollectionID:        counter("collection_id"),
+		CollectionStartTime: counter("collection_start_time"),
+		MsgTimestamp:        counter("msg_timestamp"),
+		CollectionEndTime:   counter("collection_end_time"),
+		CurrentPeriod:       counter("current_period"),
+		ProductName:         str("product_name"),
+		SoftwareVersion:     str("software_version"),
+		DataStr:             str("data_str"),
+	}
+
+	if table := fields.ByName("data_gpb"); msg.Has(table) {
+		rowsField := table.Message().Fields().ByName("row")
+		rowFields := rowsField.Message().Fields()
+		rows := msg.Get(table).Message().Get(rowsField).List()
+		for i := 0; i < rows.Len(); i++ {
+			row := rows.Get(i).Message()
+			e.DataGPB.Row = append(e.DataGPB.Row, envelopeRow{
+				Timestamp: internal.JSONUint64(row.Get(rowFields.ByName("timestamp")).Uint()),
+				gpb:       append([]byte{}, row.Get(rowFields.ByName("content")).Bytes()...),
+			})
+		}
+	}
+	return d.metric(e, source)
+}
+
+// decodeJSON returns the metric of a JSON encoded telemetry message, the
+// content of the rows is JSON.
+func (d *decoder) decodeJSON(data []byte, source string) (models.Metric, error) {
+	e := &envelope{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return d.metric(e, source)
+}
+
+// metric returns a series per row named after the sensor path. When some
+// rows cannot be decoded the metric of the other rows is returned along
+// with the error.
+func (d *decoder) metric(e *envelope, source string) (models.Metric, error) {
+	tags := map[string]string{"source": source}
+	if e.NodeIDStr != "" {
+		tags["node_id"] = e.NodeIDStr
+	}
+	if e.SubscriptionIDStr != "" {
+		tags["subscription"] = e.SubscriptionIDStr
+	}
+	if e.SensorPath != "" {
+		tags["sensor_path"] = e.SensorPath
+	}
+
+	header := make(map[string]any)
+	for name, value := range map[string]internal.JSONUint64{
+		"collection_id":         e.CollectionID,
+		"collection_start_time": e.CollectionStartTime,
+		"msg_timestamp":         e.MsgTimestamp,
+		"collection_end_time":   e.CollectionEndTime,
+		"current_period":        e.CurrentPeriod,
+	} {
+		if value != 0 {
+			header[name] = uint64(value)
+		}
+	}
+	for name, value := range map[string]string{
+		"product_name":     e.ProductName,
+		"software_version": e.SoftwareVersion,
+	} {
+		if value != "" {
+			header[name] = value
+		}
+	}
+
+	rows := e.DataGPB.Row
+	if e.DataStr != "" {
+		rows = append(rows, envelopeRow{Content: json.RawMessage(e.DataStr)})
+	}
+
+	var series []models.Series
+	var firstErr error
+	for _, row := range rows {
+		fields, err := d.content(e, row)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		tm := time.Now()
+		if row.Timestamp > 0 {
+			tm = time.UnixMilli(int64(row.Timestamp))
+		} else if e.MsgTimestamp > 0 {
+			tm = time.UnixMilli(int64(e.MsgTimestamp))
+		}
+		seriesTags := make(map[string]string, len(tags))
+		for k, v := range tags {
+			seriesTags[k] = v
+		}
+		series = append(series, models.Series{
+			Name:   e.SensorPath,
+			Tags:   seriesTags,
+			Fields: fields,
+			Time:   tm,
+			Header: header,
+		})
+	}
+	if len(series) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return models.NewSeriesMetric(series...), firstErr
+}
+
+// content returns the fields of the sensor message of a row. The sensor
+// message is named by the proto path, or by the sensor path when the device
+// does not send it, it decodes GPB content and types JSON content.
+func (d *decoder) content(e *envelope, row envelopeRow) (map[string]any, error) {
+	name := e.ProtoPath
+	if name == "" {
+		name = sensorMessage(e.SensorPath)
+	}
+	md, err := protobuf.FindMessage(d.sensors, name)
+
+	if row.gpb == nil {
+		fields, err := jsonContent(row.Content)
+		if err != nil {
+			return nil, err
+		}
+		// JSON does not tell the type of numbers, they have the ones of the
+		// sensor message when it is loaded
+		if md != nil {
+			return protobuf.Walker{}.JSONValues(fields, md), nil
+		}
+		return internal.ConvertJSONNumbers(fields).(map[string]any), nil
+	}
+
+	if d.sensors.NumFiles() == 0 {
+		return nil, fmt.Errorf("decoding GPB content of %q requires the sensor .proto files of proto_dir", e.SensorPath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no sensor message for %q: %v", e.SensorPath, err)
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(row.gpb, msg); err != nil {
+		return nil, fmt.Errorf("decoding content of %q failed: %v", e.SensorPath, err)
+	}
+	return protobuf.Walker{}.MessageValues(msg), nil
+}
+
+// jsonContent decodes JSON content, given either as an object or as a
+// string holding the object. Numbers are left as json.Number.
+func jsonContent(content json.RawMessage) (map[string]any, error) {
+	var s string
+	if err := json.Unmarshal(content, &s); err == nil {
+		content = json.RawMessage(s)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("decoding JSON content failed: %v", err)
+	}
+	return fields, nil
+}
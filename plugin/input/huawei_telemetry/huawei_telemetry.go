@@ -0,0 +1,182 @@
+package huawei_telemetry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"telemetry/internal"
+	"telemetry/models"
+	interTLS "telemetry/plugin/common/tls"
+)
+
+const defaultKeepaliveMinTime = internal.Duration(time.Second * 300)
+
+type GRPCEnforcementPolicy struct {
+	PermitKeepaliveWithoutCalls bool              `json:"permit_keepalive_without_calls"`
+	KeepaliveMinTime            internal.Duration `json:"keepalive_minimum_time"`
+}
+
+// HuaweiTelemetry receives the telemetry pushed by Huawei VRP devices to
+// the gRPCDataservice dial-out service.
+type HuaweiTelemetry struct {
+	ServiceAddress    string                `json:"service_address"`
+	MaxMsgSize        int                   `json:"max_msg_size"`
+	EnforcementPolicy GRPCEnforcementPolicy `json:"grpc_enforcement_policy"`
+
+	// Directory of the sensor .proto files decoding GPB payloads, they are
+	// not shipped with the plugin so GPB payloads require it
+	ProtoDir string `json:"proto_dir"`
+
+	log *logrus.Entry
+
+	// GRPC TLS settings
+	interTLS.ServerConfig
+
+	decoder    *decoder
+	grpcServer *grpc.Server
+	listener   net.Listener
+
+	acc models.Accumulator
+	wg  sync.WaitGroup
+}
+
+func NewHuaweiTelemetry() *HuaweiTelemetry {
+	return &HuaweiTelemetry{
+		log: models.NewLogger("inputs.huawei_telemetry"),
+	}
+}
+
+// dataPublishServer is the gRPCDataservice of huawei-grpc-dialout.proto.
+type dataPublishServer interface {
+	DataPublish(stream grpc.ServerStream) error
+}
+
+var dataServiceDesc = grpc.ServiceDesc{
+	ServiceName: "huawei_dialout.gRPCDataservice",
+	HandlerType: (*dataPublishServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "dataPublish",
+		Handler:       dataPublishHandler,
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+	Metadata: "huawei-grpc-dialout.proto",
+}
+
+func dataPublishHandler(srv any, stream grpc.ServerStream) error {
+	return srv.(dataPublishServer).DataPublish(stream)
+}
+
+func (h *HuaweiTelemetry) Start(acc models.Accumulator) error {
+	var err error
+	h.acc = acc
+	h.decoder, err = newDecoder(h.ProtoDir)
+	if err != nil {
+		return err
+	}
+
+	var opts []grpc.ServerOption
+	tlsConfig, err := h.ServerConfig.TLSConfig()
+	if err != nil {
+		return err
+	} else if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	if h.MaxMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(h.MaxMsgSize))
+	}
+
+	if h.EnforcementPolicy.PermitKeepaliveWithoutCalls ||
+		(h.EnforcementPolicy.KeepaliveMinTime != 0 && h.EnforcementPolicy.KeepaliveMinTime != defaultKeepaliveMinTime) {
+		// Only set if either parameter does not match defaults
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             time.Duration(h.EnforcementPolicy.KeepaliveMinTime),
+			PermitWithoutStream: h.EnforcementPolicy.PermitKeepaliveWithoutCalls,
+		}))
+	}
+
+	h.listener, err = net.Listen("tcp", h.ServiceAddress)
+	if err != nil {
+		return err
+	}
+
+	h.grpcServer = grpc.NewServer(opts...)
+	h.grpcServer.RegisterService(&dataServiceDesc, h)
+
+	h.wg.Add(1)
+	go func() {
+		if err := h.grpcServer.Serve(h.listener); err != nil {
+			h.log.Errorf("serving GRPC server failed: %v", err)
+		}
+		h.wg.Done()
+	}()
+	return nil
+}
+
+// DataPublish RPC server method of the dial-out service, each call streams
+// the telemetry of a device.
+func (h *HuaweiTelemetry) DataPublish(stream grpc.ServerStream) error {
+	var source string
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		h.log.Infof("Accepted Huawei dialout connection from %s", p.Addr)
+		defer h.log.Infof("Closed Huawei dialout connection from %s", p.Addr)
+
+		source = p.Addr.String()
+		if host, _, err := net.SplitHostPort(source); err == nil {
+			source = host
+		}
+	}
+
+	for {
+		args := dynamicpb.NewMessage(h.decoder.serviceArgs)
+		if err := stream.RecvMsg(args); err != nil {
+			if err != io.EOF {
+				h.log.Errorf("GRPC dialout receive error: %v", err)
+			}
+			return nil
+		}
+
+		m, err := h.decoder.decodeArgs(args, source)
+		if err != nil {
+			h.acc.AddError(fmt.Errorf("decoding telemetry of %s failed: %v", source, err))
+		}
+		if m != nil {
+			h.acc.AddMetric(m)
+		}
+	}
+}
+
+func (h *HuaweiTelemetry) Stop() {
+	if h.grpcServer != nil {
+		h.grpcServer.Stop()
+	}
+	h.wg.Wait()
+}
+
+func (h *HuaweiTelemetry) Gather(_ models.Accumulator) error {
+	return nil
+}
+
+func (h *HuaweiTelemetry) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, h)
+	if err != nil {
+		return fmt.Errorf("[huawei_telemetry] config error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package huawei_telemetry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"telemetry/internal/testutil"
+	"telemetry/models"
+	"telemetry/plugin/common/protobuf"
+)
+
+const devmProto = `syntax = "proto3";
+package huawei_devm;
+
+message Devm {
+  message CpuInfos {
+    message CpuInfo {
+      string position = 1;
+      uint32 systemCpuUsage = 2;
+    }
+    repeated CpuInfo cpuInfo = 1;
+  }
+  CpuInfos cpuInfos = 1;
+}
+`
+
+// setField sets the fields of a message by name.
+func setFields(msg *dynamicpb.Message, values map[string]protoreflect.Value) *dynamicpb.Message {
+	for name, value := range values {
+		msg.Set(msg.Descriptor().Fields().ByName(protoreflect.Name(name)), value)
+	}
+	return msg
+}
+
+// cpuTelemetry returns a GPB telemetry message holding a Devm sensor
+// message.
+func cpuTelemetry(t *testing.T, d *decoder) []byte {
+	md, err := protobuf.FindMessage(d.sensors, "huawei_devm.Devm")
+	require.NoError(t, err)
+	infosField := md.Fields().ByName("cpuInfos")
+	infoField := infosField.Message().Fields().ByName("cpuInfo")
+
+	devm := dynamicpb.NewMessage(md)
+	infos := devm.Mutable(infosField).Message()
+	info := setFields(dynamicpb.NewMessage(infoField.Message()), map[string]protoreflect.Value{
+		"position":       protoreflect.ValueOfString("17"),
+		"systemCpuUsage": protoreflect.ValueOfUint32(12),
+	})
+	infos.Mutable(infoField).List().Append(protoreflect.ValueOfMessage(info))
+	content, err := proto.Marshal(devm)
+	require.NoError(t, err)
+
+	msg := setFields(dynamicpb.NewMessage(d.telemetry), map[string]protoreflect.Value{
+		"node_id_str":         protoreflect.ValueOfString("ne-1"),
+		"subscription_id_str": protoreflect.ValueOfString("cpu"),
+		"sensor_path":         protoreflect.ValueOfString("huawei-devm:devm/cpuInfos/cpuInfo"),
+		"collection_id":       protoreflect.ValueOfUint64(7),
+		"msg_timestamp":       protoreflect.ValueOfUint64(1678183200000),
+	})
+	tableField := d.telemetry.Fields().ByName("data_gpb")
+	rowField := tableField.Message().Fields().ByName("row")
+	row := setFields(dynamicpb.NewMessage(rowField.Message()), map[string]protoreflect.Value{
+		"timestamp": protoreflect.ValueOfUint64(1678183200005),
+		"content":   protoreflect.ValueOfBytes(content),
+	})
+	msg.Mutable(tableField).Message().Mutable(rowField).List().Append(protoreflect.ValueOfMessage(row))
+	data, err := proto.Marshal(msg)
+	require.NoError(t, err)
+	return data
+}
+
+func TestDataPublish(t *testing.T) {
+	protoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(protoDir, "huawei-devm.proto"), []byte(devmProto), 0o600))
+
+	h := NewHuaweiTelemetry()
+	h.ServiceAddress = "127.0.0.1:0"
+	h.ProtoDir = protoDir
+	acc := &testutil.Accumulator{}
+	require.NoError(t, h.Start(acc))
+	defer h.Stop()
+
+	conn, err := grpc.Dial(h.listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	stream, err := conn.NewStream(context.Background(), &dataServiceDesc.Streams[0], "/huawei_dialout.gRPCDataservice/dataPublish")
+	require.NoError(t, err)
+
+	jsonTelemetry := `{"node_id_str":"ne-1","subscription_id_str":"cpu","sensor_path":"huawei-devm:devm/cpuInfos/cpuInfo",` +
+		`"collection_id":"7","msg_timestamp":"1678183200005","data_str":"{\"cpuInfos\":{\"cpuInfo\":[{\"position\":\"17\",\"systemCpuUsage\":12}]}}"}`
+	for _, values := range []map[string]protoreflect.Value{
+		{"data": protoreflect.ValueOfBytes(cpuTelemetry(t, h.decoder))},
+		{"data_json": protoreflect.ValueOfString(jsonTelemetry)},
+	} {
+		require.NoError(t, stream.SendMsg(setFields(dynamicpb.NewMessage(h.decoder.serviceArgs), values)))
+	}
+	require.NoError(t, stream.CloseSend())
+
+	require.Eventually(t, func() bool { return acc.Count() == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, acc.Errors())
+
+	for _, m := range acc.Metrics() {
+		series := m.(models.SeriesMetric).Series()
+		require.Len(t, series, 1)
+		require.Equal(t, "huawei-devm:devm/cpuInfos/cpuInfo", series[0].Name)
+		require.Equal(t, map[string]string{
+			"source":       "127.0.0.1",
+			"node_id":      "ne-1",
+			"subscription": "cpu",
+			"sensor_path":  "huawei-devm:devm/cpuInfos/cpuInfo",
+		}, series[0].Tags)
+		require.Equal(t, map[string]any{
+			"cpuInfos": map[string]any{
+				"cpuInfo": []any{map[string]any{"position": "17", "systemCpuUsage": uint64(12)}},
+			},
+		}, series[0].Fields)
+		require.Equal(t, int64(1678183200005), series[0].Time.UnixMilli())
+		require.Equal(t, uint64(7), series[0].Header["collection_id"])
+	}
+}
+
+func TestGPBWithoutProtoDir(t *testing.T) {
+	protoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(protoDir, "huawei-devm.proto"), []byte(devmProto), 0o600))
+	withSensors, err := newDecoder(protoDir)
+	require.NoError(t, err)
+
+	d, err := newDecoder("")
+	require.NoError(t, err)
+	_, err = d.decodeGPB(cpuTelemetry(t, withSensors), "127.0.0.1")
+	require.ErrorContains(t, err, "proto_dir")
+}
@@ -0,0 +1,143 @@
+package huawei_telemetry
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"telemetry/plugin/common/protobuf"
+)
+
+// dialoutProto is huawei-grpc-dialout.proto, the service VRP devices
+// publish to.
+const dialoutProto = `syntax = "proto3";
+package huawei_dialout;
+
+service gRPCDataservice {
+  rpc dataPublish(stream serviceArgs) returns (stream serviceArgs) {};
+}
+
+message serviceArgs {
+  int64 ReqId = 1;
+  oneof MessageData {
+    bytes data = 2;
+    string data_json = 4;
+  }
+  string errors = 3;
+}
+`
+
+// telemetryProto is huawei-telemetry.proto, the envelope of the sensor
+// payloads.
+const telemetryProto = `syntax = "proto3";
+package telemetry;
+
+message Telemetry {
+  string node_id_str = 1;
+  string subscription_id_str = 2;
+  string sensor_path = 3;
+  string proto_path = 13;
+  uint64 collection_id = 4;
+  uint64 collection_start_time = 5;
+  uint64 msg_timestamp = 6;
+  TelemetryGPBTable data_gpb = 7;
+  uint64 collection_end_time = 8;
+  uint32 current_period = 9;
+  string except_desc = 10;
+  string product_name = 11;
+  enum Encoding {
+    Encoding_GPB = 0;
+    Encoding_JSON = 1;
+  };
+  Encoding encoding = 12;
+  string data_str = 14;
+  string ne_id = 15;
+  string software_version = 16;
+}
+
+message TelemetryGPBTable {
+  repeated TelemetryRowGPB row = 1;
+  repeated DataPath delete = 2;
+  Generator generator = 3;
+}
+
+message Generator {
+  uint64 generator_id = 1;
+  uint32 generator_sn = 2;
+  bool generator_sync = 3;
+}
+
+message TelemetryRowGPB {
+  uint64 timestamp = 1;
+  bytes content = 11;
+}
+
+message DataPath {
+  uint64 timestamp = 1;
+  Path path = 2;
+}
+
+message Path {
+  repeated PathElem node = 1;
+}
+
+message PathElem {
+  string name = 1;
+  map<string, string> key = 2;
+}
+`
+
+// envelopeFiles returns the files of the dialout service and of the
+// telemetry envelope.
+func envelopeFiles() (*protoregistry.Files, error) {
+	parser := protoparse.Parser{
+		Accessor: protoparse.FileContentsFromMap(map[string]string{
+			"huawei-grpc-dialout.proto": dialoutProto,
+			"huawei-telemetry.proto":    telemetryProto,
+		}),
+	}
+	return protobuf.ParseFiles(parser, "huawei-grpc-dialout.proto", "huawei-telemetry.proto")
+}
+
+// sensorFiles returns the files of the sensor .proto files of a directory,
+// imported relative to it.
+func sensorFiles(dir string) (*protoregistry.Files, error) {
+	var filenames []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(p) != ".proto" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		filenames = append(filenames, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return protobuf.ParseFiles(protoparse.Parser{ImportPaths: []string{dir}}, filenames...)
+}
+
+// sensorMessage returns the name of the message of a sensor path such as
+// huawei-ifm:ifm/interfaces/interface, huawei_ifm.Ifm, named after the
+// module and its top container.
+func sensorMessage(sensorPath string) string {
+	module, path, ok := strings.Cut(sensorPath, ":")
+	if !ok {
+		return ""
+	}
+	container, _, _ := strings.Cut(path, "/")
+
+	var sb strings.Builder
+	sb.WriteString(strings.ReplaceAll(module, "-", "_"))
+	sb.WriteByte('.')
+	for _, word := range strings.FieldsFunc(container, func(r rune) bool { return r == '-' || r == '_' }) {
+		sb.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return sb.String()
+}
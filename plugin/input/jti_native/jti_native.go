@@ -0,0 +1,277 @@
+package jti_native
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"telemetry/models"
+	"telemetry/plugin/common/protobuf"
+)
+
+// maxPacketSize is the largest UDP payload
+const maxPacketSize = 65535
+
+// keyFields are the fields identifying the records of the sensors, and
+// the entries of their lists, they are used as tags.
+var keyFields = map[string]bool{
+	"if_name":             true,
+	"name":                true,
+	"instance_identifier": true,
+	"counter_name":        true,
+	"filter_name":         true,
+	"queue_number":        true,
+}
+
+// JTINative receives the native Junos Telemetry Interface sensors streamed
+// over UDP by the line cards of Juniper routers.
+type JTINative struct {
+	ServiceAddress string `json:"service_address"`
+	ReadBufferSize int    `json:"read_buffer_size"`
+
+	log *logrus.Entry
+
+	schema *schema
+	conn   net.PacketConn
+
+	acc models.Accumulator
+	wg  sync.WaitGroup
+}
+
+func NewJTINative() *JTINative {
+	return &JTINative{
+		log: models.NewLogger("inputs.jti_native"),
+	}
+}
+
+func (j *JTINative) Init() error {
+	var err error
+	j.schema, err = loadSchema()
+	if err != nil {
+		return fmt.Errorf("loading sensors failed: %v", err)
+	}
+	return nil
+}
+
+func (j *JTINative) Start(acc models.Accumulator) error {
+	j.acc = acc
+
+	conn, err := net.ListenPacket("udp", j.ServiceAddress)
+	if err != nil {
+		return err
+	}
+	if j.ReadBufferSize > 0 {
+		if udpConn, ok := conn.(*net.UDPConn); ok {
+			if err := udpConn.SetReadBuffer(j.ReadBufferSize); err != nil {
+				j.log.Errorf("setting read buffer size failed: %v", err)
+			}
+		}
+	}
+	j.conn = conn
+
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+		j.listen()
+	}()
+	return nil
+}
+
+// listen decodes the packets of all senders until the connection is closed.
+func (j *JTINative) listen() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := j.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil {
+			j.acc.AddError(fmt.Errorf("reading packet failed: %v", err))
+			continue
+		}
+
+		source := addr.String()
+		if host, _, err := net.SplitHostPort(source); err == nil {
+			source = host
+		}
+		series, err := j.schema.decode(buf[:n], source)
+		if err != nil {
+			j.acc.AddError(fmt.Errorf("decoding packet of %s failed: %v", source, err))
+			continue
+		}
+		if len(series) > 0 {
+			j.acc.AddMetric(models.NewSeriesMetric(series...))
+		}
+	}
+}
+
+func (j *JTINative) Stop() {
+	if j.conn != nil {
+		//nolint:errcheck,revive // we cannot do anything if the closing fails
+		_ = j.conn.Close()
+	}
+	j.wg.Wait()
+}
+
+func (j *JTINative) Gather(_ models.Accumulator) error {
+	return nil
+}
+
+func (j *JTINative) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, j)
+	if err != nil {
+		return fmt.Errorf("[jti_native] config error: %v", err)
+	}
+	return nil
+}
+
+// decode returns a series per record of the sensors of a TelemetryStream
+// message, tagged with the system, component and sub-component of the
+// stream and the keys of the record.
+func (s *schema) decode(data []byte, source string) ([]models.Series, error) {
+	msg := dynamicpb.NewMessage(s.stream)
+	if err := (proto.UnmarshalOptions{Resolver: s.resolver}).Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	fields := s.stream.Fields()
+	tags := map[string]string{
+		"source":    source,
+		"system_id": msg.Get(fields.ByName("system_id")).String(),
+	}
+	for name, tag := range map[protoreflect.Name]string{
+		"component_id":     "component",
+		"sub_component_id": "sub_component",
+	} {
+		if fd := fields.ByName(name); msg.Has(fd) {
+			tags[tag] = strconv.FormatUint(msg.Get(fd).Uint(), 10)
+		}
+	}
+	if fd := fields.ByName("sensor_name"); msg.Has(fd) {
+		tags["sensor_name"] = msg.Get(fd).String()
+	}
+
+	tm := time.Now()
+	if fd := fields.ByName("timestamp"); msg.Has(fd) {
+		tm = time.UnixMilli(int64(msg.Get(fd).Uint()))
+	}
+
+	enterprise := msg.Get(fields.ByName("enterprise")).Message()
+	juniper := s.juniper.TypeDescriptor()
+	if !enterprise.Has(juniper) {
+		return nil, nil
+	}
+	sensors := enterprise.Get(juniper).Message()
+
+	var series []models.Series
+	for _, sensor := range s.sensors {
+		xd := sensor.extension.TypeDescriptor()
+		if !sensors.Has(xd) {
+			continue
+		}
+		records := sensors.Get(xd).Message().Get(sensor.records).List()
+		for i := 0; i < records.Len(); i++ {
+			record := records.Get(i).Message()
+
+			recordTags := make(map[string]string, len(tags)+1)
+			for k, v := range tags {
+				recordTags[k] = v
+			}
+			for k, v := range recordKeys(record) {
+				recordTags[k] = v
+			}
+			series = append(series, models.Series{
+				Name:   sensor.name,
+				Tags:   recordTags,
+				Fields: recordValues(record),
+				Time:   tm,
+			})
+		}
+	}
+	return series, nil
+}
+
+// recordKeys returns the key fields of a record.
+func recordKeys(record protoreflect.Message) map[string]string {
+	keys := make(map[string]string)
+	record.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if keyFields[string(fd.Name())] && !fd.IsList() && fd.Message() == nil {
+			keys[string(fd.Name())] = fmt.Sprint(v.Interface())
+		}
+		return true
+	})
+	return keys
+}
+
+// recordValues returns the set fields of a record other than its keys.
+// Lists of records with keys, such as the queues of an interface, are maps
+// by key.
+func recordValues(record protoreflect.Message) map[string]any {
+	values := make(map[string]any)
+	record.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := string(fd.Name())
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			values[name] = listValues(v.List())
+		case fd.IsList():
+			items := make([]any, v.List().Len())
+			for i := range items {
+				items[i] = protobuf.Walker{}.Value(fd, v.List().Get(i))
+			}
+			values[name] = items
+		case fd.Message() != nil:
+			values[name] = recordValues(v.Message())
+		case !keyFields[name]:
+			values[name] = protobuf.Walker{}.Value(fd, v)
+		}
+		return true
+	})
+	return values
+}
+
+// listValues returns the values of a list of records as a map by their
+// joined keys, or as a slice when they have no key.
+func listValues(list protoreflect.List) any {
+	items := make([]any, list.Len())
+	entries := make(map[string]any, list.Len())
+	for i := range items {
+		record := list.Get(i).Message()
+		items[i] = recordValues(record)
+
+		keys := recordKeys(record)
+		if len(keys) == 0 {
+			entries = nil
+			continue
+		}
+		if entries != nil {
+			names := make([]string, 0, len(keys))
+			for k := range keys {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			key := make([]string, len(names))
+			for j, k := range names {
+				key[j] = keys[k]
+			}
+			entries[strings.Join(key, "/")] = items[i]
+		}
+	}
+	if entries == nil {
+		return items
+	}
+	return entries
+}
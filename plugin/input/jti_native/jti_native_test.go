@@ -0,0 +1,253 @@
+package jti_native
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"telemetry/internal/testutil"
+	"telemetry/models"
+)
+
+// setFields sets the fields of a message by name.
+func setFields(msg protoreflect.Message, values map[string]protoreflect.Value) protoreflect.Message {
+	for name, value := range values {
+		msg.Set(msg.Descriptor().Fields().ByName(protoreflect.Name(name)), value)
+	}
+	return msg
+}
+
+const (
+	interfaceSensor = "/junos/system/linecard/interface/"
+	lspSensor       = "/junos/services/label-switched-path/usage/"
+	firewallSensor  = "/junos/system/linecard/firewall/"
+)
+
+// sensorStream returns a TelemetryStream message of a system carrying the
+// records of the sensor named after its resource path.
+func sensorStream(t *testing.T, s *schema, systemID, name string, records ...protoreflect.Message) []byte {
+	var sensor *sensor
+	for i := range s.sensors {
+		if s.sensors[i].name == name {
+			sensor = &s.sensors[i]
+		}
+	}
+	require.NotNil(t, sensor, name)
+
+	ext := dynamicpb.NewMessage(sensor.extension.TypeDescriptor().Message())
+	list := ext.Mutable(sensor.records).List()
+	for _, record := range records {
+		list.Append(protoreflect.ValueOfMessage(record))
+	}
+
+	juniper := dynamicpb.NewMessage(s.juniper.TypeDescriptor().Message())
+	juniper.Set(sensor.extension.TypeDescriptor(), protoreflect.ValueOfMessage(ext))
+
+	stream := dynamicpb.NewMessage(s.stream)
+	setFields(stream, map[string]protoreflect.Value{
+		"system_id":    protoreflect.ValueOfString(systemID),
+		"component_id": protoreflect.ValueOfUint32(1),
+		"sensor_name":  protoreflect.ValueOfString("sensor:" + name + ":PFE"),
+		"timestamp":    protoreflect.ValueOfUint64(1678183200005),
+	})
+	enterprise := stream.Mutable(s.stream.Fields().ByName("enterprise")).Message()
+	enterprise.Set(s.juniper.TypeDescriptor(), protoreflect.ValueOfMessage(juniper))
+
+	data, err := proto.Marshal(stream)
+	require.NoError(t, err)
+	return data
+}
+
+// newRecord returns a record of the sensor named after its resource path.
+func newRecord(s *schema, name string) protoreflect.Message {
+	for _, sensor := range s.sensors {
+		if sensor.name == name {
+			return dynamicpb.NewMessage(sensor.records.Message())
+		}
+	}
+	return nil
+}
+
+// appendEntry appends an entry with the given fields to the list field of
+// a record.
+func appendEntry(record protoreflect.Message, field string, values map[string]protoreflect.Value) {
+	list := record.Mutable(record.Descriptor().Fields().ByName(protoreflect.Name(field))).List()
+	entry := list.NewElement().Message()
+	setFields(entry, values)
+	list.Append(protoreflect.ValueOfMessage(entry))
+}
+
+// interfaceStream returns a TelemetryStream message of the interface sensor
+// of a system.
+func interfaceStream(t *testing.T, s *schema, systemID string) []byte {
+	record := setFields(newRecord(s, interfaceSensor), map[string]protoreflect.Value{
+		"if_name":               protoreflect.ValueOfString("xe-0/0/0"),
+		"if_operational_status": protoreflect.ValueOfString("UP"),
+	})
+	for i := uint32(0); i < 2; i++ {
+		appendEntry(record, "egress_queue_info", map[string]protoreflect.Value{
+			"queue_number": protoreflect.ValueOfUint32(i),
+			"packets":      protoreflect.ValueOfUint64(uint64(10 * i)),
+		})
+	}
+	return sensorStream(t, s, systemID, interfaceSensor, record)
+}
+
+func TestListen(t *testing.T) {
+	j := NewJTINative()
+	j.ServiceAddress = "127.0.0.1:0"
+	require.NoError(t, j.Init())
+	acc := &testutil.Accumulator{}
+	require.NoError(t, j.Start(acc))
+	defer j.Stop()
+
+	var wg sync.WaitGroup
+	for _, systemID := range []string{"mx-1", "mx-2"} {
+		data := interfaceStream(t, j.schema, systemID)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("udp", j.conn.LocalAddr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			if _, err := conn.Write(data); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	conn, err := net.Dial("udp", j.conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte{0xff, 0xff, 0xff})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return acc.Count() == 2 && len(acc.Errors()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	require.Contains(t, acc.Errors()[0].Error(), "127.0.0.1")
+
+	systems := make(map[string]bool)
+	for _, m := range acc.Metrics() {
+		series := m.(models.SeriesMetric).Series()
+		require.Len(t, series, 1)
+		require.Equal(t, "/junos/system/linecard/interface/", series[0].Name)
+
+		systemID := series[0].Tags["system_id"]
+		systems[systemID] = true
+		require.Equal(t, map[string]string{
+			"source":      "127.0.0.1",
+			"system_id":   systemID,
+			"component":   "1",
+			"sensor_name": "sensor:/junos/system/linecard/interface/:PFE",
+			"if_name":     "xe-0/0/0",
+		}, series[0].Tags)
+		require.Equal(t, map[string]any{
+			"if_operational_status": "UP",
+			"egress_queue_info": map[string]any{
+				"0": map[string]any{"packets": uint64(0)},
+				"1": map[string]any{"packets": uint64(10)},
+			},
+		}, series[0].Fields)
+		require.Equal(t, int64(1678183200005), series[0].Time.UnixMilli())
+	}
+	require.Equal(t, map[string]bool{"mx-1": true, "mx-2": true}, systems)
+}
+
+func TestDecodeLSP(t *testing.T) {
+	s, err := loadSchema()
+	require.NoError(t, err)
+
+	var records []protoreflect.Message
+	for i, name := range []string{"to-pe1", "to-pe2"} {
+		records = append(records, setFields(newRecord(s, lspSensor), map[string]protoreflect.Value{
+			"name":                protoreflect.ValueOfString(name),
+			"instance_identifier": protoreflect.ValueOfUint32(uint32(i)),
+			"counter_name":        protoreflect.ValueOfString("c-" + name),
+			"packets":             protoreflect.ValueOfUint64(uint64(100 * (i + 1))),
+			"bytes":               protoreflect.ValueOfUint64(uint64(6400 * (i + 1))),
+			"packet_rate":         protoreflect.ValueOfUint64(5),
+		}))
+	}
+
+	series, err := s.decode(sensorStream(t, s, "mx-1", lspSensor, records...), "10.0.0.1")
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	for i, name := range []string{"to-pe1", "to-pe2"} {
+		require.Equal(t, lspSensor, series[i].Name)
+		require.Equal(t, map[string]string{
+			"source":              "10.0.0.1",
+			"system_id":           "mx-1",
+			"component":           "1",
+			"sensor_name":         "sensor:" + lspSensor + ":PFE",
+			"name":                name,
+			"instance_identifier": fmt.Sprint(i),
+			"counter_name":        "c-" + name,
+		}, series[i].Tags)
+		require.Equal(t, map[string]any{
+			"packets":     uint64(100 * (i + 1)),
+			"bytes":       uint64(6400 * (i + 1)),
+			"packet_rate": uint64(5),
+		}, series[i].Fields)
+	}
+}
+
+func TestDecodeFirewall(t *testing.T) {
+	s, err := loadSchema()
+	require.NoError(t, err)
+
+	record := setFields(newRecord(s, firewallSensor), map[string]protoreflect.Value{
+		"filter_name": protoreflect.ValueOfString("protect-re"),
+		"timestamp":   protoreflect.ValueOfUint64(1678183200),
+	})
+	appendEntry(record, "memory_usage", map[string]protoreflect.Value{
+		"name":      protoreflect.ValueOfString("HEAP"),
+		"allocated": protoreflect.ValueOfUint64(2048),
+	})
+	for _, name := range []string{"accept-ssh", "discard-all"} {
+		appendEntry(record, "counter_stats", map[string]protoreflect.Value{
+			"name":    protoreflect.ValueOfString(name),
+			"packets": protoreflect.ValueOfUint64(uint64(len(name))),
+			"bytes":   protoreflect.ValueOfUint64(uint64(64 * len(name))),
+		})
+	}
+	appendEntry(record, "policer_stats", map[string]protoreflect.Value{
+		"name":                protoreflect.ValueOfString("police-icmp"),
+		"out_of_spec_packets": protoreflect.ValueOfUint64(3),
+	})
+
+	series, err := s.decode(sensorStream(t, s, "mx-1", firewallSensor, record), "10.0.0.1")
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	require.Equal(t, firewallSensor, series[0].Name)
+	require.Equal(t, map[string]string{
+		"source":      "10.0.0.1",
+		"system_id":   "mx-1",
+		"component":   "1",
+		"sensor_name": "sensor:" + firewallSensor + ":PFE",
+		"filter_name": "protect-re",
+	}, series[0].Tags)
+	// The entries of the lists are keyed by their name
+	require.Equal(t, map[string]any{
+		"timestamp": uint64(1678183200),
+		"memory_usage": map[string]any{
+			"HEAP": map[string]any{"allocated": uint64(2048)},
+		},
+		"counter_stats": map[string]any{
+			"accept-ssh":  map[string]any{"packets": uint64(10), "bytes": uint64(640)},
+			"discard-all": map[string]any{"packets": uint64(11), "bytes": uint64(704)},
+		},
+		"policer_stats": map[string]any{
+			"police-icmp": map[string]any{"out_of_spec_packets": uint64(3)},
+		},
+	}, series[0].Fields)
+}
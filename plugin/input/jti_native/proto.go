@@ -0,0 +1,241 @@
+package jti_native
+
+import (
+	"fmt"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"telemetry/plugin/common/protobuf"
+)
+
+// The native sensor messages of Junos, without the telemetry_options field
+// options marking keys, timestamps and counters.
+var protos = map[string]string{
+	"telemetry_top.proto": `syntax = "proto2";
+
+message TelemetryStream {
+  required string system_id = 1;
+  optional uint32 component_id = 2;
+  optional uint32 sub_component_id = 3;
+  optional string sensor_name = 4;
+  optional uint32 sequence_number = 5;
+  optional uint64 timestamp = 6;
+  optional uint32 version_major = 7;
+  optional uint32 version_minor = 8;
+  optional IETFSensors ietf = 100;
+  optional EnterpriseSensors enterprise = 101;
+}
+
+message IETFSensors {
+  extensions 1 to max;
+}
+
+message EnterpriseSensors {
+  extensions 1 to max;
+}
+
+extend EnterpriseSensors {
+  optional JuniperNetworksSensors juniperNetworks = 2636;
+}
+
+message JuniperNetworksSensors {
+  extensions 1 to max;
+}
+`,
+	"port.proto": `syntax = "proto2";
+import "telemetry_top.proto";
+
+extend JuniperNetworksSensors {
+  optional Port jnpr_interface_ext = 3;
+}
+
+message Port {
+  repeated InterfaceInfos interface_stats = 1;
+}
+
+message InterfaceInfos {
+  required string if_name = 1;
+  optional uint64 init_time = 2;
+  optional uint32 snmp_if_index = 3;
+  optional string parent_ae_name = 4;
+  repeated QueueStats egress_queue_info = 5;
+  repeated QueueStats ingress_queue_info = 6;
+  optional InterfaceStats ingress_stats = 7;
+  optional InterfaceStats egress_stats = 8;
+  optional IngressInterfaceErrors ingress_errors = 9;
+  optional string if_administration_status = 10;
+  optional string if_operational_status = 11;
+  optional string if_description = 12;
+  optional uint64 if_transitions = 13;
+  optional uint32 ifLastChange = 14;
+  optional uint32 ifHighSpeed = 15;
+  optional EgressInterfaceErrors egress_errors = 16;
+}
+
+message InterfaceStats {
+  required uint64 if_pkts = 1;
+  required uint64 if_octets = 2;
+  required uint64 if_1sec_pkts = 3;
+  required uint64 if_1sec_octets = 4;
+  required uint64 if_uc_pkts = 5;
+  required uint64 if_mc_pkts = 6;
+  required uint64 if_bc_pkts = 7;
+  optional uint64 if_error = 8;
+  optional uint64 if_pause_pkts = 9;
+  optional uint64 if_unknown_proto_pkts = 10;
+}
+
+message IngressInterfaceErrors {
+  optional uint64 if_errors = 1;
+  optional uint64 if_in_qdrops = 2;
+  optional uint64 if_in_frame_errors = 3;
+  optional uint64 if_discards = 4;
+  optional uint64 if_in_runts = 5;
+  optional uint64 if_in_l3_incompletes = 6;
+  optional uint64 if_in_l2chan_errors = 7;
+  optional uint64 if_in_l2_mismatch_timeouts = 8;
+  optional uint64 if_in_fifo_errors = 9;
+  optional uint64 if_in_resource_errors = 10;
+}
+
+message EgressInterfaceErrors {
+  optional uint64 if_errors = 1;
+  optional uint64 if_discards = 2;
+}
+
+message QueueStats {
+  optional uint32 queue_number = 1;
+  optional uint64 packets = 2;
+  optional uint64 bytes = 3;
+  optional uint64 tail_drop_packets = 4;
+  optional uint64 rl_drop_packets = 5;
+  optional uint64 rl_drop_bytes = 6;
+  optional uint64 red_drop_packets = 7;
+  optional uint64 red_drop_bytes = 8;
+  optional uint64 avg_buffer_occupancy = 9;
+  optional uint64 cur_buffer_occupancy = 10;
+  optional uint64 peak_buffer_occupancy = 11;
+  optional uint64 allocated_buffer_size = 12;
+}
+`,
+	"lsp_stats.proto": `syntax = "proto2";
+import "telemetry_top.proto";
+
+extend JuniperNetworksSensors {
+  optional LspStats jnpr_lsp_statistics_ext = 5;
+}
+
+message LspStats {
+  repeated LspStatsRecord lsp_stats_records = 1;
+}
+
+message LspStatsRecord {
+  required string name = 1;
+  required uint32 instance_identifier = 2;
+  required string counter_name = 3;
+  optional uint64 packets = 4;
+  optional uint64 bytes = 5;
+  optional uint64 packet_rate = 6;
+  optional uint64 byte_rate = 7;
+}
+`,
+	"firewall.proto": `syntax = "proto2";
+import "telemetry_top.proto";
+
+extend JuniperNetworksSensors {
+  optional Firewall jnpr_firewall_ext = 6;
+}
+
+message Firewall {
+  repeated FirewallStats firewall_stats = 1;
+}
+
+message FirewallStats {
+  required string filter_name = 1;
+  optional uint64 timestamp = 2;
+  repeated MemoryUsage memory_usage = 3;
+  repeated CounterStats counter_stats = 4;
+  repeated PolicerStats policer_stats = 5;
+}
+
+message MemoryUsage {
+  required string name = 1;
+  optional uint64 allocated = 2;
+}
+
+message CounterStats {
+  required string name = 1;
+  optional uint64 packets = 2;
+  optional uint64 bytes = 3;
+}
+
+message PolicerStats {
+  required string name = 1;
+  optional uint64 out_of_spec_packets = 2;
+  optional uint64 out_of_spec_bytes = 3;
+}
+`,
+}
+
+// sensor is a Juniper sensor extension, its records make a series each.
+type sensor struct {
+	// name of the series, the resource path of the sensor
+	name      string
+	extension protoreflect.ExtensionType
+	records   protoreflect.FieldDescriptor
+}
+
+// schema holds the messages of the native sensors.
+type schema struct {
+	stream   protoreflect.MessageDescriptor
+	juniper  protoreflect.ExtensionType
+	resolver *protoregistry.Types
+	sensors  []sensor
+}
+
+func loadSchema() (*schema, error) {
+	parser := protoparse.Parser{Accessor: protoparse.FileContentsFromMap(protos)}
+	files, err := protobuf.ParseFiles(parser, "port.proto", "lsp_stats.proto", "firewall.proto")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &schema{resolver: new(protoregistry.Types)}
+	if s.stream, err = protobuf.FindMessage(files, "TelemetryStream"); err != nil {
+		return nil, err
+	}
+
+	extension := func(name string) (protoreflect.ExtensionType, error) {
+		d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			return nil, err
+		}
+		xt := dynamicpb.NewExtensionType(d.(protoreflect.ExtensionDescriptor))
+		return xt, s.resolver.RegisterExtension(xt)
+	}
+	if s.juniper, err = extension("juniperNetworks"); err != nil {
+		return nil, err
+	}
+
+	for _, ext := range []struct {
+		name, extension, records string
+	}{
+		{"/junos/system/linecard/interface/", "jnpr_interface_ext", "interface_stats"},
+		{"/junos/services/label-switched-path/usage/", "jnpr_lsp_statistics_ext", "lsp_stats_records"},
+		{"/junos/system/linecard/firewall/", "jnpr_firewall_ext", "firewall_stats"},
+	} {
+		xt, err := extension(ext.extension)
+		if err != nil {
+			return nil, err
+		}
+		records := xt.TypeDescriptor().Message().Fields().ByName(protoreflect.Name(ext.records))
+		if records == nil {
+			return nil, fmt.Errorf("no records %s in %s", ext.records, ext.extension)
+		}
+		s.sensors = append(s.sensors, sensor{name: ext.name, extension: xt, records: records})
+	}
+	return s, nil
+}
@@ -0,0 +1,245 @@
+package kafka_consumer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+
+	"telemetry/models"
+	"telemetry/plugin/parsers"
+)
+
+// message is a consumed message whose metrics are not delivered yet.
+type message struct {
+	session sarama.ConsumerGroupSession
+	message *sarama.ConsumerMessage
+}
+
+// partition holds the messages of a partition in the order they were
+// consumed until they are done.
+type partition struct {
+	pending []*sarama.ConsumerMessage
+	done    map[int64]bool
+}
+
+// consumerGroupHandler handles the messages of a consumer group session.
+// The offset of a message is marked, and later committed, only once its
+// metrics and the ones of all previous messages of the partition are written
+// by the outputs. At most maxUndelivered messages are waiting for their
+// delivery.
+type consumerGroupHandler struct {
+	maxUndelivered int
+	maxMessageLen  int
+	topicTag       string
+
+	accumulator models.Accumulator
+	parser      parsers.Parser
+	log         *logrus.Entry
+
+	acc models.TrackingAccumulator
+
+	sem    chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mutex       sync.Mutex
+	undelivered map[models.TrackingID]message
+	partitions  map[string]*partition
+}
+
+func newConsumerGroupHandler(acc models.Accumulator, parser parsers.Parser, log *logrus.Entry) *consumerGroupHandler {
+	return &consumerGroupHandler{
+		maxUndelivered: defaultMaxUndeliveredMessages,
+		accumulator:    acc,
+		parser:         parser,
+		log:            log,
+		undelivered:    make(map[models.TrackingID]message),
+	}
+}
+
+// Setup is called once the session is joined, before the claims are
+// consumed.
+func (h *consumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+	h.acc = models.NewTrackingAccumulator(h.accumulator, h.maxUndelivered)
+	h.sem = make(chan struct{}, h.maxUndelivered)
+	h.partitions = make(map[string]*partition)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		h.run(ctx)
+	}()
+	return nil
+}
+
+func (h *consumerGroupHandler) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case info := <-h.acc.Delivered():
+			h.onDelivery(info)
+		}
+	}
+}
+
+func (h *consumerGroupHandler) onDelivery(info models.DeliveryInfo) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	msg, ok := h.undelivered[info.ID()]
+	if !ok {
+		h.log.Errorf("Could not mark message delivered: %d", info.ID())
+		return
+	}
+
+	h.complete(msg.session, msg.message, info.Delivered())
+	delete(h.undelivered, info.ID())
+	<-h.sem
+}
+
+// track adds a message to the pending messages of its partition, it must
+// be called in the order of the messages.
+func (h *consumerGroupHandler) track(msg *sarama.ConsumerMessage) {
+	key := partitionKey(msg)
+	p, ok := h.partitions[key]
+	if !ok {
+		p = &partition{done: make(map[int64]bool)}
+		h.partitions[key] = p
+	}
+	p.pending = append(p.pending, msg)
+}
+
+// complete marks the messages of the partition up to the first one not
+// done yet, Sarama commits the highest marked offset. A message which was
+// not delivered is done as well: its metrics were dropped by an output, so
+// consuming it again would not deliver them.
+func (h *consumerGroupHandler) complete(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage, delivered bool) {
+	p, ok := h.partitions[partitionKey(msg)]
+	if !ok {
+		return
+	}
+	if !delivered {
+		h.log.Warnf("Metrics of topic %s partition %d offset %d were dropped by an output",
+			msg.Topic, msg.Partition, msg.Offset)
+	}
+	p.done[msg.Offset] = true
+
+	for len(p.pending) > 0 && p.done[p.pending[0].Offset] {
+		first := p.pending[0]
+		delete(p.done, first.Offset)
+		p.pending = p.pending[1:]
+		session.MarkMessage(first, "")
+	}
+}
+
+func partitionKey(msg *sarama.ConsumerMessage) string {
+	return fmt.Sprintf("%s/%d", msg.Topic, msg.Partition)
+}
+
+// reserve waits for a free slot among the undelivered messages.
+func (h *consumerGroupHandler) reserve(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case h.sem <- struct{}{}:
+		return nil
+	}
+}
+
+func (h *consumerGroupHandler) release() {
+	<-h.sem
+}
+
+// ConsumeClaim is called for each partition of the session.
+func (h *consumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+	for {
+		if err := h.reserve(ctx); err != nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			h.release()
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				h.release()
+				return nil
+			}
+			if err := h.handle(session, msg); err != nil {
+				h.acc.AddError(err)
+			}
+		}
+	}
+}
+
+// handle adds the metrics of a message. Messages which cannot be parsed
+// are done right away, they would fail again. The metrics of messages which
+// are only partly parsed are added along with the error.
+func (h *consumerGroupHandler) handle(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) error {
+	h.mutex.Lock()
+	h.track(msg)
+	h.mutex.Unlock()
+
+	if h.maxMessageLen > 0 && len(msg.Value) > h.maxMessageLen {
+		h.skip(session, msg)
+		return fmt.Errorf("message of %d bytes exceeds max_message_len of %d bytes", len(msg.Value), h.maxMessageLen)
+	}
+
+	metrics, err := h.parser.Parse(msg.Value)
+	if err != nil {
+		err = fmt.Errorf("parsing message of topic %s partition %d offset %d failed: %v",
+			msg.Topic, msg.Partition, msg.Offset, err)
+		if len(metrics) == 0 {
+			h.skip(session, msg)
+			return err
+		}
+		h.acc.AddError(err)
+	}
+
+	if h.topicTag != "" {
+		addTag(metrics, h.topicTag, msg.Topic)
+	}
+
+	// The delivery of an empty group is reported right away, the message
+	// must be known by then
+	h.mutex.Lock()
+	id := h.acc.AddTrackingMetricGroup(metrics)
+	h.undelivered[id] = message{session: session, message: msg}
+	h.mutex.Unlock()
+	return nil
+}
+
+// skip completes a message without metrics.
+func (h *consumerGroupHandler) skip(session sarama.ConsumerGroupSession, msg *sarama.ConsumerMessage) {
+	h.mutex.Lock()
+	h.complete(session, msg, true)
+	h.mutex.Unlock()
+	h.release()
+}
+
+// Cleanup is called once all claims are consumed, at the end of the
+// session.
+func (h *consumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	h.cancel()
+	h.wg.Wait()
+	return nil
+}
+
+// addTag adds a tag to all series of the metrics, the metrics keep their
+// type and encoding.
+func addTag(metrics []models.Metric, key, value string) {
+	for _, m := range metrics {
+		if tm, ok := m.(models.TaggedMetric); ok {
+			tm.AddTag(key, value)
+		}
+	}
+}
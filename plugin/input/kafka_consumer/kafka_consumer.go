@@ -0,0 +1,181 @@
+package kafka_consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+
+	"telemetry/internal"
+	"telemetry/models"
+	"telemetry/plugin/common/kafka"
+	"telemetry/plugin/parsers"
+)
+
+const (
+	defaultConsumerGroup          = "telemetry_metrics_consumers"
+	defaultMaxUndeliveredMessages = 1000
+	defaultReconnectDelay         = internal.Duration(5 * time.Second)
+)
+
+// consumerGroupCreator creates the consumer group, tests replace it.
+type consumerGroupCreator func(brokers []string, group string, config *sarama.Config) (sarama.ConsumerGroup, error)
+
+type KafkaConsumer struct {
+	Brokers                []string          `json:"brokers"`
+	Topics                 []string          `json:"topics"`
+	TopicTag               string            `json:"topic_tag"`
+	ConsumerGroup          string            `json:"consumer_group"`
+	Offset                 string            `json:"offset"`
+	BalanceStrategy        string            `json:"balance_strategy"`
+	MaxMessageLen          int               `json:"max_message_len"`
+	MaxUndeliveredMessages int               `json:"max_undelivered_messages"`
+	ReconnectDelay         internal.Duration `json:"reconnect_delay"`
+
+	kafka.ReadConfig
+
+	log *logrus.Entry
+
+	parser         parsers.Parser
+	config         *sarama.Config
+	createConsumer consumerGroupCreator
+
+	consumer sarama.ConsumerGroup
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func NewKafkaConsumer() *KafkaConsumer {
+	return &KafkaConsumer{
+		ConsumerGroup:          defaultConsumerGroup,
+		Offset:                 "oldest",
+		BalanceStrategy:        "range",
+		MaxUndeliveredMessages: defaultMaxUndeliveredMessages,
+		ReconnectDelay:         defaultReconnectDelay,
+		log:                    models.NewLogger("inputs.kafka_consumer"),
+		createConsumer:         sarama.NewConsumerGroup,
+	}
+}
+
+func (k *KafkaConsumer) SetParser(parser parsers.Parser) {
+	k.parser = parser
+}
+
+func (k *KafkaConsumer) Init() error {
+	sarama.Logger = models.NewLogger("inputs.kafka_consumer.sarama")
+
+	if len(k.Brokers) == 0 {
+		return fmt.Errorf("brokers are required")
+	}
+	if len(k.Topics) == 0 {
+		return fmt.Errorf("topics are required")
+	}
+	if k.ConsumerGroup == "" {
+		k.ConsumerGroup = defaultConsumerGroup
+	}
+	if k.MaxUndeliveredMessages <= 0 {
+		k.MaxUndeliveredMessages = defaultMaxUndeliveredMessages
+	}
+	if k.ReconnectDelay <= 0 {
+		k.ReconnectDelay = defaultReconnectDelay
+	}
+
+	config := sarama.NewConfig()
+	if err := k.SetConfig(config, k.log); err != nil {
+		return err
+	}
+
+	switch k.Offset {
+	case "oldest", "":
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	case "newest":
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	default:
+		return fmt.Errorf("invalid offset %q, must be \"oldest\" or \"newest\"", k.Offset)
+	}
+
+	switch k.BalanceStrategy {
+	case "range", "":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRange}
+	case "roundrobin":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategyRoundRobin}
+	case "sticky":
+		config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.BalanceStrategySticky}
+	default:
+		return fmt.Errorf("invalid balance strategy %q, must be \"range\", \"roundrobin\" or \"sticky\"", k.BalanceStrategy)
+	}
+
+	k.config = config
+	return nil
+}
+
+// Start joins the consumer group and consumes the topics until Stop, the
+// session is joined again after rebalances and failures.
+func (k *KafkaConsumer) Start(acc models.Accumulator) error {
+	consumer, err := k.createConsumer(k.Brokers, k.ConsumerGroup, k.config)
+	if err != nil {
+		return err
+	}
+	k.consumer = consumer
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k.cancel = cancel
+
+	k.wg.Add(1)
+	go func() {
+		defer k.wg.Done()
+		for ctx.Err() == nil {
+			handler := newConsumerGroupHandler(acc, k.parser, k.log)
+			handler.maxUndelivered = k.MaxUndeliveredMessages
+			handler.maxMessageLen = k.MaxMessageLen
+			handler.topicTag = k.TopicTag
+
+			// Consume returns at the end of a session, such as a rebalance
+			if err := k.consumer.Consume(ctx, k.Topics, handler); err != nil {
+				acc.AddError(fmt.Errorf("consuming failed: %v", err))
+				//nolint:errcheck // the context is only canceled on Stop
+				internal.SleepContext(ctx, time.Duration(k.ReconnectDelay))
+			}
+		}
+		if err := k.consumer.Close(); err != nil {
+			acc.AddError(fmt.Errorf("closing consumer failed: %v", err))
+		}
+	}()
+
+	k.wg.Add(1)
+	go func() {
+		defer k.wg.Done()
+		for err := range k.consumer.Errors() {
+			acc.AddError(fmt.Errorf("consumer error: %v", err))
+		}
+	}()
+
+	return nil
+}
+
+func (k *KafkaConsumer) Stop() {
+	if k.cancel != nil {
+		k.cancel()
+	}
+	k.wg.Wait()
+}
+
+func (k *KafkaConsumer) Gather(_ models.Accumulator) error {
+	return nil
+}
+
+func (k *KafkaConsumer) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, k)
+	if err != nil {
+		return fmt.Errorf("[kafka_consumer] config error: %v", err)
+	}
+	return nil
+}
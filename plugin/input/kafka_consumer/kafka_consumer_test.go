@@ -0,0 +1,139 @@
+package kafka_consumer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/require"
+
+	"telemetry/internal/testutil"
+	"telemetry/models"
+	"telemetry/plugin/parsers/influx"
+)
+
+type fakeSession struct {
+	ctx context.Context
+
+	mutex  sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32                                        { return nil }
+func (s *fakeSession) MemberID() string                                                  { return "" }
+func (s *fakeSession) GenerationID() int32                                               { return 0 }
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, _ string)  {}
+func (s *fakeSession) Commit()                                                           {}
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, _ string) {}
+func (s *fakeSession) Context() context.Context                                          { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func (s *fakeSession) markedOffsets() []int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]int64(nil), s.marked...)
+}
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "telemetry" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func TestMarkAfterDelivery(t *testing.T) {
+	acc := &testutil.Accumulator{}
+	h := newConsumerGroupHandler(acc, influx.NewParser(), models.NewLogger("test"))
+	h.maxUndelivered = 2
+	h.topicTag = "topic"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, 10)}
+
+	require.NoError(t, h.Setup(session))
+	done := make(chan error)
+	go func() {
+		done <- h.ConsumeClaim(session, claim)
+	}()
+
+	for i := 0; i < 5; i++ {
+		claim.messages <- &sarama.ConsumerMessage{
+			Topic:  "telemetry",
+			Offset: int64(i),
+			Value:  []byte("cpu,source=10.0.0.1 usage=1 1678183200000000000\n"),
+		}
+	}
+
+	// Only max_undelivered messages are consumed before a delivery
+	require.Eventually(t, func() bool { return acc.Count() == 2 }, time.Second, 10*time.Millisecond)
+	require.Never(t, func() bool { return acc.Count() > 2 }, 100*time.Millisecond, 10*time.Millisecond)
+	require.Empty(t, session.markedOffsets())
+
+	series := acc.Metric(0).(models.SeriesMetric).Series()
+	require.Equal(t, map[string]string{"source": "10.0.0.1", "topic": "telemetry"}, series[0].Tags)
+
+	acc.Metric(0).(models.DeliveryMetric).Accept()
+	require.Eventually(t, func() bool { return acc.Count() == 3 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, []int64{0}, session.markedOffsets())
+
+	// Offsets are marked in order, a dropped message is done as well
+	acc.Metric(2).(models.DeliveryMetric).Accept()
+	require.Never(t, func() bool { return len(session.markedOffsets()) > 1 }, 100*time.Millisecond, 10*time.Millisecond)
+	acc.Metric(1).(models.DeliveryMetric).Drop()
+	require.Eventually(t, func() bool { return len(session.markedOffsets()) == 3 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, []int64{0, 1, 2}, session.markedOffsets())
+
+	// The messages after the dropped one are marked once delivered
+	require.Eventually(t, func() bool { return acc.Count() == 5 }, time.Second, 10*time.Millisecond)
+	acc.Metric(3).(models.DeliveryMetric).Accept()
+	acc.Metric(4).(models.DeliveryMetric).Accept()
+	require.Eventually(t, func() bool { return len(session.markedOffsets()) == 5 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, []int64{0, 1, 2, 3, 4}, session.markedOffsets())
+
+	cancel()
+	require.NoError(t, <-done)
+	require.NoError(t, h.Cleanup(session))
+}
+
+func TestMarkInvalidMessages(t *testing.T) {
+	acc := &testutil.Accumulator{}
+	h := newConsumerGroupHandler(acc, influx.NewParser(), models.NewLogger("test"))
+	h.maxMessageLen = 64
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	require.NoError(t, h.Setup(session))
+
+	require.NoError(t, h.reserve(ctx))
+	require.Error(t, h.handle(session, &sarama.ConsumerMessage{Offset: 0, Value: []byte("not line protocol")}))
+	require.NoError(t, h.reserve(ctx))
+	require.Error(t, h.handle(session, &sarama.ConsumerMessage{Offset: 1, Value: make([]byte, 65)}))
+
+	require.Equal(t, []int64{0, 1}, session.markedOffsets())
+	require.Empty(t, acc.Metrics())
+	require.NoError(t, h.Cleanup(session))
+}
+
+func TestAddTag(t *testing.T) {
+	metrics, err := influx.NewParser().Parse([]byte("cpu,source=10.0.0.1 usage=1 1678183200000000000\n"))
+	require.NoError(t, err)
+	original := metrics[0].(models.SeriesMetric).Series()[0].Tags
+
+	addTag(metrics, "topic", "telemetry")
+	series := metrics[0].(models.SeriesMetric).Series()
+	require.Equal(t, map[string]string{"source": "10.0.0.1", "topic": "telemetry"}, series[0].Tags)
+	require.Equal(t, map[string]string{"source": "10.0.0.1"}, original)
+}
@@ -0,0 +1,545 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"telemetry/internal"
+	"telemetry/models"
+	"telemetry/plugin/common/tls"
+)
+
+const (
+	defaultURL       = "http://localhost:9200"
+	defaultIndexName = "telemetry-{name}-%Y.%m.%d"
+	defaultTemplate  = "telemetry"
+	defaultTimeout   = internal.Duration(5 * time.Second)
+
+	maxErrMsgLen = 1024
+)
+
+type Elasticsearch struct {
+	URLs                []string          `json:"urls"`
+	IndexName           string            `json:"index_name"`
+	Username            string            `json:"username"`
+	Password            string            `json:"password"`
+	APIKey              string            `json:"api_key"`
+	Timeout             internal.Duration `json:"timeout"`
+	EnableGzip          bool              `json:"enable_gzip"`
+	HTTPHeaders         map[string]string `json:"http_headers"`
+	ForceDocumentID     bool              `json:"force_document_id"`
+	ManageTemplate      bool              `json:"manage_template"`
+	TemplateName        string            `json:"template_name"`
+	OverwriteTemplate   bool              `json:"overwrite_template"`
+	DefaultPipeline     string            `json:"pipeline"`
+	NumberOfShards      int               `json:"number_of_shards"`
+	NumberOfReplicas    int               `json:"number_of_replicas"`
+	TotalFieldsLimit    int               `json:"total_fields_limit"`
+	RefreshIntervalSecs int               `json:"refresh_interval"`
+
+	tls.ClientConfig
+
+	log *logrus.Entry
+
+	client       *http.Client
+	majorVersion int
+	opensearch   bool
+}
+
+// bulkResponse is the part of the _bulk response needed to find the
+// documents which were not indexed.
+type bulkResponse struct {
+	Errors bool                  `json:"errors"`
+	Items  []map[string]bulkItem `json:"items"`
+}
+
+// bulkItem is the result of a single action of a bulk request.
+type bulkItem struct {
+	Index  string          `json:"_index"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+func NewElasticsearch() *Elasticsearch {
+	return &Elasticsearch{
+		IndexName:           defaultIndexName,
+		Timeout:             defaultTimeout,
+		ForceDocumentID:     true,
+		ManageTemplate:      true,
+		TemplateName:        defaultTemplate,
+		NumberOfShards:      1,
+		TotalFieldsLimit:    5000,
+		RefreshIntervalSecs: 10,
+		log:                 models.NewLogger("outputs.elasticsearch"),
+	}
+}
+
+func (e *Elasticsearch) Init() error {
+	if len(e.URLs) == 0 {
+		e.URLs = []string{defaultURL}
+	}
+	for _, u := range e.URLs {
+		if _, err := url.Parse(u); err != nil {
+			return fmt.Errorf("invalid url %q: %v", u, err)
+		}
+	}
+	if e.IndexName == "" {
+		return fmt.Errorf("index_name is required")
+	}
+	if e.ManageTemplate && e.TemplateName == "" {
+		return fmt.Errorf("template_name is required with manage_template")
+	}
+	if e.APIKey != "" && (e.Username != "" || e.Password != "") {
+		return fmt.Errorf("only one of api_key and username/password can be set")
+	}
+	if e.Timeout <= 0 {
+		e.Timeout = defaultTimeout
+	}
+	return nil
+}
+
+func (e *Elasticsearch) Connect() error {
+	tlsConfig, err := e.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+	e.client = &http.Client{
+		Timeout: time.Duration(e.Timeout),
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	if err := e.detectVersion(); err != nil {
+		return err
+	}
+	if e.ManageTemplate {
+		return e.manageTemplate()
+	}
+	return nil
+}
+
+func (e *Elasticsearch) Close() error {
+	if e.client != nil {
+		e.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Write indexes one document per series with the bulk API. Documents
+// rejected by Elasticsearch are logged, the metrics whose documents were all
+// rejected are dropped. Only the metrics of the documents which failed
+// temporarily are written again.
+func (e *Elasticsearch) Write(metrics []models.Metric) error {
+	var body bytes.Buffer
+	// docs holds the index of the metric of every document
+	var docs []int
+	for i, metric := range metrics {
+		sm, ok := metric.(models.SeriesMetric)
+		if !ok {
+			e.log.Debugf("Could not convert metric of type %T", metric)
+			continue
+		}
+		for _, series := range sm.Series() {
+			if err := e.writeDocument(&body, series); err != nil {
+				e.log.Errorf("Could not encode series %q: %v", series.Name, err)
+				continue
+			}
+			docs = append(docs, i)
+		}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	var err error
+	for _, u := range e.URLs {
+		err = e.bulk(u, body.Bytes(), docs)
+		if err == nil {
+			return nil
+		}
+		var perr *models.PermanentError
+		var pwerr *models.PartialWriteError
+		if errors.As(err, &perr) || errors.As(err, &pwerr) {
+			return err
+		}
+		e.log.Errorf("When writing to [%s]: %v", u, err)
+	}
+	return err
+}
+
+// writeDocument appends the action and the document of a series to the
+// bulk body.
+func (e *Elasticsearch) writeDocument(buf *bytes.Buffer, series models.Series) error {
+	series.Time = timeOrNow(series.Time)
+
+	doc := map[string]any{
+		"@timestamp": series.Time.UTC().Format(time.RFC3339Nano),
+		"name":       series.Name,
+		"tags":       series.Tags,
+		"fields":     series.Fields,
+	}
+	if len(series.Header) > 0 {
+		doc["header"] = series.Header
+	}
+	source, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	action := map[string]string{"_index": indexName(e.IndexName, series)}
+	if e.ForceDocumentID {
+		action["_id"] = documentID(series)
+	}
+	if e.DefaultPipeline != "" {
+		action["pipeline"] = e.DefaultPipeline
+	}
+	meta, err := json.Marshal(map[string]any{"index": action})
+	if err != nil {
+		return err
+	}
+
+	buf.Write(meta)
+	buf.WriteByte('\n')
+	buf.Write(source)
+	buf.WriteByte('\n')
+	return nil
+}
+
+// bulk sends the documents, docs holds the index of the metric of every
+// document. The metrics of the documents which failed temporarily, and the
+// ones whose documents were all rejected, are returned in a
+// PartialWriteError.
+func (e *Elasticsearch) bulk(u string, body []byte, docs []int) error {
+	resp, err := e.request(http.MethodPost, u, "/_bulk", body, "application/x-ndjson")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, b)
+	}
+
+	var br bulkResponse
+	if err := json.Unmarshal(b, &br); err != nil {
+		return fmt.Errorf("decoding bulk response failed: %v", err)
+	}
+	if !br.Errors {
+		return nil
+	}
+
+	var rejected, retryable int
+	// The rejected documents of the metrics, and the ones to write again
+	rejectedDocs := make(map[int]int)
+	retry := make(map[int]bool)
+	for i, item := range br.Items {
+		for _, result := range item {
+			if result.Status < 300 || i >= len(docs) {
+				continue
+			}
+			if retryableStatus(result.Status) {
+				retryable++
+				retry[docs[i]] = true
+				continue
+			}
+			rejected++
+			rejectedDocs[docs[i]]++
+			e.log.Errorf("Document rejected by index %q with status %d: %s", result.Index, result.Status, result.Error)
+		}
+	}
+
+	// The other documents of a metric written again are overwritten if
+	// they have a fixed ID
+	total := make(map[int]int)
+	for _, m := range docs {
+		total[m]++
+	}
+	var failed, dropped []int
+	for i, m := range docs {
+		if i > 0 && docs[i-1] == m {
+			continue
+		}
+		if retry[m] {
+			failed = append(failed, m)
+		} else if rejectedDocs[m] == total[m] {
+			dropped = append(dropped, m)
+		}
+	}
+	if len(failed) == 0 && len(dropped) == 0 {
+		if rejected > 0 {
+			e.log.Warnf("Dropped %d of %d documents", rejected, len(br.Items))
+		}
+		return nil
+	}
+	return &models.PartialWriteError{
+		Err:     fmt.Errorf("%d documents failed temporarily, %d rejected", retryable, rejected),
+		Failed:  failed,
+		Dropped: dropped,
+	}
+}
+
+func (e *Elasticsearch) request(method, base, path string, body []byte, contentType string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+		if e.EnableGzip {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			if _, err := gz.Write(body); err != nil {
+				return nil, err
+			}
+			if err := gz.Close(); err != nil {
+				return nil, err
+			}
+			reader = &buf
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.Timeout))
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(base, "/")+path, reader)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+		if e.EnableGzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	req.Header.Set("User-Agent", "telemetry")
+	if e.Username != "" || e.Password != "" {
+		req.SetBasicAuth(e.Username, e.Password)
+	}
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+e.APIKey)
+	}
+	for k, v := range e.HTTPHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases the context of a request when its body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// detectVersion reads the major version of the first reachable server to
+// select the template API.
+func (e *Elasticsearch) detectVersion() error {
+	var err error
+	for _, u := range e.URLs {
+		var resp *http.Response
+		resp, err = e.request(http.MethodGet, u, "/", nil, "")
+		if err != nil {
+			continue
+		}
+
+		var info struct {
+			Version struct {
+				Number       string `json:"number"`
+				Distribution string `json:"distribution"`
+			} `json:"version"`
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = statusError(resp, b)
+			continue
+		}
+		if err = json.Unmarshal(b, &info); err != nil {
+			continue
+		}
+
+		e.opensearch = info.Version.Distribution == "opensearch"
+		major, _, _ := strings.Cut(info.Version.Number, ".")
+		e.majorVersion, err = strconv.Atoi(major)
+		if err != nil {
+			err = fmt.Errorf("invalid version %q", info.Version.Number)
+			continue
+		}
+		e.log.Infof("Connected to %s version %s", distribution(e.opensearch), info.Version.Number)
+		return nil
+	}
+	return fmt.Errorf("connecting to Elasticsearch failed: %v", err)
+}
+
+// manageTemplate creates the index template for the indices of the output,
+// an existing template is only replaced with overwrite_template.
+func (e *Elasticsearch) manageTemplate() error {
+	u := e.URLs[0]
+
+	// Legacy templates are deprecated since Elasticsearch 8, composable ones
+	// are used with it and with OpenSearch
+	composable := e.opensearch || e.majorVersion >= 8
+	path := "/_template/" + url.PathEscape(e.TemplateName)
+	if composable {
+		path = "/_index_template/" + url.PathEscape(e.TemplateName)
+	}
+
+	resp, err := e.request(http.MethodHead, u, path, nil, "")
+	if err != nil {
+		return fmt.Errorf("checking template failed: %v", err)
+	}
+	resp.Body.Close()
+	exists := resp.StatusCode == http.StatusOK
+	if exists && !e.OverwriteTemplate {
+		e.log.Debugf("Template %q exists, not overwriting it", e.TemplateName)
+		return nil
+	}
+
+	body, err := json.Marshal(e.template(composable))
+	if err != nil {
+		return err
+	}
+	resp, err = e.request(http.MethodPut, u, path, body, "application/json")
+	if err != nil {
+		return fmt.Errorf("creating template failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("creating template failed: %v", statusError(resp, b))
+	}
+	e.log.Infof("Template %q created or updated", e.TemplateName)
+	return nil
+}
+
+func (e *Elasticsearch) template(composable bool) map[string]any {
+	settings := map[string]any{
+		"index": map[string]any{
+			"number_of_shards":           e.NumberOfShards,
+			"number_of_replicas":         e.NumberOfReplicas,
+			"refresh_interval":           strconv.Itoa(e.RefreshIntervalSecs) + "s",
+			"mapping.total_fields.limit": e.TotalFieldsLimit,
+		},
+	}
+	mappings := map[string]any{
+		"properties": map[string]any{
+			"@timestamp": map[string]any{"type": "date"},
+			"name":       map[string]any{"type": "keyword"},
+		},
+		"dynamic_templates": []any{
+			map[string]any{"tags": map[string]any{
+				"path_match":         "tags.*",
+				"match_mapping_type": "string",
+				"mapping":            map[string]any{"type": "keyword"},
+			}},
+			map[string]any{"strings": map[string]any{
+				"match_mapping_type": "string",
+				"mapping":            map[string]any{"type": "keyword", "ignore_above": 1024},
+			}},
+		},
+	}
+
+	patterns := []string{indexPattern(e.IndexName)}
+	if composable {
+		return map[string]any{
+			"index_patterns": patterns,
+			"priority":       100,
+			"template": map[string]any{
+				"settings": settings,
+				"mappings": mappings,
+			},
+		}
+	}
+	return map[string]any{
+		"index_patterns": patterns,
+		"order":          0,
+		"settings":       settings,
+		"mappings":       mappings,
+	}
+}
+
+// documentID is derived from the name, tags and time of a series so that
+// writing a batch again replaces the documents already indexed.
+func documentID(series models.Series) string {
+	keys := make([]string, 0, len(series.Tags))
+	for k := range series.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	h.Write([]byte(series.Name))
+	for _, k := range keys {
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(series.Tags[k]))
+	}
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatInt(series.Time.UnixNano(), 10)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+func statusError(resp *http.Response, body []byte) error {
+	if len(body) > maxErrMsgLen {
+		body = body[:maxErrMsgLen]
+	}
+	err := fmt.Errorf("received status %s: %s", resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode >= 400 && !retryableStatus(resp.StatusCode) && resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusForbidden {
+		return &models.PermanentError{Err: err}
+	}
+	return err
+}
+
+func distribution(opensearch bool) string {
+	if opensearch {
+		return "OpenSearch"
+	}
+	return "Elasticsearch"
+}
+
+func (e *Elasticsearch) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, e)
+	if err != nil {
+		return fmt.Errorf("[elasticsearch] config error: %v", err)
+	}
+	return nil
+}
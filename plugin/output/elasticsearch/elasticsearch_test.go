@@ -0,0 +1,190 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+)
+
+func newTestMetric() models.Metric {
+	t := time.Date(2023, 3, 7, 10, 0, 0, 0, time.UTC)
+	return models.NewSeriesMetric([]models.Series{
+		{
+			Name:   "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+			Tags:   map[string]string{"source": "10.0.0.1", "interface_name": "Gi0/0/0/0"},
+			Fields: map[string]any{"bytes_received": int64(10)},
+			Time:   t,
+		},
+		{
+			Name:   "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+			Tags:   map[string]string{"source": "10.0.0.1", "interface_name": "Gi0/0/0/1"},
+			Fields: map[string]any{"bytes_received": int64(20)},
+			Time:   t,
+		},
+	}...)
+}
+
+// stubServer answers like Elasticsearch 8, the bulk items get the statuses
+// in order.
+type stubServer struct {
+	mutex     sync.Mutex
+	template  map[string]any
+	indices   []string
+	ids       []string
+	statuses  []int
+	templates bool
+}
+
+func (s *stubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/":
+		w.Write([]byte(`{"version":{"number":"8.6.2"}}`))
+	case r.Method == http.MethodHead && r.URL.Path == "/_index_template/telemetry":
+		if !s.templates {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut && r.URL.Path == "/_index_template/telemetry":
+		s.templates = true
+		json.NewDecoder(r.Body).Decode(&s.template)
+		w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+		var resp bulkResponse
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			if json.Unmarshal(scanner.Bytes(), &action) != nil || action["index"] == nil {
+				continue
+			}
+			index := action["index"]["_index"]
+			s.indices = append(s.indices, index)
+			s.ids = append(s.ids, action["index"]["_id"])
+
+			item := bulkItem{Index: index, Status: http.StatusCreated}
+			if len(s.statuses) > 0 {
+				item.Status, s.statuses = s.statuses[0], s.statuses[1:]
+			}
+			if item.Status >= 300 {
+				resp.Errors = true
+				item.Error = json.RawMessage(`{"type":"mapper_parsing_exception"}`)
+			}
+			resp.Items = append(resp.Items, map[string]bulkItem{"index": item})
+		}
+		json.NewEncoder(w).Encode(resp)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestOutput(t *testing.T, stub *stubServer) *Elasticsearch {
+	ts := httptest.NewServer(stub)
+	t.Cleanup(ts.Close)
+
+	e := NewElasticsearch()
+	e.URLs = []string{ts.URL}
+	require.NoError(t, e.Init())
+	require.NoError(t, e.Connect())
+	return e
+}
+
+func TestConnectCreatesTemplate(t *testing.T) {
+	stub := &stubServer{}
+	newTestOutput(t, stub)
+
+	require.True(t, stub.templates)
+	require.Equal(t, []any{"telemetry-*"}, stub.template["index_patterns"])
+	require.Contains(t, stub.template, "template")
+}
+
+func TestWrite(t *testing.T) {
+	stub := &stubServer{}
+	e := newTestOutput(t, stub)
+
+	require.NoError(t, e.Write([]models.Metric{newTestMetric()}))
+	index := "telemetry-cisco-ios-xr-infra-statsd-oper_infra-statistics_interfaces_interface_latest_generic-counters-2023.03.07"
+	require.Equal(t, []string{index, index}, stub.indices)
+	require.NotEqual(t, stub.ids[0], stub.ids[1])
+
+	// Writing the batch again indexes the same documents
+	require.NoError(t, e.Write([]models.Metric{newTestMetric()}))
+	require.Equal(t, stub.ids[:2], stub.ids[2:])
+}
+
+func TestWriteDropsRejectedDocuments(t *testing.T) {
+	stub := &stubServer{}
+	e := newTestOutput(t, stub)
+
+	stub.statuses = []int{http.StatusBadRequest, http.StatusCreated}
+	require.NoError(t, e.Write([]models.Metric{newTestMetric()}))
+
+	// The metrics whose documents were all rejected are dropped
+	stub.statuses = []int{http.StatusBadRequest, http.StatusBadRequest, http.StatusCreated, http.StatusBadRequest}
+	err := e.Write([]models.Metric{newTestMetric(), newTestMetric()})
+	var pwerr *models.PartialWriteError
+	require.True(t, errors.As(err, &pwerr))
+	require.Empty(t, pwerr.Failed)
+	require.Equal(t, []int{0}, pwerr.Dropped)
+
+	// Only the metrics of the documents which failed temporarily are
+	// written again
+	stub.statuses = []int{http.StatusCreated, http.StatusCreated, http.StatusBadRequest, http.StatusTooManyRequests,
+		http.StatusCreated, http.StatusServiceUnavailable}
+	err = e.Write([]models.Metric{newTestMetric(), newTestMetric(), newTestMetric()})
+	require.True(t, errors.As(err, &pwerr))
+	require.Equal(t, []int{1, 2}, pwerr.Failed)
+	require.Empty(t, pwerr.Dropped)
+	var perr *models.PermanentError
+	require.False(t, errors.As(err, &perr))
+}
+
+func TestIndexName(t *testing.T) {
+	path := "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters"
+	series := models.Series{
+		Name:   "generic_counters",
+		Tags:   map[string]string{"source": "10.0.0.1", "node_id": "R1"},
+		Header: map[string]any{"encoding_path": path},
+		Time:   time.Date(2023, 3, 7, 10, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		template string
+		series   models.Series
+		expected string
+	}{
+		{
+			template: "telemetry-{name}-%Y.%m.%d",
+			series:   series,
+			expected: "telemetry-generic_counters-2023.03.07",
+		},
+		{
+			template: "telemetry-{encoding_path}-%Y.%V",
+			series:   series,
+			expected: "telemetry-cisco-ios-xr-infra-statsd-oper_infra-statistics_interfaces_interface_latest_generic-counters-2023.10",
+		},
+		{
+			template: "telemetry-{encoding_path}",
+			series:   models.Series{Name: "cpu"},
+			expected: "telemetry-cpu",
+		},
+		{
+			template: "_{node_id}-{missing}-%H",
+			series:   series,
+			expected: "r1--10",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			require.Equal(t, tt.expected, indexName(tt.template, tt.series))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"telemetry/models"
+)
+
+// Index names are limited to 255 bytes
+const maxIndexLen = 255
+
+var (
+	// placeholderRe matches the {name} and {tag} placeholders of the index.
+	placeholderRe = regexp.MustCompile(`\{([^{}]+)\}`)
+
+	indexEscaper = strings.NewReplacer(
+		`\`, "_", "/", "_", "*", "_", "?", "_", `"`, "_", "<", "_", ">", "_",
+		"|", "_", " ", "_", ",", "_", "#", "_", ":", "_",
+	)
+)
+
+// indexName expands the index template for a series. {name} is replaced with
+// the series name, {encoding_path} with the encoding path of Cisco MDT
+// metrics, which is also the name unless the series is named after an
+// alias, other placeholders with the tag of the same name, and the date
+// directives %Y, %y, %m, %d, %H and %V (ISO week) with the time of the
+// series in UTC.
+func indexName(template string, series models.Series) string {
+	index := placeholderRe.ReplaceAllStringFunc(template, func(s string) string {
+		switch key := s[1 : len(s)-1]; key {
+		case "name":
+			return indexEscaper.Replace(series.Name)
+		case "encoding_path":
+			if path, ok := series.Header["encoding_path"].(string); ok {
+				return indexEscaper.Replace(path)
+			}
+			return indexEscaper.Replace(series.Name)
+		default:
+			return indexEscaper.Replace(series.Tags[key])
+		}
+	})
+
+	if strings.Contains(index, "%") {
+		t := series.Time.UTC()
+		_, week := t.ISOWeek()
+		index = strings.NewReplacer(
+			"%Y", t.Format("2006"),
+			"%y", t.Format("06"),
+			"%m", t.Format("01"),
+			"%d", t.Format("02"),
+			"%H", t.Format("15"),
+			"%V", fmt.Sprintf("%02d", week),
+		).Replace(index)
+	}
+
+	index = strings.TrimLeft(strings.ToLower(index), "-_+")
+	if len(index) > maxIndexLen {
+		index = index[:maxIndexLen]
+	}
+	return index
+}
+
+// indexPattern returns the pattern matching all indices of the template,
+// it is the template up to the first placeholder or date directive.
+func indexPattern(template string) string {
+	if i := strings.IndexAny(template, "{%"); i >= 0 {
+		template = template[:i]
+	}
+	return strings.ToLower(template) + "*"
+}
+
+// timeOrNow is the time of the series, or now for series without time.
+func timeOrNow(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
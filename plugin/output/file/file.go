@@ -1,6 +1,7 @@
 package file
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 
 	"telemetry/models"
 	"telemetry/plugin/serializers"
+	"telemetry/plugin/serializers/prometheus"
 )
 
 type File struct {
@@ -18,12 +20,23 @@ type File struct {
 	RotationInterval    Duration `json:"rotation_interval"`
 	RotationMaxSize     Size     `json:"rotation_max_size"`
 	RotationMaxArchives int      `json:"rotation_max_archives"`
+	UseBatchFormat      bool     `json:"use_batch_format"`
+	Overwrite           bool     `json:"overwrite"`
+
+	// Time after which the series of the prometheus format are removed
+	// when they are not written again
+	ExpirationInterval Duration `json:"expiration_interval"`
 
 	log *logrus.Entry
 
 	writer     io.Writer
 	closers    []io.Closer
 	serializer serializers.Serializer
+
+	// collection holds the series of the prometheus format across the
+	// batches of the flushes
+	collection  *prometheus.Collection
+	openMetrics bool
 }
 
 func (f *File) SetSerializer(serializer serializers.Serializer) {
@@ -32,8 +45,35 @@ func (f *File) SetSerializer(serializer serializers.Serializer) {
 
 func NewFile() *File {
 	return &File{
-		log: models.NewLogger("outputs.file"),
+		ExpirationInterval: Duration(60 * time.Second),
+		log:                models.NewLogger("outputs.file"),
+	}
+}
+
+// Init collects the series of the prometheus format, whose families must be
+// written once for all the batches, so the file must be overwritten with the
+// whole collection. The batch format is forced when overwriting, which must
+// write a whole batch at once to keep more than its last metric.
+func (f *File) Init() error {
+	if s, ok := f.serializer.(*prometheus.Serializer); ok {
+		if !f.Overwrite {
+			return fmt.Errorf("the prometheus data format requires overwrite, appending would repeat its metric families")
+		}
+		f.collection = s.NewCollection()
+		f.openMetrics = s.OpenMetrics
+		return nil
+	}
+	if f.UseBatchFormat {
+		return nil
+	}
+	if _, ok := f.serializer.(serializers.BatchSerializer); ok {
+		f.log.Infof("Using the batch format required by the data format")
+		f.UseBatchFormat = true
+	} else if f.Overwrite {
+		f.log.Infof("Using the batch format required by overwrite")
+		f.UseBatchFormat = true
 	}
+	return nil
 }
 
 func (f *File) Connect() error {
@@ -46,6 +86,8 @@ func (f *File) Connect() error {
 	for _, file := range f.Files {
 		if file == "stdout" {
 			writers = append(writers, os.Stdout)
+		} else if f.Overwrite {
+			writers = append(writers, NewOverwriteWriter(file))
 		} else {
 			of, err := NewFileWriter(file, time.Duration(f.RotationInterval), int64(f.RotationMaxSize), f.RotationMaxArchives)
 			if err != nil {
@@ -72,6 +114,22 @@ func (f *File) Close() error {
 }
 
 func (f *File) Write(metrics []models.Metric) error {
+	if f.collection != nil {
+		return f.writeCollection(metrics)
+	}
+	if f.UseBatchFormat {
+		b, err := f.serializeBatch(metrics)
+		if err != nil {
+			return fmt.Errorf("failed to serialize message: %v", err)
+		}
+
+		_, err = f.writer.Write(b)
+		if err != nil {
+			return fmt.Errorf("failed to write message: %v", err)
+		}
+		return nil
+	}
+
 	var writeErr error
 	for _, metric := range metrics {
 		b, err := f.serializer.Serialize(metric)
@@ -88,6 +146,51 @@ func (f *File) Write(metrics []models.Metric) error {
 	return writeErr
 }
 
+// writeCollection adds the metrics to the collection and writes all of its
+// series, the ones of previous batches included until they expire.
+func (f *File) writeCollection(metrics []models.Metric) error {
+	now := time.Now()
+	for _, metric := range metrics {
+		sm, ok := metric.(models.SeriesMetric)
+		if !ok {
+			f.log.Debugf("Could not serialize metric of type %T", metric)
+			continue
+		}
+		for _, series := range sm.Series() {
+			f.collection.Add(series, now)
+		}
+	}
+	if f.ExpirationInterval > 0 {
+		f.collection.Expire(now.Add(-time.Duration(f.ExpirationInterval)))
+	}
+
+	var buf bytes.Buffer
+	f.collection.Write(&buf, f.openMetrics)
+	if _, err := f.writer.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write message: %v", err)
+	}
+	return nil
+}
+
+// serializeBatch serializes the metrics together, serializers without a
+// batch format have their metrics concatenated.
+func (f *File) serializeBatch(metrics []models.Metric) ([]byte, error) {
+	if s, ok := f.serializer.(serializers.BatchSerializer); ok {
+		return s.SerializeBatch(metrics)
+	}
+
+	var buf []byte
+	for _, metric := range metrics {
+		b, err := f.serializer.Serialize(metric)
+		if err != nil {
+			f.log.Debugf("Could not serialize metric: %v", err)
+			continue
+		}
+		buf = append(buf, b...)
+	}
+	return buf, nil
+}
+
 func (f *File) ParseConfig(cfg map[string]any) error {
 	tmp, err := json.Marshal(cfg)
 	if err != nil {
@@ -0,0 +1,116 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+	"telemetry/plugin/serializers/influx"
+	"telemetry/plugin/serializers/prometheus"
+)
+
+func newTestMetric(source string) models.Metric {
+	return models.NewSeriesMetric(models.Series{
+		Name:   "cpu",
+		Tags:   map[string]string{"source": source},
+		Fields: map[string]any{"value": 1.5},
+		Time:   time.Unix(0, 42),
+	})
+}
+
+func TestOverwriteWriter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.prom")
+	w := NewOverwriteWriter(filename)
+
+	for _, content := range []string{"first\nbatch\n", "second\n"} {
+		n, err := w.Write([]byte(content))
+		require.NoError(t, err)
+		require.Equal(t, len(content), n)
+
+		data, err := os.ReadFile(filename)
+		require.NoError(t, err)
+		require.Equal(t, content, string(data))
+	}
+	_, err := os.Stat(filename + ".tmp")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestWriteOverwriteKeepsBatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.txt")
+	f := NewFile()
+	f.Files = []string{filename}
+	f.Overwrite = true
+	f.SetSerializer(influx.NewSerializer(false))
+	require.NoError(t, f.Init())
+	require.True(t, f.UseBatchFormat)
+	require.NoError(t, f.Connect())
+	defer f.Close()
+
+	require.NoError(t, f.Write([]models.Metric{newTestMetric("r1"), newTestMetric("r2")}))
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+func TestWritePrometheusFamiliesOnce(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.prom")
+	serializer, err := prometheus.NewSerializer(false, true, nil, nil)
+	require.NoError(t, err)
+
+	f := NewFile()
+	f.Files = []string{filename}
+	f.Overwrite = true
+	f.SetSerializer(serializer)
+	require.NoError(t, f.Init())
+	require.NoError(t, f.Connect())
+	defer f.Close()
+
+	// The series of all batches of a flush are kept
+	require.NoError(t, f.Write([]models.Metric{newTestMetric("r1"), newTestMetric("r2")}))
+	require.NoError(t, f.Write([]models.Metric{newTestMetric("r3")}))
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.Equal(t, "# HELP cpu Telemetry field value of cpu\n"+
+		"# TYPE cpu gauge\n"+
+		"cpu{source=\"r1\"} 1.5\n"+
+		"cpu{source=\"r2\"} 1.5\n"+
+		"cpu{source=\"r3\"} 1.5\n"+
+		"# EOF\n", string(data))
+}
+
+func TestWritePrometheusExpiration(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.prom")
+	serializer, err := prometheus.NewSerializer(false, false, nil, nil)
+	require.NoError(t, err)
+
+	f := NewFile()
+	f.Files = []string{filename}
+	f.Overwrite = true
+	f.ExpirationInterval = Duration(50 * time.Millisecond)
+	f.SetSerializer(serializer)
+	require.NoError(t, f.Init())
+	require.NoError(t, f.Connect())
+	defer f.Close()
+
+	require.NoError(t, f.Write([]models.Metric{newTestMetric("r1")}))
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, f.Write([]models.Metric{newTestMetric("r2")}))
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "r1")
+	require.Contains(t, string(data), `cpu{source="r2"} 1.5`)
+}
+
+func TestPrometheusRequiresOverwrite(t *testing.T) {
+	serializer, err := prometheus.NewSerializer(false, false, nil, nil)
+	require.NoError(t, err)
+
+	f := NewFile()
+	f.SetSerializer(serializer)
+	require.Error(t, f.Init())
+}
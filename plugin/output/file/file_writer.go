@@ -176,3 +176,31 @@ func (w *FileWriter) purgeArchivesIfNeeded() (err error) {
 	}
 	return nil
 }
+
+// OverwriteWriter implements the io.Writer interface and replaces the content
+// of filename on every write. The content is written to a temporary file
+// first and renamed, so readers never see a partially written file.
+type OverwriteWriter struct {
+	filename string
+	sync.Mutex
+}
+
+// NewOverwriteWriter creates a new overwrite writer.
+func NewOverwriteWriter(filename string) *OverwriteWriter {
+	return &OverwriteWriter{filename: filename}
+}
+
+// Write replaces the content of the file with p.
+func (w *OverwriteWriter) Write(p []byte) (n int, err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	tmp := w.filename + ".tmp"
+	if err = os.WriteFile(tmp, p, FilePerm); err != nil {
+		return 0, err
+	}
+	if err = os.Rename(tmp, w.filename); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
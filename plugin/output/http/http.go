@@ -0,0 +1,350 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+
+	"telemetry/models"
+	httpconfig "telemetry/plugin/common/http"
+	"telemetry/plugin/serializers"
+)
+
+const (
+	defaultURL    = "http://127.0.0.1:8080/telemetry"
+	defaultMethod = http.MethodPost
+
+	maxErrMsgLen = 1024
+)
+
+// placeholderRe matches the {tag} placeholders of the url template.
+var placeholderRe = regexp.MustCompile(`\{([^{}]+)\}`)
+
+type HTTP struct {
+	URL                     string            `json:"url"`
+	Method                  string            `json:"method"`
+	Headers                 map[string]string `json:"headers"`
+	Username                string            `json:"username"`
+	Password                string            `json:"password"`
+	Token                   string            `json:"token"`
+	ContentEncoding         string            `json:"content_encoding"`
+	UseBatchFormat          bool              `json:"use_batch_format"`
+	RetryableStatusCodes    []int             `json:"retryable_status_codes"`
+	NonRetryableStatusCodes []int             `json:"non_retryable_status_codes"`
+
+	httpconfig.HTTPClientConfig
+
+	log *logrus.Entry
+
+	client     *http.Client
+	serializer serializers.Serializer
+	encoder    *zstd.Encoder
+}
+
+// StatusError is an error returned for responses with a non 2xx status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("when writing to [%s] received status code: %d, body: %s", e.URL, e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("when writing to [%s] received status code: %d", e.URL, e.StatusCode)
+}
+
+func NewHTTP() *HTTP {
+	return &HTTP{
+		Method:          defaultMethod,
+		ContentEncoding: "identity",
+		UseBatchFormat:  true,
+		log:             models.NewLogger("outputs.http"),
+	}
+}
+
+func (h *HTTP) SetSerializer(serializer serializers.Serializer) {
+	h.serializer = serializer
+}
+
+func (h *HTTP) Init() error {
+	if h.URL == "" {
+		h.URL = defaultURL
+	}
+	if _, err := url.Parse(placeholderRe.ReplaceAllString(h.URL, "x")); err != nil {
+		return fmt.Errorf("invalid url %q: %v", h.URL, err)
+	}
+
+	h.Method = strings.ToUpper(h.Method)
+	switch h.Method {
+	case "":
+		h.Method = defaultMethod
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("invalid method [%s] %s", h.URL, h.Method)
+	}
+
+	switch h.ContentEncoding {
+	case "", "identity", "gzip":
+	case "zstd":
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return err
+		}
+		h.encoder = encoder
+	default:
+		return fmt.Errorf("invalid content encoding: %s", h.ContentEncoding)
+	}
+
+	if h.Token != "" && (h.Username != "" || h.Password != "") {
+		return fmt.Errorf("only one of token and username/password can be set")
+	}
+	if h.Token != "" && h.OAuth2Config.Enabled() {
+		return fmt.Errorf("only one of token and oauth2 client credentials can be set")
+	}
+	if (h.Username != "" || h.Password != "") && h.OAuth2Config.Enabled() {
+		return fmt.Errorf("only one of username/password and oauth2 client credentials can be set")
+	}
+	return nil
+}
+
+func (h *HTTP) Connect() error {
+	client, err := h.HTTPClientConfig.CreateClient()
+	if err != nil {
+		return err
+	}
+	h.client = client
+	return nil
+}
+
+func (h *HTTP) Close() error {
+	if h.client != nil {
+		h.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Write sends the metrics in one request per target url, the targets are
+// resolved from the url template. Every target is attempted, the metrics of
+// the failed ones are returned in a PartialWriteError, to be written again
+// or dropped depending on the error.
+func (h *HTTP) Write(metrics []models.Metric) error {
+	targets, batches := h.splitByURL(metrics)
+	if len(targets) == 1 {
+		return h.writeTarget(targets[0], metrics)
+	}
+
+	var failed, dropped []int
+	var nFailed int
+	for _, target := range targets {
+		indices := batches[target]
+		batch := make([]models.Metric, len(indices))
+		for i, index := range indices {
+			batch[i] = metrics[index]
+		}
+
+		err := h.writeTarget(target, batch)
+		if err == nil {
+			continue
+		}
+		nFailed++
+		var perr *models.PermanentError
+		if errors.As(err, &perr) {
+			h.log.Errorf("Dropping %d metrics: %v", len(batch), err)
+			dropped = append(dropped, indices...)
+		} else {
+			h.log.Errorf("Writing %d metrics failed: %v", len(batch), err)
+			failed = append(failed, indices...)
+		}
+	}
+	if nFailed == 0 {
+		return nil
+	}
+	return &models.PartialWriteError{
+		Err:     fmt.Errorf("writing to %d of %d urls failed", nFailed, len(targets)),
+		Failed:  failed,
+		Dropped: dropped,
+	}
+}
+
+// writeTarget sends the metrics in a single request to the target url.
+func (h *HTTP) writeTarget(target string, metrics []models.Metric) error {
+	body, err := h.serialize(metrics)
+	if err != nil {
+		return &models.PermanentError{Err: err}
+	}
+	if len(body) == 0 {
+		return nil
+	}
+	return h.writeBody(target, body)
+}
+
+// splitByURL groups the indices of the metrics by the url they are sent to,
+// the urls are returned in the order of their first metric.
+func (h *HTTP) splitByURL(metrics []models.Metric) ([]string, map[string][]int) {
+	if !placeholderRe.MatchString(h.URL) {
+		return []string{h.URL}, nil
+	}
+
+	var targets []string
+	batches := make(map[string][]int)
+	for i, metric := range metrics {
+		target := h.expandURL(metric)
+		if _, ok := batches[target]; !ok {
+			targets = append(targets, target)
+		}
+		batches[target] = append(batches[target], i)
+	}
+	return targets, batches
+}
+
+// expandURL replaces the {tag} placeholders of the url with the tags of the
+// first series of the metric, missing tags are replaced with an empty string.
+func (h *HTTP) expandURL(metric models.Metric) string {
+	var tags map[string]string
+	if sm, ok := metric.(models.SeriesMetric); ok {
+		if series := sm.Series(); len(series) > 0 {
+			tags = series[0].Tags
+		}
+	}
+
+	return placeholderRe.ReplaceAllStringFunc(h.URL, func(s string) string {
+		return url.PathEscape(tags[s[1:len(s)-1]])
+	})
+}
+
+func (h *HTTP) serialize(metrics []models.Metric) ([]byte, error) {
+	if s, ok := h.serializer.(serializers.BatchSerializer); ok && h.UseBatchFormat {
+		b, err := s.SerializeBatch(metrics)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize message: %v", err)
+		}
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		b, err := h.serializer.Serialize(metric)
+		if err != nil {
+			h.log.Debugf("Could not serialize metric: %v", err)
+			continue
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+func (h *HTTP) encode(body []byte) ([]byte, error) {
+	switch h.ContentEncoding {
+	case "gzip":
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "zstd":
+		return h.encoder.EncodeAll(body, nil), nil
+	}
+	return body, nil
+}
+
+func (h *HTTP) writeBody(target string, body []byte) error {
+	body, err := h.encode(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), h.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return &models.PermanentError{Err: err}
+	}
+	req.Header.Set("User-Agent", "telemetry")
+	if h.ContentEncoding == "gzip" || h.ContentEncoding == "zstd" {
+		req.Header.Set("Content-Encoding", h.ContentEncoding)
+	}
+	if h.Username != "" || h.Password != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	for k, v := range h.Headers {
+		if strings.EqualFold(k, "host") {
+			req.Host = v
+		}
+		req.Header.Set(k, v)
+	}
+
+	start := time.Now()
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	h.log.Debugf("Wrote %d bytes to [%s] in %s", len(body), target, time.Since(start))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	statusErr := &StatusError{URL: target, StatusCode: resp.StatusCode}
+	if b, err := io.ReadAll(io.LimitReader(resp.Body, maxErrMsgLen)); err == nil {
+		statusErr.Body = strings.TrimSpace(string(b))
+	}
+
+	if !h.retryable(resp.StatusCode) {
+		return &models.PermanentError{Err: statusErr}
+	}
+	return statusErr
+}
+
+// retryable reports whether a request failing with the status code is sent
+// again. The configured lists take precedence, otherwise client errors
+// other than timeouts and rate limiting are not retried.
+func (h *HTTP) retryable(code int) bool {
+	for _, c := range h.NonRetryableStatusCodes {
+		if c == code {
+			return false
+		}
+	}
+	for _, c := range h.RetryableStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return code < 400 || code >= 500
+}
+
+func (h *HTTP) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, h)
+	if err != nil {
+		return fmt.Errorf("[http] config error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+	"telemetry/plugin/serializers/influx"
+)
+
+func newTestMetric(source string) models.Metric {
+	return models.NewSeriesMetric(models.Series{
+		Name:   "cpu",
+		Tags:   map[string]string{"source": source},
+		Fields: map[string]any{"value": 1.5},
+		Time:   time.Unix(0, 42),
+	})
+}
+
+func newTestOutput(t *testing.T, url string) *HTTP {
+	h := NewHTTP()
+	h.URL = url
+	h.SetSerializer(influx.NewSerializer(false))
+	require.NoError(t, h.Init())
+	require.NoError(t, h.Connect())
+	return h
+}
+
+func TestWriteSplitsByURLTemplate(t *testing.T) {
+	type request struct {
+		authorization string
+		encoding      string
+		body          string
+		err           error
+	}
+	var mu sync.Mutex
+	requests := make(map[string]request)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{
+			authorization: r.Header.Get("Authorization"),
+			encoding:      r.Header.Get("Content-Encoding"),
+		}
+		decoder, err := zstd.NewReader(r.Body)
+		if err == nil {
+			var body []byte
+			body, err = io.ReadAll(decoder)
+			req.body = string(body)
+			decoder.Close()
+		}
+		req.err = err
+
+		mu.Lock()
+		requests[r.URL.Path] = req
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	h := NewHTTP()
+	h.URL = ts.URL + "/ingest/{source}"
+	h.Token = "secret"
+	h.ContentEncoding = "zstd"
+	h.SetSerializer(influx.NewSerializer(false))
+	require.NoError(t, h.Init())
+	require.NoError(t, h.Connect())
+
+	metrics := []models.Metric{newTestMetric("r1"), newTestMetric("r2"), newTestMetric("r1")}
+	require.NoError(t, h.Write(metrics))
+
+	mu.Lock()
+	defer mu.Unlock()
+	bodies := make(map[string]string)
+	for path, req := range requests {
+		require.NoError(t, req.err)
+		require.Equal(t, "Bearer secret", req.authorization)
+		require.Equal(t, "zstd", req.encoding)
+		bodies[path] = req.body
+	}
+	require.Equal(t, map[string]string{
+		"/ingest/r1": "cpu,source=r1 value=1.5 42\ncpu,source=r1 value=1.5 42\n",
+		"/ingest/r2": "cpu,source=r2 value=1.5 42\n",
+	}, bodies)
+}
+
+func TestWriteStatusClassification(t *testing.T) {
+	status := http.StatusBadRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	h := newTestOutput(t, ts.URL)
+	var perr *models.PermanentError
+
+	err := h.Write([]models.Metric{newTestMetric("r1")})
+	require.True(t, errors.As(err, &perr))
+
+	status = http.StatusServiceUnavailable
+	err = h.Write([]models.Metric{newTestMetric("r1")})
+	require.Error(t, err)
+	require.False(t, errors.As(err, &perr))
+
+	status = http.StatusConflict
+	h.RetryableStatusCodes = []int{http.StatusConflict}
+	err = h.Write([]models.Metric{newTestMetric("r1")})
+	require.Error(t, err)
+	require.False(t, errors.As(err, &perr))
+}
+
+func TestWritePartialFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ingest/r2":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/ingest/r3":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	h := newTestOutput(t, ts.URL+"/ingest/{source}")
+	metrics := []models.Metric{
+		newTestMetric("r1"), newTestMetric("r2"), newTestMetric("r3"), newTestMetric("r2"), newTestMetric("r1"),
+	}
+	err := h.Write(metrics)
+	var perr *models.PartialWriteError
+	require.True(t, errors.As(err, &perr))
+	require.Equal(t, []int{1, 3}, perr.Failed)
+	require.Equal(t, []int{2}, perr.Dropped)
+
+	// The partial error is not dropped as a whole
+	var permanent *models.PermanentError
+	require.False(t, errors.As(err, &permanent))
+}
+
+func TestInitAuthConflicts(t *testing.T) {
+	h := NewHTTP()
+	h.Token = "secret"
+	h.Username = "user"
+	require.Error(t, h.Init())
+
+	h = NewHTTP()
+	h.Token = "secret"
+	h.ClientID = "id"
+	h.ClientSecret = "secret"
+	h.TokenURL = "http://127.0.0.1/token"
+	require.Error(t, h.Init())
+
+	h = NewHTTP()
+	h.Username = "user"
+	h.Password = "pass"
+	h.ClientID = "id"
+	h.ClientSecret = "secret"
+	h.TokenURL = "http://127.0.0.1/token"
+	require.Error(t, h.Init())
+}
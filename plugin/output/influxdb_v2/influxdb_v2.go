@@ -0,0 +1,290 @@
+package influxdb_v2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"telemetry/internal"
+	"telemetry/models"
+	"telemetry/plugin/common/tls"
+	"telemetry/plugin/serializers/influx"
+)
+
+const (
+	defaultURL     = "http://localhost:8086"
+	defaultTimeout = internal.Duration(5 * time.Second)
+
+	// Bounds of the wait requested by the server before writing again
+	defaultRetryAfter = time.Second
+	maxRetryAfter     = 60 * time.Second
+)
+
+type InfluxDBV2 struct {
+	URLs            []string          `json:"urls"`
+	Token           string            `json:"token"`
+	Organization    string            `json:"organization"`
+	Bucket          string            `json:"bucket"`
+	Timeout         internal.Duration `json:"timeout"`
+	HTTPHeaders     map[string]string `json:"http_headers"`
+	UserAgent       string            `json:"user_agent"`
+	ContentEncoding string            `json:"content_encoding"`
+	UintSupport     bool              `json:"influx_uint_support"`
+
+	tls.ClientConfig
+
+	log *logrus.Entry
+
+	client     *http.Client
+	serializer *influx.Serializer
+	retryTime  time.Time
+}
+
+// APIError is an error reported by the InfluxDB write API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func NewInfluxDBV2() *InfluxDBV2 {
+	return &InfluxDBV2{
+		Timeout:         defaultTimeout,
+		ContentEncoding: "gzip",
+		UserAgent:       "telemetry",
+		log:             models.NewLogger("outputs.influxdb_v2"),
+	}
+}
+
+func (i *InfluxDBV2) Init() error {
+	if len(i.URLs) == 0 {
+		i.URLs = []string{defaultURL}
+	}
+	for _, u := range i.URLs {
+		if _, err := url.Parse(u); err != nil {
+			return fmt.Errorf("invalid url %q: %v", u, err)
+		}
+	}
+	if i.Bucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+
+	switch i.ContentEncoding {
+	case "", "identity", "gzip":
+	default:
+		return fmt.Errorf("invalid content encoding: %s", i.ContentEncoding)
+	}
+
+	i.serializer = influx.NewSerializer(i.UintSupport)
+	return nil
+}
+
+func (i *InfluxDBV2) Connect() error {
+	tlsConfig, err := i.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	i.client = &http.Client{
+		Timeout: time.Duration(i.Timeout),
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+	return nil
+}
+
+func (i *InfluxDBV2) Close() error {
+	if i.client != nil {
+		i.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Write sends the metrics to the first url accepting them.
+func (i *InfluxDBV2) Write(metrics []models.Metric) error {
+	if wait := time.Until(i.retryTime); wait > 0 {
+		return fmt.Errorf("waiting %s for server before sending metrics again", wait.Round(time.Millisecond))
+	}
+
+	var err error
+	for _, u := range i.URLs {
+		err = i.writeBatch(u, metrics)
+		if err == nil {
+			return nil
+		}
+		var perr *models.PermanentError
+		if errors.As(err, &perr) {
+			return err
+		}
+		i.log.Errorf("When writing to [%s]: %v", u, err)
+	}
+	return err
+}
+
+// writeBatch posts metrics to the write API of u. Batches exceeding the
+// maximum body size of the server are split in halves until accepted.
+func (i *InfluxDBV2) writeBatch(u string, metrics []models.Metric) error {
+	body, err := i.serializer.SerializeBatch(metrics)
+	if err != nil {
+		return &models.PermanentError{Err: err}
+	}
+	if len(body) == 0 {
+		return nil
+	}
+
+	err = i.post(u, body)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusRequestEntityTooLarge {
+		if len(metrics) == 1 {
+			return &models.PermanentError{Err: fmt.Errorf("metric exceeds the maximum body size: %v", err)}
+		}
+		i.log.Warnf("Batch of %d metrics too large, splitting it: %v", len(metrics), err)
+		half := len(metrics) / 2
+		errFirst := i.writeBatch(u, metrics[:half])
+		var perr *models.PermanentError
+		if errFirst != nil && !errors.As(errFirst, &perr) {
+			return errFirst
+		}
+		if err := i.writeBatch(u, metrics[half:]); err != nil {
+			return err
+		}
+		return errFirst
+	}
+	return err
+}
+
+func (i *InfluxDBV2) post(u string, body []byte) error {
+	writeURL, err := i.writeURL(u)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = bytes.NewReader(body)
+	if i.ContentEncoding == "gzip" {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		reader = &buf
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(i.Timeout))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, writeURL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", i.UserAgent)
+	if i.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.Token)
+	}
+	if i.ContentEncoding == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range i.HTTPHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var msg struct {
+		Message string `json:"message"`
+	}
+	if b, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024)); err == nil {
+		if json.Unmarshal(b, &msg) == nil {
+			apiErr.Message = msg.Message
+		} else {
+			apiErr.Message = string(b)
+		}
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		wait := retryAfter(resp.Header.Get("Retry-After"))
+		i.retryTime = time.Now().Add(wait)
+		return fmt.Errorf("server busy, retrying in %s: %w", wait, apiErr)
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		// The line protocol was rejected, writing it again fails the same way
+		return &models.PermanentError{Err: fmt.Errorf("failed to write metrics: %w", apiErr)}
+	}
+	return apiErr
+}
+
+func (i *InfluxDBV2) writeURL(u string) (string, error) {
+	loc, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	loc.Path = strings.TrimSuffix(loc.Path, "/") + "/api/v2/write"
+
+	params := url.Values{}
+	params.Set("bucket", i.Bucket)
+	params.Set("org", i.Organization)
+	params.Set("precision", "ns")
+	loc.RawQuery = params.Encode()
+	return loc.String(), nil
+}
+
+// retryAfter parses the Retry-After header, given either as seconds or as
+// an HTTP date.
+func retryAfter(header string) time.Duration {
+	wait := defaultRetryAfter
+	if seconds, err := strconv.Atoi(header); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		wait = time.Until(t)
+	}
+
+	if wait <= 0 {
+		wait = defaultRetryAfter
+	}
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait
+}
+
+func (i *InfluxDBV2) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, i)
+	if err != nil {
+		return fmt.Errorf("[influxdb_v2] config error: %v", err)
+	}
+	return nil
+}
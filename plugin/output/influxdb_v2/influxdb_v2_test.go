@@ -0,0 +1,151 @@
+package influxdb_v2
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+)
+
+func newTestMetric(value float64) models.Metric {
+	return models.NewSeriesMetric(models.Series{
+		Name:   "cpu",
+		Tags:   map[string]string{"cpu": "cpu0"},
+		Fields: map[string]any{"time_idle": value},
+		Time:   time.Unix(0, 42),
+	})
+}
+
+func newTestOutput(t *testing.T, url string) *InfluxDBV2 {
+	i := NewInfluxDBV2()
+	i.URLs = []string{url}
+	i.Token = "secret"
+	i.Organization = "org"
+	i.Bucket = "telemetry"
+	require.NoError(t, i.Init())
+	require.NoError(t, i.Connect())
+	return i
+}
+
+func TestWrite(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	var bodies []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		gz, err := gzip.NewReader(r.Body)
+		if err == nil {
+			body, err = io.ReadAll(gz)
+		}
+		if err != nil {
+			body = []byte(err.Error())
+		}
+
+		mu.Lock()
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	i := newTestOutput(t, ts.URL)
+	require.NoError(t, i.Write([]models.Metric{newTestMetric(1.5)}))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, requests, 1)
+	r := requests[0]
+	require.Equal(t, "/api/v2/write", r.URL.Path)
+	require.Equal(t, "telemetry", r.URL.Query().Get("bucket"))
+	require.Equal(t, "org", r.URL.Query().Get("org"))
+	require.Equal(t, "Token secret", r.Header.Get("Authorization"))
+	require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+	require.Equal(t, []string{"cpu,cpu=cpu0 time_idle=1.5 42\n"}, bodies)
+}
+
+func TestWriteSplitsTooLargeBatch(t *testing.T) {
+	var mu sync.Mutex
+	var lines []int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(gz)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		n := strings.Count(string(body), "\n")
+		if n > 2 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		mu.Lock()
+		lines = append(lines, n)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	i := newTestOutput(t, ts.URL)
+	metrics := []models.Metric{newTestMetric(1), newTestMetric(2), newTestMetric(3), newTestMetric(4), newTestMetric(5)}
+	require.NoError(t, i.Write(metrics))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []int{2, 1, 2}, lines)
+}
+
+func TestWriteParseErrorIsPermanent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"code":"invalid","message":"unable to parse"}`))
+	}))
+	defer ts.Close()
+
+	i := newTestOutput(t, ts.URL)
+	err := i.Write([]models.Metric{newTestMetric(1)})
+	var perr *models.PermanentError
+	require.True(t, errors.As(err, &perr))
+	require.Contains(t, err.Error(), "unable to parse")
+}
+
+func TestWriteHonoursRetryAfter(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	i := newTestOutput(t, ts.URL)
+	require.Error(t, i.Write([]models.Metric{newTestMetric(1)}))
+	require.WithinDuration(t, time.Now().Add(30*time.Second), i.retryTime, time.Second)
+
+	// Writes are held back until the requested time
+	err := i.Write([]models.Metric{newTestMetric(1)})
+	require.ErrorContains(t, err, "waiting")
+	mu.Lock()
+	require.Equal(t, 1, calls)
+	mu.Unlock()
+
+	var perr *models.PermanentError
+	require.False(t, errors.As(err, &perr))
+}
@@ -3,6 +3,9 @@ package kafka
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/Shopify/sarama"
 	"github.com/gofrs/uuid"
@@ -14,10 +17,38 @@ import (
 	"telemetry/plugin/serializers"
 )
 
+// Kafka topic names are limited to these characters and this length
+const (
+	topicChars     = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-"
+	maxTopicLength = 249
+)
+
+const defaultMaxInFlight = 10000
+
+// placeholderRe matches the {name} and {tag} placeholders of the routing key.
+var placeholderRe = regexp.MustCompile(`\{([^{}]+)\}`)
+
 type Kafka struct {
-	Brokers    []string `json:"brokers"`
-	Topic      string   `json:"topic"`
-	RoutingKey string   `json:"routing_key"`
+	Brokers         []string    `json:"brokers"`
+	Topic           string      `json:"topic"`
+	TopicTag        string      `json:"topic_tag"`
+	ExcludeTopicTag bool        `json:"exclude_topic_tag"`
+	TopicSuffix     TopicSuffix `json:"topic_suffix"`
+	RoutingTag      string      `json:"routing_tag"`
+	RoutingKey      string      `json:"routing_key"`
+
+	// Headers are added to every message, HeaderTags are added as headers
+	// named after the tag
+	Headers    map[string]string `json:"headers"`
+	HeaderTags []string          `json:"header_tags"`
+
+	// ProducerTimestamp is the record timestamp, "metric" or "now"
+	ProducerTimestamp string `json:"producer_timestamp"`
+
+	// ProducerMode is "sync" or "async", the async producer keeps up to
+	// MaxInFlight messages waiting for their acknowledgement
+	ProducerMode string `json:"producer_mode"`
+	MaxInFlight  int    `json:"max_in_flight"`
 
 	proxy.Socks5ProxyConfig
 
@@ -33,31 +64,72 @@ type Kafka struct {
 
 	log *logrus.Entry
 
-	saramaConfig *sarama.Config
-	producer     sarama.SyncProducer
+	saramaConfig  *sarama.Config
+	producer      sarama.SyncProducer
+	asyncProducer sarama.AsyncProducer
 
 	serializer serializers.Serializer
 }
 
+// TopicSuffix appends the metric name or tag values to the topic.
+type TopicSuffix struct {
+	Method    string   `json:"method"`
+	Keys      []string `json:"keys"`
+	Separator string   `json:"separator"`
+}
+
 func (k *Kafka) SetSerializer(serializer serializers.Serializer) {
 	k.serializer = serializer
 }
 
 func NewKafka() *Kafka {
 	return &Kafka{
-		log: models.NewLogger("outputs.kafka"),
+		ProducerTimestamp: "metric",
+		ProducerMode:      "sync",
+		MaxInFlight:       defaultMaxInFlight,
+		log:               models.NewLogger("outputs.kafka"),
 	}
 }
 
 func (k *Kafka) Init() error {
 	sarama.Logger = models.NewLogger("outputs.kafka.sarama")
 
+	switch k.TopicSuffix.Method {
+	case "", "measurement", "tags":
+	default:
+		return fmt.Errorf("unknown topic suffix method %q, must be \"measurement\" or \"tags\"", k.TopicSuffix.Method)
+	}
+	if k.ExcludeTopicTag && k.TopicTag == "" {
+		return fmt.Errorf("exclude_topic_tag requires topic_tag")
+	}
+	switch k.ProducerTimestamp {
+	case "":
+		k.ProducerTimestamp = "metric"
+	case "metric", "now":
+	default:
+		return fmt.Errorf("unknown producer_timestamp %q, must be \"metric\" or \"now\"", k.ProducerTimestamp)
+	}
+	switch k.ProducerMode {
+	case "":
+		k.ProducerMode = "sync"
+	case "sync", "async":
+	default:
+		return fmt.Errorf("unknown producer_mode %q, must be \"sync\" or \"async\"", k.ProducerMode)
+	}
+	if k.MaxInFlight <= 0 {
+		k.MaxInFlight = defaultMaxInFlight
+	}
+
 	config := sarama.NewConfig()
 	if err := k.SetConfig(config, k.log); err != nil {
 		return err
 	}
 	k.saramaConfig = config
 
+	if (len(k.Headers) > 0 || len(k.HeaderTags) > 0) && !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		return fmt.Errorf("headers require kafka version 0.11.0 or later")
+	}
+
 	// Legacy support ssl config
 	if k.Certificate != "" {
 		k.TLSCert = k.Certificate
@@ -79,6 +151,15 @@ func (k *Kafka) Init() error {
 }
 
 func (k *Kafka) Connect() error {
+	if k.ProducerMode == "async" {
+		producer, err := sarama.NewAsyncProducer(k.Brokers, k.saramaConfig)
+		if err != nil {
+			return err
+		}
+		k.asyncProducer = producer
+		return nil
+	}
+
 	producer, err := sarama.NewSyncProducer(k.Brokers, k.saramaConfig)
 	if err != nil {
 		return err
@@ -88,10 +169,118 @@ func (k *Kafka) Connect() error {
 }
 
 func (k *Kafka) Close() error {
+	if k.asyncProducer != nil {
+		return k.asyncProducer.Close()
+	}
 	return k.producer.Close()
 }
 
-func (k *Kafka) routingKey() (string, error) {
+// firstSeries returns the first series of a metric, messages are routed
+// by the name and tags of their first series.
+func firstSeries(metric models.Metric) (models.Series, bool) {
+	if sm, ok := metric.(models.SeriesMetric); ok {
+		if series := sm.Series(); len(series) > 0 {
+			return series[0], true
+		}
+	}
+	return models.Series{}, false
+}
+
+// topicName returns the topic of a metric, named after the tags and name of
+// its first series. With exclude_topic_tag the metric is returned with the
+// topic tag removed from its series.
+func (k *Kafka) topicName(metric models.Metric) (models.Metric, string) {
+	first, ok := firstSeries(metric)
+	if !ok {
+		return metric, sanitizeTopic(k.Topic)
+	}
+
+	topic := k.Topic
+	if k.TopicTag != "" {
+		if t, ok := first.Tags[k.TopicTag]; ok {
+			topic = t
+			if k.ExcludeTopicTag {
+				sm := metric.(models.SeriesMetric)
+				metric = withoutTag(sm, sm.Series(), k.TopicTag)
+			}
+		}
+	}
+
+	switch k.TopicSuffix.Method {
+	case "measurement":
+		topic += k.TopicSuffix.Separator + first.Name
+	case "tags":
+		parts := []string{topic}
+		for _, key := range k.TopicSuffix.Keys {
+			if v := first.Tags[key]; v != "" {
+				parts = append(parts, v)
+			}
+		}
+		topic = strings.Join(parts, k.TopicSuffix.Separator)
+	}
+	return metric, sanitizeTopic(topic)
+}
+
+// sanitizeTopic replaces the characters not allowed in topic names by "_".
+func sanitizeTopic(topic string) string {
+	topic = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(topicChars, r) {
+			return r
+		}
+		return '_'
+	}, topic)
+	if len(topic) > maxTopicLength {
+		topic = topic[:maxTopicLength]
+	}
+	// "." and ".." are reserved
+	if strings.Trim(topic, ".") == "" && topic != "" {
+		topic = strings.Repeat("_", len(topic))
+	}
+	return topic
+}
+
+// taglessMetric is a metric whose series have a tag removed, the original
+// metric in the buffer is left untouched.
+type taglessMetric struct {
+	models.SeriesMetric
+	series []models.Series
+}
+
+func withoutTag(metric models.SeriesMetric, series []models.Series, tag string) *taglessMetric {
+	stripped := make([]models.Series, len(series))
+	for i, s := range series {
+		tags := make(map[string]string, len(s.Tags))
+		for k, v := range s.Tags {
+			if k != tag {
+				tags[k] = v
+			}
+		}
+		s.Tags = tags
+		stripped[i] = s
+	}
+	return &taglessMetric{SeriesMetric: metric, series: stripped}
+}
+
+func (m *taglessMetric) Series() []models.Series {
+	return m.series
+}
+
+// MarshalJSON encodes the series without the tag, like the series metrics.
+func (m *taglessMetric) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.series)
+}
+
+// routingKey returns the message key of a series, the value of the routing
+// tag or else the routing key. The routing key is either "random", a fixed
+// string or a template where {name} is the series name and other
+// placeholders are tags.
+func (k *Kafka) routingKey(series models.Series) (string, error) {
+	if k.RoutingTag != "" {
+		if key, ok := series.Tags[k.RoutingTag]; ok {
+			return key, nil
+		}
+	}
+
 	if k.RoutingKey == "random" {
 		u, err := uuid.NewV4()
 		if err != nil {
@@ -99,23 +288,55 @@ func (k *Kafka) routingKey() (string, error) {
 		}
 		return u.String(), nil
 	}
-	return k.RoutingKey, nil
+	return placeholderRe.ReplaceAllStringFunc(k.RoutingKey, func(s string) string {
+		key := s[1 : len(s)-1]
+		if key == "name" {
+			return series.Name
+		}
+		return series.Tags[key]
+	}), nil
+}
+
+// headers returns the static headers and the header tags of a series.
+func (k *Kafka) headers(series models.Series) []sarama.RecordHeader {
+	keys := make([]string, 0, len(k.Headers))
+	for key := range k.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	headers := make([]sarama.RecordHeader, 0, len(k.Headers)+len(k.HeaderTags))
+	for _, key := range keys {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(k.Headers[key])})
+	}
+	for _, tag := range k.HeaderTags {
+		if value, ok := series.Tags[tag]; ok {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(tag), Value: []byte(value)})
+		}
+	}
+	return headers
 }
 
 func (k *Kafka) Write(metrics []models.Metric) error {
 	msgs := make([]*sarama.ProducerMessage, 0, len(metrics))
 	for _, metric := range metrics {
+		series, _ := firstSeries(metric)
+		metric, topic := k.topicName(metric)
 		buf, err := k.serializer.Serialize(metric)
 		if err != nil {
 			k.log.Debugf("Could not serialize metric: %v", err)
 		}
 
 		m := &sarama.ProducerMessage{
-			Topic: k.Topic,
-			Value: sarama.ByteEncoder(buf),
+			Topic:   topic,
+			Value:   sarama.ByteEncoder(buf),
+			Headers: k.headers(series),
+		}
+		if k.ProducerTimestamp == "metric" {
+			m.Timestamp = series.Time
 		}
 
-		key, err := k.routingKey()
+		key, err := k.routingKey(series)
 		if err != nil {
 			return fmt.Errorf("could not generate routing key: %v", err)
 		}
@@ -126,29 +347,103 @@ func (k *Kafka) Write(metrics []models.Metric) error {
 		msgs = append(msgs, m)
 	}
 
+	if k.asyncProducer != nil {
+		return k.sendAsync(msgs)
+	}
+	return k.sendSync(msgs)
+}
+
+func (k *Kafka) sendSync(msgs []*sarama.ProducerMessage) error {
+	for i, m := range msgs {
+		m.Metadata = i
+	}
+
 	err := k.producer.SendMessages(msgs)
-	if err != nil {
-		// We could have many errors, return only the first encountered.
-		if errs, ok := err.(sarama.ProducerErrors); ok {
-			for _, prodErr := range errs {
-				if prodErr.Err == sarama.ErrMessageSizeTooLarge {
-					k.log.Error("Message too large, consider increasing `max_message_bytes`; dropping batch")
-					return nil
-				}
-				if prodErr.Err == sarama.ErrInvalidTimestamp {
-					k.log.Error(
-						"The timestamp of the message is out of acceptable range, consider increasing broker `message.timestamp.difference.max.ms`; " +
-							"dropping batch",
-					)
-					return nil
-				}
-				return prodErr //nolint:staticcheck // Return first error encountered
-			}
+	if errs, ok := err.(sarama.ProducerErrors); ok {
+		return k.partialWriteError(errs, len(msgs))
+	}
+	return err
+}
+
+// sendAsync feeds the messages to the async producer, keeping at most
+// max_in_flight of them unacknowledged, and waits for all of them to be
+// acknowledged. The messages which failed are reported in a
+// PartialWriteError so that only their metrics are written again, messages
+// the broker can never accept are dropped.
+func (k *Kafka) sendAsync(msgs []*sarama.ProducerMessage) error {
+	for i, m := range msgs {
+		m.Metadata = i
+	}
+
+	var errs []*sarama.ProducerError
+	var next, inFlight int
+	for next < len(msgs) || inFlight > 0 {
+		// A nil channel disables the send case once the limit is reached
+		var input chan<- *sarama.ProducerMessage
+		var msg *sarama.ProducerMessage
+		if next < len(msgs) && inFlight < k.MaxInFlight {
+			input = k.asyncProducer.Input()
+			msg = msgs[next]
+		}
+
+		select {
+		case input <- msg:
+			next++
+			inFlight++
+		case <-k.asyncProducer.Successes():
+			inFlight--
+		case prodErr := <-k.asyncProducer.Errors():
+			inFlight--
+			errs = append(errs, prodErr)
 		}
-		return err
 	}
+	return k.partialWriteError(errs, len(msgs))
+}
 
-	return nil
+// partialWriteError returns the errors of the messages, which hold their
+// index in Metadata, as a PartialWriteError. The messages the broker can
+// never accept are dropped, the other ones failed.
+func (k *Kafka) partialWriteError(errs []*sarama.ProducerError, total int) error {
+	var failed, dropped []int
+	var firstErr error
+	for _, prodErr := range errs {
+		i, ok := prodErr.Msg.Metadata.(int)
+		if !ok {
+			return prodErr
+		}
+		switch prodErr.Err {
+		case sarama.ErrMessageSizeTooLarge:
+			k.log.Error("Message too large, consider increasing `max_message_bytes`; dropping message")
+			dropped = append(dropped, i)
+			continue
+		case sarama.ErrInvalidTimestamp:
+			k.log.Error(
+				"The timestamp of the message is out of acceptable range, consider increasing broker `message.timestamp.difference.max.ms`; " +
+					"dropping message",
+			)
+			dropped = append(dropped, i)
+			continue
+		}
+		if firstErr == nil {
+			firstErr = prodErr
+		}
+		failed = append(failed, i)
+	}
+	if len(failed) == 0 && len(dropped) == 0 {
+		return nil
+	}
+
+	sort.Ints(failed)
+	sort.Ints(dropped)
+	err := fmt.Errorf("%d of %d messages dropped", len(dropped), total)
+	if firstErr != nil {
+		err = fmt.Errorf("%d of %d messages failed, %d dropped: %v", len(failed), total, len(dropped), firstErr)
+	}
+	return &models.PartialWriteError{
+		Err:     err,
+		Failed:  failed,
+		Dropped: dropped,
+	}
 }
 
 func (k *Kafka) ParseConfig(cfg map[string]any) error {
@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+	"telemetry/plugin/serializers/influx"
+	"telemetry/plugin/serializers/json"
+)
+
+func newTestMetric() models.SeriesMetric {
+	return models.NewSeriesMetric([]models.Series{{
+		Name:   "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+		Tags:   map[string]string{"source": "10.0.0.1", "node_id": "router 1"},
+		Fields: map[string]any{"bytes_received": int64(10)},
+	}}...)
+}
+
+func TestTopicName(t *testing.T) {
+	tests := []struct {
+		name     string
+		kafka    *Kafka
+		expected string
+	}{
+		{
+			name:     "static topic",
+			kafka:    &Kafka{Topic: "telemetry"},
+			expected: "telemetry",
+		},
+		{
+			name:     "topic tag",
+			kafka:    &Kafka{Topic: "telemetry", TopicTag: "node_id"},
+			expected: "router_1",
+		},
+		{
+			name:     "missing topic tag",
+			kafka:    &Kafka{Topic: "telemetry", TopicTag: "device"},
+			expected: "telemetry",
+		},
+		{
+			name: "measurement suffix",
+			kafka: &Kafka{
+				Topic:       "telemetry",
+				TopicSuffix: TopicSuffix{Method: "measurement", Separator: "."},
+			},
+			expected: "telemetry.Cisco-IOS-XR-infra-statsd-oper_infra-statistics_interfaces_interface_latest_generic-counters",
+		},
+		{
+			name: "tags suffix",
+			kafka: &Kafka{
+				Topic:       "telemetry",
+				TopicSuffix: TopicSuffix{Method: "tags", Keys: []string{"source", "missing", "node_id"}, Separator: "-"},
+			},
+			expected: "telemetry-10.0.0.1-router_1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, topic := tt.kafka.topicName(newTestMetric())
+			require.Equal(t, tt.expected, topic)
+		})
+	}
+}
+
+func TestTopicNameExcludeTag(t *testing.T) {
+	k := &Kafka{Topic: "telemetry", TopicTag: "node_id", ExcludeTopicTag: true}
+	metric := newTestMetric()
+
+	stripped, topic := k.topicName(metric)
+	require.Equal(t, "router_1", topic)
+	require.Equal(t, map[string]string{"source": "10.0.0.1"}, stripped.(models.SeriesMetric).Series()[0].Tags)
+	require.Contains(t, metric.Series()[0].Tags, "node_id")
+}
+
+func TestTopicNameExcludeTagJSON(t *testing.T) {
+	k := &Kafka{Topic: "telemetry", TopicTag: "node_id", ExcludeTopicTag: true}
+	serializer, err := json.NewSerializer(time.Millisecond, "", "")
+	require.NoError(t, err)
+
+	stripped, _ := k.topicName(newTestMetric())
+	out, err := serializer.Serialize(stripped)
+	require.NoError(t, err)
+	require.Equal(t, `{"metric":[{"Name":"Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",`+
+		`"Tags":{"source":"10.0.0.1"},"Fields":{"bytes_received":10},"Time":"0001-01-01T00:00:00Z","Type":0,"Header":null}]}`+"\n", string(out))
+}
+
+func TestSanitizeTopic(t *testing.T) {
+	require.Equal(t, "a_b_c-d.e", sanitizeTopic("a/b:c-d.e"))
+	require.Equal(t, "__", sanitizeTopic(".."))
+	require.Len(t, sanitizeTopic(string(make([]byte, 300))), maxTopicLength)
+}
+
+func TestRoutingKey(t *testing.T) {
+	series := newTestMetric().Series()[0]
+
+	k := &Kafka{RoutingTag: "source", RoutingKey: "fallback"}
+	key, err := k.routingKey(series)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1", key)
+
+	k.RoutingTag = "device"
+	key, err = k.routingKey(series)
+	require.NoError(t, err)
+	require.Equal(t, "fallback", key)
+
+	k.RoutingKey = "{node_id}/{missing}/{name}"
+	key, err = k.routingKey(series)
+	require.NoError(t, err)
+	require.Equal(t, "router 1//"+series.Name, key)
+
+	k.RoutingKey = "random"
+	first, err := k.routingKey(series)
+	require.NoError(t, err)
+	second, err := k.routingKey(series)
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+}
+
+func TestHeaders(t *testing.T) {
+	k := &Kafka{
+		Headers:    map[string]string{"b": "2", "a": "1"},
+		HeaderTags: []string{"source", "missing"},
+	}
+	require.Equal(t, []sarama.RecordHeader{
+		{Key: []byte("a"), Value: []byte("1")},
+		{Key: []byte("b"), Value: []byte("2")},
+		{Key: []byte("source"), Value: []byte("10.0.0.1")},
+	}, k.headers(newTestMetric().Series()[0]))
+}
+
+func TestWriteAsync(t *testing.T) {
+	serializer := influx.NewSerializer(false)
+
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	producer := mocks.NewAsyncProducer(t, config)
+	defer producer.Close()
+
+	k := NewKafka()
+	k.Topic = "telemetry"
+	k.MaxInFlight = 2
+	k.SetSerializer(serializer)
+	k.asyncProducer = producer
+
+	metrics := []models.Metric{newTestMetric(), newTestMetric(), newTestMetric(), newTestMetric()}
+	for range metrics {
+		producer.ExpectInputAndSucceed()
+	}
+	require.NoError(t, k.Write(metrics))
+
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+	producer.ExpectInputAndFail(sarama.ErrMessageSizeTooLarge)
+	producer.ExpectInputAndFail(sarama.ErrNotEnoughReplicas)
+	err := k.Write(metrics)
+	var perr *models.PartialWriteError
+	require.ErrorAs(t, err, &perr)
+	require.Equal(t, []int{1, 3}, perr.Failed)
+	require.Equal(t, []int{2}, perr.Dropped)
+
+	// Dropped messages are reported when no other message failed
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(sarama.ErrInvalidTimestamp)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndSucceed()
+	err = k.Write(metrics)
+	require.ErrorAs(t, err, &perr)
+	require.Empty(t, perr.Failed)
+	require.Equal(t, []int{1}, perr.Dropped)
+}
@@ -0,0 +1,307 @@
+package mqtt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"telemetry/internal"
+	"telemetry/models"
+	"telemetry/plugin/common/tls"
+	"telemetry/plugin/serializers"
+)
+
+const (
+	defaultTopic     = "telemetry/{source}/{name}"
+	defaultProtocol  = "3.1.1"
+	defaultTimeout   = internal.Duration(5 * time.Second)
+	defaultKeepAlive = 30
+)
+
+var (
+	// placeholderRe matches the {name} and {tag} placeholders of the topic.
+	placeholderRe = regexp.MustCompile(`\{([^{}]+)\}`)
+
+	// Wildcards are not allowed in the topic of a published message
+	topicEscaper = strings.NewReplacer("+", "_", "#", "_", "\x00", "")
+)
+
+// client is implemented by the clients of each protocol version.
+type client interface {
+	Connect() (bool, error)
+	Publish(topic string, payload []byte) error
+	Close() error
+}
+
+type MQTT struct {
+	Servers               []string          `json:"servers"`
+	Protocol              string            `json:"protocol"`
+	Topic                 string            `json:"topic"`
+	QoS                   int               `json:"qos"`
+	Retain                bool              `json:"retain"`
+	Username              string            `json:"username"`
+	Password              string            `json:"password"`
+	ClientID              string            `json:"client_id"`
+	Timeout               internal.Duration `json:"timeout"`
+	KeepAlive             int64             `json:"keep_alive"`
+	PersistentSession     bool              `json:"persistent_session"`
+	SessionExpiryInterval internal.Duration `json:"session_expiry_interval"`
+	BatchMessage          bool              `json:"batch"`
+	UseBatchFormat        bool              `json:"use_batch_format"`
+
+	tls.ClientConfig
+
+	log *logrus.Entry
+
+	client     client
+	connected  bool
+	serializer serializers.Serializer
+}
+
+func NewMQTT() *MQTT {
+	return &MQTT{
+		Protocol:       defaultProtocol,
+		Topic:          defaultTopic,
+		Timeout:        defaultTimeout,
+		KeepAlive:      defaultKeepAlive,
+		UseBatchFormat: true,
+		log:            models.NewLogger("outputs.mqtt"),
+	}
+}
+
+func (m *MQTT) SetSerializer(serializer serializers.Serializer) {
+	m.serializer = serializer
+}
+
+func (m *MQTT) Init() error {
+	if len(m.Servers) == 0 {
+		return fmt.Errorf("no servers specified")
+	}
+	for _, server := range m.Servers {
+		if _, err := url.Parse(server); err != nil {
+			return fmt.Errorf("invalid server %q: %v", server, err)
+		}
+	}
+
+	if m.QoS < 0 || m.QoS > 2 {
+		return fmt.Errorf("invalid qos %d, must be 0, 1 or 2", m.QoS)
+	}
+	if m.Topic == "" {
+		m.Topic = defaultTopic
+	}
+	if m.Timeout <= 0 {
+		m.Timeout = defaultTimeout
+	}
+
+	if m.PersistentSession && m.ClientID == "" {
+		return fmt.Errorf("persistent_session requires client_id")
+	}
+	if m.ClientID == "" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		m.ClientID = "telemetry-" + hex.EncodeToString(id)
+	}
+
+	tlsConfig, err := m.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	switch m.Protocol {
+	case "", "3.1.1":
+		m.client, err = newClientV3(m, tlsConfig)
+	case "5":
+		m.client, err = newClientV5(m, tlsConfig)
+	default:
+		return fmt.Errorf("unsupported protocol %q, must be \"3.1.1\" or \"5\"", m.Protocol)
+	}
+	return err
+}
+
+func (m *MQTT) Connect() error {
+	sessionPresent, err := m.client.Connect()
+	if err != nil {
+		return err
+	}
+	m.connected = true
+
+	if m.PersistentSession && !sessionPresent {
+		m.log.Infof("No session present for client %q, a new session was created", m.ClientID)
+	}
+	return nil
+}
+
+func (m *MQTT) Close() error {
+	m.connected = false
+	return m.client.Close()
+}
+
+// Write publishes every metric to the topic it resolves to, in batch mode
+// the metrics of each topic are published as a single message. Once a
+// publish fails the connection is closed, so its metrics and the remaining
+// ones are written again, the metrics which cannot be serialized are
+// dropped.
+func (m *MQTT) Write(metrics []models.Metric) error {
+	if !m.connected {
+		if err := m.Connect(); err != nil {
+			return fmt.Errorf("reconnecting failed: %v", err)
+		}
+	}
+
+	var dropped []int
+	if !m.BatchMessage {
+		for i, metric := range metrics {
+			payload, err := m.serializer.Serialize(metric)
+			if err != nil {
+				m.log.Errorf("Could not serialize metric: %v", err)
+				dropped = append(dropped, i)
+				continue
+			}
+			if len(payload) == 0 {
+				continue
+			}
+			if err := m.publish(m.topic(metric), payload); err != nil {
+				var failed []int
+				for j := i; j < len(metrics); j++ {
+					failed = append(failed, j)
+				}
+				return &models.PartialWriteError{Err: err, Failed: failed, Dropped: dropped}
+			}
+		}
+		return droppedError(dropped, len(metrics))
+	}
+
+	// The metrics of each topic by their index
+	var topics []string
+	batches := make(map[string][]int)
+	for i, metric := range metrics {
+		topic := m.topic(metric)
+		if _, ok := batches[topic]; !ok {
+			topics = append(topics, topic)
+		}
+		batches[topic] = append(batches[topic], i)
+	}
+
+	for n, topic := range topics {
+		batch := make([]models.Metric, 0, len(batches[topic]))
+		for _, i := range batches[topic] {
+			batch = append(batch, metrics[i])
+		}
+		payload, err := m.serializeBatch(batch)
+		if err != nil {
+			m.log.Errorf("Could not serialize the metrics of %q: %v", topic, err)
+			dropped = append(dropped, batches[topic]...)
+			continue
+		}
+		if len(payload) == 0 {
+			continue
+		}
+		if err := m.publish(topic, payload); err != nil {
+			var failed []int
+			for _, remaining := range topics[n:] {
+				failed = append(failed, batches[remaining]...)
+			}
+			sort.Ints(failed)
+			sort.Ints(dropped)
+			return &models.PartialWriteError{Err: err, Failed: failed, Dropped: dropped}
+		}
+	}
+	sort.Ints(dropped)
+	return droppedError(dropped, len(metrics))
+}
+
+// droppedError returns the error of a write whose other metrics were
+// published, nil when none was dropped.
+func droppedError(dropped []int, total int) error {
+	if len(dropped) == 0 {
+		return nil
+	}
+	return &models.PartialWriteError{
+		Err:     fmt.Errorf("%d of %d metrics dropped", len(dropped), total),
+		Dropped: dropped,
+	}
+}
+
+func (m *MQTT) publish(topic string, payload []byte) error {
+	if err := m.client.Publish(topic, payload); err != nil {
+		// Reconnect on the next write, the session keeps the subscriptions
+		// and the unacknowledged messages if it is persistent
+		m.connected = false
+		if errClose := m.client.Close(); errClose != nil {
+			m.log.Debugf("Closing connection failed: %v", errClose)
+		}
+		return fmt.Errorf("publishing to %q failed: %v", topic, err)
+	}
+	return nil
+}
+
+func (m *MQTT) serializeBatch(metrics []models.Metric) ([]byte, error) {
+	if s, ok := m.serializer.(serializers.BatchSerializer); ok && m.UseBatchFormat {
+		b, err := s.SerializeBatch(metrics)
+		if err != nil {
+			return nil, fmt.Errorf("failed to serialize message: %v", err)
+		}
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		b, err := m.serializer.Serialize(metric)
+		if err != nil {
+			m.log.Debugf("Could not serialize metric: %v", err)
+			continue
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// topic expands the placeholders of the topic template with the first
+// series of the metric. {name} is the series name, such as the encoding
+// path of Cisco MDT metrics, other placeholders are looked up in the tags
+// and then in the header of the series.
+func (m *MQTT) topic(metric models.Metric) string {
+	var series models.Series
+	if sm, ok := metric.(models.SeriesMetric); ok {
+		if s := sm.Series(); len(s) > 0 {
+			series = s[0]
+		}
+	}
+
+	return placeholderRe.ReplaceAllStringFunc(m.Topic, func(s string) string {
+		key := s[1 : len(s)-1]
+		if key == "name" {
+			return topicEscaper.Replace(series.Name)
+		}
+		if v, ok := series.Tags[key]; ok {
+			return topicEscaper.Replace(v)
+		}
+		if v, ok := series.Header[key]; ok {
+			return topicEscaper.Replace(fmt.Sprint(v))
+		}
+		return ""
+	})
+}
+
+func (m *MQTT) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, m)
+	if err != nil {
+		return fmt.Errorf("[mqtt] config error: %v", err)
+	}
+	return nil
+}
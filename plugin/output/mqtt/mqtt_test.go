@@ -0,0 +1,326 @@
+package mqtt
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	packets5 "github.com/eclipse/paho.golang/packets"
+	packets3 "github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+	"telemetry/plugin/serializers"
+	"telemetry/plugin/serializers/influx"
+)
+
+func newTestMetric(source string) models.Metric {
+	return models.NewSeriesMetric(models.Series{
+		Name:   "Cisco-IOS-XR-wdsysmon-fd-oper:system-monitoring/cpu-utilization",
+		Tags:   map[string]string{"source": source},
+		Fields: map[string]any{"total_cpu_one_minute": int64(3)},
+		Time:   time.Unix(0, 42),
+	})
+}
+
+type message struct {
+	topic   string
+	payload string
+	qos     byte
+	retain  bool
+}
+
+// broker is an in-process MQTT broker stub, it accepts every connection,
+// acknowledges the published messages and keeps them.
+type broker struct {
+	listener net.Listener
+	v5       bool
+
+	mutex    sync.Mutex
+	messages []message
+	conns    []net.Conn
+	wg       sync.WaitGroup
+}
+
+// startBroker starts a broker speaking protocol, "3.1.1" or "5", and returns
+// its address.
+func startBroker(t *testing.T, protocol string) (string, *broker) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	b := &broker{listener: l, v5: protocol == "5"}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.serve()
+	}()
+	t.Cleanup(b.close)
+
+	return "tcp://" + l.Addr().String(), b
+}
+
+func (b *broker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mutex.Lock()
+		b.conns = append(b.conns, conn)
+		b.mutex.Unlock()
+
+		b.wg.Add(1)
+		go func() {
+			defer b.wg.Done()
+			defer conn.Close()
+			if b.v5 {
+				b.handle5(conn)
+			} else {
+				b.handle3(conn)
+			}
+		}()
+	}
+}
+
+func (b *broker) handle3(conn net.Conn) {
+	for {
+		cp, err := packets3.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		var reply packets3.ControlPacket
+		switch p := cp.(type) {
+		case *packets3.ConnectPacket:
+			reply = packets3.NewControlPacket(packets3.Connack)
+		case *packets3.PublishPacket:
+			b.record(p.TopicName, p.Payload, p.Qos, p.Retain)
+			switch p.Qos {
+			case 1:
+				ack := packets3.NewControlPacket(packets3.Puback).(*packets3.PubackPacket)
+				ack.MessageID = p.MessageID
+				reply = ack
+			case 2:
+				rec := packets3.NewControlPacket(packets3.Pubrec).(*packets3.PubrecPacket)
+				rec.MessageID = p.MessageID
+				reply = rec
+			}
+		case *packets3.PubrelPacket:
+			comp := packets3.NewControlPacket(packets3.Pubcomp).(*packets3.PubcompPacket)
+			comp.MessageID = p.MessageID
+			reply = comp
+		case *packets3.PingreqPacket:
+			reply = packets3.NewControlPacket(packets3.Pingresp)
+		case *packets3.DisconnectPacket:
+			return
+		}
+		if reply != nil && reply.Write(conn) != nil {
+			return
+		}
+	}
+}
+
+func (b *broker) handle5(conn net.Conn) {
+	for {
+		cp, err := packets5.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		var reply *packets5.ControlPacket
+		switch p := cp.Content.(type) {
+		case *packets5.Connect:
+			reply = packets5.NewControlPacket(packets5.CONNACK)
+		case *packets5.Publish:
+			// The retain flag is not decoded by the packets package
+			b.record(p.Topic, p.Payload, p.QoS, cp.Flags&1 == 1)
+			switch p.QoS {
+			case 1:
+				reply = packets5.NewControlPacket(packets5.PUBACK)
+				reply.Content.(*packets5.Puback).PacketID = p.PacketID
+			case 2:
+				reply = packets5.NewControlPacket(packets5.PUBREC)
+				reply.Content.(*packets5.Pubrec).PacketID = p.PacketID
+			}
+		case *packets5.Pubrel:
+			reply = packets5.NewControlPacket(packets5.PUBCOMP)
+			reply.Content.(*packets5.Pubcomp).PacketID = p.PacketID
+		case *packets5.Pingreq:
+			reply = packets5.NewControlPacket(packets5.PINGRESP)
+		case *packets5.Disconnect:
+			return
+		}
+		if reply != nil {
+			if _, err := reply.WriteTo(conn); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (b *broker) record(topic string, payload []byte, qos byte, retain bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.messages = append(b.messages, message{topic: topic, payload: string(payload), qos: qos, retain: retain})
+}
+
+func (b *broker) received() []message {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]message(nil), b.messages...)
+}
+
+func (b *broker) close() {
+	b.listener.Close()
+	b.mutex.Lock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.mutex.Unlock()
+	b.wg.Wait()
+}
+
+func newTestOutput(t *testing.T, server, protocol string) *MQTT {
+	m := NewMQTT()
+	m.Servers = []string{server}
+	m.Protocol = protocol
+	m.QoS = 1
+	m.SetSerializer(influx.NewSerializer(false))
+	require.NoError(t, m.Init())
+	require.NoError(t, m.Connect())
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestWritePerMetric(t *testing.T) {
+	for _, protocol := range []string{"3.1.1", "5"} {
+		t.Run(protocol, func(t *testing.T) {
+			server, rec := startBroker(t, protocol)
+			m := newTestOutput(t, server, protocol)
+			m.Retain = true
+
+			require.NoError(t, m.Write([]models.Metric{newTestMetric("r1"), newTestMetric("r2")}))
+			require.Eventually(t, func() bool { return len(rec.received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+			msgs := rec.received()
+			require.Equal(t, "telemetry/r1/Cisco-IOS-XR-wdsysmon-fd-oper:system-monitoring/cpu-utilization", msgs[0].topic)
+			require.Equal(t, "telemetry/r2/Cisco-IOS-XR-wdsysmon-fd-oper:system-monitoring/cpu-utilization", msgs[1].topic)
+			require.Contains(t, msgs[0].payload, "total_cpu_one_minute=3i 42\n")
+			require.Equal(t, byte(1), msgs[0].qos)
+			require.True(t, msgs[0].retain)
+		})
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	server, rec := startBroker(t, "5")
+	m := newTestOutput(t, server, "5")
+	m.Topic = "telemetry/{source}"
+	m.BatchMessage = true
+
+	require.NoError(t, m.Write([]models.Metric{newTestMetric("r1"), newTestMetric("r2"), newTestMetric("r1")}))
+	require.Eventually(t, func() bool { return len(rec.received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	msgs := rec.received()
+	require.Equal(t, "telemetry/r1", msgs[0].topic)
+	require.Len(t, msgs[0].payload, 2*len(msgs[1].payload))
+	require.Equal(t, "telemetry/r2", msgs[1].topic)
+}
+
+func TestWriteReconnects(t *testing.T) {
+	for _, protocol := range []string{"3.1.1", "5"} {
+		t.Run(protocol, func(t *testing.T) {
+			server, rec := startBroker(t, protocol)
+			m := NewMQTT()
+			m.Servers = []string{server}
+			m.Protocol = protocol
+			m.QoS = 2
+			m.ClientID = "telemetry-test"
+			m.PersistentSession = true
+			m.SetSerializer(influx.NewSerializer(false))
+			require.NoError(t, m.Init())
+			require.NoError(t, m.Connect())
+			require.NoError(t, m.Write([]models.Metric{newTestMetric("r1")}))
+			require.NoError(t, m.Close())
+
+			require.NoError(t, m.Write([]models.Metric{newTestMetric("r2")}))
+			require.Eventually(t, func() bool { return len(rec.received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+			require.NoError(t, m.Close())
+		})
+	}
+}
+
+// failingClient publishes until failAfter messages were published.
+type failingClient struct {
+	failAfter int
+	topics    []string
+}
+
+func (c *failingClient) Connect() (bool, error) { return true, nil }
+func (c *failingClient) Close() error           { return nil }
+
+func (c *failingClient) Publish(topic string, _ []byte) error {
+	if len(c.topics) == c.failAfter {
+		return errors.New("connection lost")
+	}
+	c.topics = append(c.topics, topic)
+	return nil
+}
+
+// failingSerializer fails to serialize the metrics of source "bad".
+type failingSerializer struct {
+	serializers.Serializer
+}
+
+func (s failingSerializer) Serialize(metric models.Metric) ([]byte, error) {
+	return s.SerializeBatch([]models.Metric{metric})
+}
+
+func (s failingSerializer) SerializeBatch(metrics []models.Metric) ([]byte, error) {
+	for _, metric := range metrics {
+		if metric.(models.SeriesMetric).Series()[0].Tags["source"] == "bad" {
+			return nil, errors.New("invalid metric")
+		}
+	}
+	return []byte("ok\n"), nil
+}
+
+func TestWritePartialFailure(t *testing.T) {
+	metrics := []models.Metric{newTestMetric("r1"), newTestMetric("bad"), newTestMetric("r2"), newTestMetric("r3")}
+
+	// A failed publish and the following ones are written again, metrics
+	// which cannot be serialized are dropped
+	c := &failingClient{failAfter: 1}
+	m := NewMQTT()
+	m.Topic = "telemetry/{source}"
+	m.SetSerializer(failingSerializer{})
+	m.client = c
+	m.connected = true
+	err := m.Write(metrics)
+	var pwerr *models.PartialWriteError
+	require.ErrorAs(t, err, &pwerr)
+	require.Equal(t, []int{2, 3}, pwerr.Failed)
+	require.Equal(t, []int{1}, pwerr.Dropped)
+	require.Equal(t, []string{"telemetry/r1"}, c.topics)
+	require.False(t, m.connected)
+
+	// In batch mode only the topic which cannot be serialized is dropped
+	c = &failingClient{failAfter: 3}
+	m.client = c
+	m.connected = true
+	m.BatchMessage = true
+	m.UseBatchFormat = true
+	err = m.Write(metrics)
+	require.ErrorAs(t, err, &pwerr)
+	require.Empty(t, pwerr.Failed)
+	require.Equal(t, []int{1}, pwerr.Dropped)
+	require.Equal(t, []string{"telemetry/r1", "telemetry/r2", "telemetry/r3"}, c.topics)
+
+	c = &failingClient{failAfter: 1}
+	m.client = c
+	m.connected = true
+	err = m.Write(metrics)
+	require.ErrorAs(t, err, &pwerr)
+	require.Equal(t, []int{2, 3}, pwerr.Failed)
+	require.Equal(t, []int{1}, pwerr.Dropped)
+}
@@ -0,0 +1,117 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// clientV3 publishes with MQTT 3.1.1, the paho client reconnects on its own
+// and resends the unacknowledged messages of persistent sessions.
+type clientV3 struct {
+	output  *MQTT
+	options *paho.ClientOptions
+	client  paho.Client
+}
+
+func newClientV3(m *MQTT, tlsConfig *tls.Config) (*clientV3, error) {
+	opts := paho.NewClientOptions()
+	opts.SetProtocolVersion(4)
+	opts.SetClientID(m.ClientID)
+	opts.SetCleanSession(!m.PersistentSession)
+	opts.SetResumeSubs(m.PersistentSession)
+	opts.SetKeepAlive(time.Duration(m.KeepAlive) * time.Second)
+	opts.SetConnectTimeout(time.Duration(m.Timeout))
+	opts.SetWriteTimeout(time.Duration(m.Timeout))
+	opts.SetAutoReconnect(true)
+	opts.SetOrderMatters(false)
+	if m.Username != "" {
+		opts.SetUsername(m.Username)
+		opts.SetPassword(m.Password)
+	}
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	for _, server := range m.Servers {
+		u, err := brokerURL(server, tlsConfig != nil)
+		if err != nil {
+			return nil, err
+		}
+		opts.AddBroker(u.String())
+	}
+
+	opts.SetOnConnectHandler(func(paho.Client) {
+		m.log.Debugf("Connected to %v", m.Servers)
+	})
+	opts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		m.log.Warnf("Connection lost, reconnecting: %v", err)
+	})
+
+	return &clientV3{
+		output:  m,
+		options: opts,
+	}, nil
+}
+
+func (c *clientV3) Connect() (bool, error) {
+	if c.client == nil {
+		c.client = paho.NewClient(c.options)
+	}
+	token := c.client.Connect()
+	if !token.WaitTimeout(time.Duration(c.output.Timeout)) {
+		return false, fmt.Errorf("connecting timed out")
+	}
+	if err := token.Error(); err != nil {
+		return false, err
+	}
+	return token.(*paho.ConnectToken).SessionPresent(), nil
+}
+
+func (c *clientV3) Publish(topic string, payload []byte) error {
+	token := c.client.Publish(topic, byte(c.output.QoS), c.output.Retain, payload)
+	if !token.WaitTimeout(time.Duration(c.output.Timeout)) {
+		return fmt.Errorf("publishing timed out")
+	}
+	return token.Error()
+}
+
+func (c *clientV3) Close() error {
+	if c.client != nil && c.client.IsConnected() {
+		c.client.Disconnect(uint(time.Duration(c.output.Timeout).Milliseconds()))
+	}
+	return nil
+}
+
+// brokerURL normalizes the scheme of a server address, "tcp" addresses are
+// upgraded to "ssl" when TLS is configured.
+func brokerURL(server string, useTLS bool) (*url.URL, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server %q: %v", server, err)
+	}
+
+	switch u.Scheme {
+	case "", "tcp", "mqtt":
+		u.Scheme = "tcp"
+		if useTLS {
+			u.Scheme = "ssl"
+		}
+	case "ssl", "tls", "tcps", "mqtts":
+		u.Scheme = "ssl"
+	case "ws", "wss":
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q of server %q", u.Scheme, server)
+	}
+	if u.Port() == "" {
+		port := "1883"
+		if u.Scheme == "ssl" {
+			port = "8883"
+		}
+		u.Host = u.Host + ":" + port
+	}
+	return u, nil
+}
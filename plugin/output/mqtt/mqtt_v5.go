@@ -0,0 +1,149 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/eclipse/paho.golang/packets"
+	paho "github.com/eclipse/paho.golang/paho"
+)
+
+// clientV5 publishes with MQTT 5, a new connection is made to the first
+// reachable server on every Connect.
+type clientV5 struct {
+	output    *MQTT
+	servers   []*url.URL
+	tlsConfig *tls.Config
+	client    *paho.Client
+}
+
+func newClientV5(m *MQTT, tlsConfig *tls.Config) (*clientV5, error) {
+	c := &clientV5{
+		output:    m,
+		tlsConfig: tlsConfig,
+	}
+	for _, server := range m.Servers {
+		u, err := brokerURL(server, tlsConfig != nil)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme != "tcp" && u.Scheme != "ssl" {
+			return nil, fmt.Errorf("unsupported scheme %q of server %q with protocol 5", u.Scheme, server)
+		}
+		c.servers = append(c.servers, u)
+	}
+	return c, nil
+}
+
+func (c *clientV5) Connect() (bool, error) {
+	m := c.output
+	timeout := time.Duration(m.Timeout)
+
+	conn, err := c.dial(timeout)
+	if err != nil {
+		return false, err
+	}
+
+	client := paho.NewClient(paho.ClientConfig{
+		ClientID:      m.ClientID,
+		Conn:          conn,
+		PacketTimeout: timeout,
+		OnClientError: func(err error) {
+			m.log.Warnf("Connection lost: %v", err)
+		},
+		OnServerDisconnect: func(d *paho.Disconnect) {
+			m.log.Warnf("Server disconnected with reason code %d", d.ReasonCode)
+		},
+	})
+
+	cp := &paho.Connect{
+		ClientID:   m.ClientID,
+		KeepAlive:  uint16(m.KeepAlive),
+		CleanStart: !m.PersistentSession,
+	}
+	if m.Username != "" {
+		cp.Username = m.Username
+		cp.UsernameFlag = true
+		cp.Password = []byte(m.Password)
+		cp.PasswordFlag = true
+	}
+	if m.PersistentSession {
+		// Without an expiry interval the session ends with the connection
+		expiry := uint32(time.Duration(m.SessionExpiryInterval).Seconds())
+		if expiry == 0 {
+			expiry = 0xFFFFFFFF
+		}
+		cp.Properties = &paho.ConnectProperties{SessionExpiryInterval: &expiry}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ack, err := client.Connect(ctx, cp)
+	if err != nil {
+		if ack != nil && ack.Properties != nil && ack.Properties.ReasonString != "" {
+			return false, fmt.Errorf("%v: %s", err, ack.Properties.ReasonString)
+		}
+		return false, err
+	}
+
+	c.client = client
+	return ack.SessionPresent, nil
+}
+
+// dial connects to the first reachable server.
+func (c *clientV5) dial(timeout time.Duration) (net.Conn, error) {
+	var err error
+	for _, u := range c.servers {
+		var conn net.Conn
+		dialer := &net.Dialer{Timeout: timeout}
+		if u.Scheme == "ssl" {
+			tlsConfig := c.tlsConfig
+			if tlsConfig == nil {
+				tlsConfig = &tls.Config{}
+			}
+			conn, err = tls.DialWithDialer(dialer, "tcp", u.Host, tlsConfig)
+			if err == nil {
+				// TLS connections are not safe for concurrent writes
+				conn = packets.NewThreadSafeConn(conn)
+			}
+		} else {
+			conn, err = dialer.Dial("tcp", u.Host)
+		}
+		if err == nil {
+			return conn, nil
+		}
+		c.output.log.Errorf("Connecting to %s failed: %v", u.Host, err)
+	}
+	return nil, err
+}
+
+func (c *clientV5) Publish(topic string, payload []byte) error {
+	if c.client == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(c.output.Timeout))
+	defer cancel()
+
+	_, err := c.client.Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		QoS:     byte(c.output.QoS),
+		Retain:  c.output.Retain,
+		Payload: payload,
+	})
+	return err
+}
+
+func (c *clientV5) Close() error {
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	c.client = nil
+	return err
+}
@@ -0,0 +1,312 @@
+package opentelemetry
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+const (
+	temporalityCumulative = "cumulative"
+	temporalityDelta      = "delta"
+
+	scopeName = "telemetry"
+)
+
+// stream is the state of a sum, the first time it was seen is the start of
+// cumulative points and the last value is the base of delta points.
+type stream struct {
+	start time.Time
+	last  time.Time
+	value float64
+
+	// updated is when the stream was last exported.
+	updated time.Time
+}
+
+// converter builds OTLP ResourceMetrics from series. Fields become metrics
+// named after the series and the field path, the resource tags go into the
+// resource attributes and the other tags into the point attributes.
+type converter struct {
+	resourceTags map[string]bool
+	attributes   map[string]string
+	counters     []*regexp.Regexp
+	delta        bool
+
+	// streams holds the exported state of the sums, streams not updated
+	// for ttl are removed.
+	streams map[string]stream
+	ttl     time.Duration
+}
+
+type resourceEntry struct {
+	resource *resourcepb.Resource
+	metrics  map[string]*metricspb.Metric
+	names    []string
+}
+
+// convert returns the metrics as ResourceMetrics and the state of the sums
+// after them, the state is committed once the metrics are exported.
+func (c *converter) convert(metrics []models.Metric) ([]*metricspb.ResourceMetrics, map[string]stream) {
+	var keys []string
+	staged := make(map[string]stream)
+	resources := make(map[string]*resourceEntry)
+
+	for _, metric := range metrics {
+		sm, ok := metric.(models.SeriesMetric)
+		if !ok {
+			continue
+		}
+		for _, series := range sm.Series() {
+			resourceAttrs, pointAttrs := c.splitTags(series.Tags)
+			rkey := attributesKey(resourceAttrs)
+			entry, ok := resources[rkey]
+			if !ok {
+				entry = &resourceEntry{
+					resource: &resourcepb.Resource{Attributes: resourceAttrs},
+					metrics:  make(map[string]*metricspb.Metric),
+				}
+				resources[rkey] = entry
+				keys = append(keys, rkey)
+			}
+			c.addSeries(entry, rkey, series, pointAttrs, staged)
+		}
+	}
+
+	rms := make([]*metricspb.ResourceMetrics, 0, len(keys))
+	for _, key := range keys {
+		entry := resources[key]
+		sm := &metricspb.ScopeMetrics{
+			Scope: &commonpb.InstrumentationScope{Name: scopeName},
+		}
+		for _, name := range entry.names {
+			// Sums may have no points yet with delta temporality
+			m := entry.metrics[name]
+			if sum := m.GetSum(); sum != nil && len(sum.DataPoints) == 0 {
+				continue
+			}
+			sm.Metrics = append(sm.Metrics, m)
+		}
+		if len(sm.Metrics) == 0 {
+			continue
+		}
+		rms = append(rms, &metricspb.ResourceMetrics{
+			Resource:     entry.resource,
+			ScopeMetrics: []*metricspb.ScopeMetrics{sm},
+		})
+	}
+	return rms, staged
+}
+
+// commit keeps the state of the exported sums and removes the streams which
+// were not updated for the ttl.
+func (c *converter) commit(staged map[string]stream, now time.Time) {
+	for key, s := range staged {
+		s.updated = now
+		c.streams[key] = s
+	}
+	if c.ttl <= 0 {
+		return
+	}
+	for key, s := range c.streams {
+		if now.Sub(s.updated) > c.ttl {
+			delete(c.streams, key)
+		}
+	}
+}
+
+func (c *converter) addSeries(entry *resourceEntry, rkey string, series models.Series, attrs []*commonpb.KeyValue, staged map[string]stream) {
+	akey := attributesKey(attrs)
+	internal.Flatten("", series.Fields, "/", func(field string, value any) {
+		v, ok := toFloat(value)
+		if !ok {
+			return
+		}
+		name := series.Name
+		if field != "" && field != "value" {
+			name = series.Name + "/" + field
+		}
+
+		sum := c.isCounter(name, series)
+		m, ok := entry.metrics[name]
+		if !ok {
+			m = &metricspb.Metric{Name: name}
+			if sum {
+				temporality := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+				if c.delta {
+					temporality = metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+				}
+				m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+					AggregationTemporality: temporality,
+					IsMonotonic:            true,
+				}}
+			} else {
+				m.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}
+			}
+			entry.metrics[name] = m
+			entry.names = append(entry.names, name)
+		}
+
+		dp := &metricspb.NumberDataPoint{
+			Attributes:   attrs,
+			TimeUnixNano: uint64(series.Time.UnixNano()),
+		}
+		setValue(dp, value, v)
+
+		switch data := m.Data.(type) {
+		case *metricspb.Metric_Gauge:
+			data.Gauge.DataPoints = append(data.Gauge.DataPoints, dp)
+		case *metricspb.Metric_Sum:
+			if !c.sumPoint(staged, rkey+"\x00"+name+"\x00"+akey, dp, series.Time, v) {
+				return
+			}
+			data.Sum.DataPoints = append(data.Sum.DataPoints, dp)
+		}
+	})
+}
+
+// sumPoint sets the start time of a sum point, and its value to the
+// increase since the last point with delta temporality. The first point of
+// a delta stream only records the base value and is not sent. The new state
+// of the stream is staged.
+func (c *converter) sumPoint(staged map[string]stream, key string, dp *metricspb.NumberDataPoint, t time.Time, v float64) bool {
+	s, ok := staged[key]
+	if !ok {
+		s, ok = c.streams[key]
+	}
+	if !ok {
+		staged[key] = stream{start: t, last: t, value: v}
+		dp.StartTimeUnixNano = uint64(t.UnixNano())
+		return !c.delta
+	}
+
+	if !c.delta {
+		if v < s.value {
+			// Counter reset
+			s.start = t
+		}
+		s.last, s.value = t, v
+		staged[key] = s
+		dp.StartTimeUnixNano = uint64(s.start.UnixNano())
+		return true
+	}
+
+	delta := v - s.value
+	if delta < 0 {
+		delta = v
+	}
+	dp.StartTimeUnixNano = uint64(s.last.UnixNano())
+	if _, isInt := dp.Value.(*metricspb.NumberDataPoint_AsInt); isInt {
+		dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: int64(delta)}
+	} else {
+		dp.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: delta}
+	}
+	s.last, s.value = t, v
+	staged[key] = s
+	return true
+}
+
+func (c *converter) isCounter(name string, series models.Series) bool {
+	for _, re := range c.counters {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return series.Type == models.Counter
+}
+
+func (c *converter) splitTags(tags map[string]string) ([]*commonpb.KeyValue, []*commonpb.KeyValue) {
+	resource := make(map[string]string, len(c.attributes))
+	point := make(map[string]string, len(tags))
+	for k, v := range c.attributes {
+		resource[k] = v
+	}
+	for k, v := range tags {
+		if c.resourceTags[k] {
+			resource[k] = v
+		} else {
+			point[k] = v
+		}
+	}
+	return keyValues(resource), keyValues(point)
+}
+
+func keyValues(m map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, &commonpb.KeyValue{
+			Key:   k,
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: m[k]}},
+		})
+	}
+	return kvs
+}
+
+// attributesKey identifies a sorted attribute set.
+func attributesKey(kvs []*commonpb.KeyValue) string {
+	var b strings.Builder
+	for _, kv := range kvs {
+		b.WriteString(kv.Key)
+		b.WriteByte('=')
+		b.WriteString(kv.Value.GetStringValue())
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func setValue(dp *metricspb.NumberDataPoint, value any, v float64) {
+	switch value := value.(type) {
+	case int64:
+		dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: value}
+	case int:
+		dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: int64(value)}
+	case uint64:
+		if value > math.MaxInt64 {
+			value = math.MaxInt64
+		}
+		dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: int64(value)}
+	case bool:
+		dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: int64(v)}
+	default:
+		dp.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: v}
+	}
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, !math.IsNaN(v)
+	case float32:
+		return float64(v), !math.IsNaN(float64(v))
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return math.MaxInt64, true
+		}
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,293 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"telemetry/internal"
+	"telemetry/models"
+	"telemetry/plugin/common/tls"
+)
+
+const (
+	defaultGRPCAddress = "localhost:4317"
+	defaultHTTPAddress = "http://localhost:4318/v1/metrics"
+	defaultTimeout     = internal.Duration(5 * time.Second)
+	defaultStreamTTL   = internal.Duration(time.Hour)
+
+	maxErrMsgLen = 1024
+)
+
+var defaultResourceTags = []string{"source", "node_id"}
+
+type OpenTelemetry struct {
+	ServiceAddress string            `json:"service_address"`
+	Protocol       string            `json:"protocol"`
+	Timeout        internal.Duration `json:"timeout"`
+	Compression    string            `json:"compression"`
+	Headers        map[string]string `json:"headers"`
+	ResourceTags   []string          `json:"resource_tags"`
+	Attributes     map[string]string `json:"attributes"`
+	Temporality    string            `json:"temporality"`
+	Counters       []string          `json:"counters"`
+	StreamTTL      internal.Duration `json:"stream_ttl"`
+
+	tls.ClientConfig
+
+	log *logrus.Entry
+
+	converter  *converter
+	grpcConn   *grpc.ClientConn
+	grpcClient colmetricspb.MetricsServiceClient
+	httpClient *http.Client
+}
+
+func NewOpenTelemetry() *OpenTelemetry {
+	return &OpenTelemetry{
+		Protocol:     "grpc",
+		Timeout:      defaultTimeout,
+		Compression:  "gzip",
+		ResourceTags: defaultResourceTags,
+		Temporality:  temporalityCumulative,
+		StreamTTL:    defaultStreamTTL,
+		log:          models.NewLogger("outputs.opentelemetry"),
+	}
+}
+
+func (o *OpenTelemetry) Init() error {
+	switch o.Protocol {
+	case "", "grpc":
+		o.Protocol = "grpc"
+		if o.ServiceAddress == "" {
+			o.ServiceAddress = defaultGRPCAddress
+		}
+	case "http":
+		if o.ServiceAddress == "" {
+			o.ServiceAddress = defaultHTTPAddress
+		}
+	default:
+		return fmt.Errorf("invalid protocol %q, must be \"grpc\" or \"http\"", o.Protocol)
+	}
+
+	switch o.Compression {
+	case "", "none", "gzip":
+	default:
+		return fmt.Errorf("invalid compression %q, must be \"gzip\" or \"none\"", o.Compression)
+	}
+
+	c := &converter{
+		resourceTags: make(map[string]bool, len(o.ResourceTags)),
+		attributes:   o.Attributes,
+		streams:      make(map[string]stream),
+		ttl:          time.Duration(o.StreamTTL),
+	}
+	for _, tag := range o.ResourceTags {
+		c.resourceTags[tag] = true
+	}
+	switch o.Temporality {
+	case "", temporalityCumulative:
+	case temporalityDelta:
+		c.delta = true
+	default:
+		return fmt.Errorf("invalid temporality %q, must be %q or %q", o.Temporality, temporalityCumulative, temporalityDelta)
+	}
+	for _, glob := range o.Counters {
+		re, err := internal.CompileGlob(glob)
+		if err != nil {
+			return fmt.Errorf("invalid counter filter %q: %v", glob, err)
+		}
+		c.counters = append(c.counters, re)
+	}
+	o.converter = c
+
+	return nil
+}
+
+func (o *OpenTelemetry) Connect() error {
+	tlsConfig, err := o.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	if o.Protocol == "http" {
+		o.httpClient = &http.Client{
+			Timeout: time.Duration(o.Timeout),
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		}
+		return nil
+	}
+
+	var opts []grpc.DialOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	}
+	if o.Compression == "gzip" {
+		opts = append(opts, grpc.WithDefaultCallOptions(grpc.UseCompressor(grpcgzip.Name)))
+	}
+
+	conn, err := grpc.Dial(o.ServiceAddress, opts...)
+	if err != nil {
+		return err
+	}
+	o.grpcConn = conn
+	o.grpcClient = colmetricspb.NewMetricsServiceClient(conn)
+	return nil
+}
+
+func (o *OpenTelemetry) Close() error {
+	if o.grpcConn != nil {
+		err := o.grpcConn.Close()
+		o.grpcConn = nil
+		return err
+	}
+	if o.httpClient != nil {
+		o.httpClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Write exports the metrics, the state of the sums is only updated once
+// they are exported so that a batch written again yields the same points.
+func (o *OpenTelemetry) Write(metrics []models.Metric) error {
+	rms, staged := o.converter.convert(metrics)
+	if len(rms) == 0 {
+		o.converter.commit(staged, time.Now())
+		return nil
+	}
+	req := &colmetricspb.ExportMetricsServiceRequest{ResourceMetrics: rms}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(o.Timeout))
+	defer cancel()
+
+	var err error
+	if o.Protocol == "http" {
+		err = o.exportHTTP(ctx, req)
+	} else {
+		err = o.exportGRPC(ctx, req)
+	}
+	if err != nil {
+		return err
+	}
+	o.converter.commit(staged, time.Now())
+	return nil
+}
+
+func (o *OpenTelemetry) exportGRPC(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	if len(o.Headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(o.Headers))
+	}
+
+	resp, err := o.grpcClient.Export(ctx, req)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.InvalidArgument, codes.Unimplemented, codes.PermissionDenied, codes.Unauthenticated:
+			return &models.PermanentError{Err: fmt.Errorf("export failed: %v", err)}
+		}
+		return fmt.Errorf("export failed: %v", err)
+	}
+	o.logPartialSuccess(resp)
+	return nil
+}
+
+func (o *OpenTelemetry) exportHTTP(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return &models.PermanentError{Err: err}
+	}
+	if o.Compression == "gzip" {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, o.ServiceAddress, bytes.NewReader(body))
+	if err != nil {
+		return &models.PermanentError{Err: err}
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "telemetry")
+	if o.Compression == "gzip" {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range o.Headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		var exportResp colmetricspb.ExportMetricsServiceResponse
+		if err := proto.Unmarshal(b, &exportResp); err == nil {
+			o.logPartialSuccess(&exportResp)
+		}
+		return nil
+	}
+
+	if len(b) > maxErrMsgLen {
+		b = b[:maxErrMsgLen]
+	}
+	err = fmt.Errorf("export to [%s] failed with status %s: %s", o.ServiceAddress, resp.Status, b)
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return &models.PermanentError{Err: err}
+	}
+	return err
+}
+
+func (o *OpenTelemetry) logPartialSuccess(resp *colmetricspb.ExportMetricsServiceResponse) {
+	if ps := resp.GetPartialSuccess(); ps != nil && ps.GetRejectedDataPoints() > 0 {
+		o.log.Warnf("Receiver rejected %d data points: %s", ps.GetRejectedDataPoints(), ps.GetErrorMessage())
+	}
+}
+
+func (o *OpenTelemetry) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, o)
+	if err != nil {
+		return fmt.Errorf("[opentelemetry] config error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package opentelemetry
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"telemetry/models"
+)
+
+func newTestMetric(t time.Time, bytes int64) models.Metric {
+	return models.NewSeriesMetric([]models.Series{{
+		Name: "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+		Tags: map[string]string{"source": "10.0.0.1", "node_id": "r1", "interface_name": "Gi0/0/0/0"},
+		Fields: map[string]any{
+			"bytes_received":        bytes,
+			"last_discontinuity_ts": 0.5,
+		},
+		Time: t,
+	}}...)
+}
+
+type metricsServer struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+
+	requests chan *colmetricspb.ExportMetricsServiceRequest
+}
+
+func (s *metricsServer) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.requests <- req
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestWriteGRPC(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &metricsServer{requests: make(chan *colmetricspb.ExportMetricsServiceRequest, 2)}
+	server := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(server, srv)
+	go server.Serve(l)
+	defer server.Stop()
+
+	o := NewOpenTelemetry()
+	o.ServiceAddress = l.Addr().String()
+	o.Attributes = map[string]string{"service.name": "telemetry"}
+	o.Counters = []string{"*/bytes_*"}
+	require.NoError(t, o.Init())
+	require.NoError(t, o.Connect())
+	defer o.Close()
+
+	start := time.Unix(100, 0)
+	require.NoError(t, o.Write([]models.Metric{newTestMetric(start, 10)}))
+	require.NoError(t, o.Write([]models.Metric{newTestMetric(start.Add(10*time.Second), 25)}))
+
+	<-srv.requests
+	req := <-srv.requests
+	require.Len(t, req.ResourceMetrics, 1)
+	rm := req.ResourceMetrics[0]
+
+	attrs := make(map[string]string)
+	for _, kv := range rm.Resource.Attributes {
+		attrs[kv.Key] = kv.Value.GetStringValue()
+	}
+	require.Equal(t, map[string]string{"service.name": "telemetry", "source": "10.0.0.1", "node_id": "r1"}, attrs)
+
+	metrics := rm.ScopeMetrics[0].Metrics
+	require.Len(t, metrics, 2)
+	for _, m := range metrics {
+		switch m.Name {
+		case "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters/bytes_received":
+			sum := m.GetSum()
+			require.NotNil(t, sum)
+			require.True(t, sum.IsMonotonic)
+			require.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, sum.AggregationTemporality)
+			dp := sum.DataPoints[0]
+			require.Equal(t, int64(25), dp.GetAsInt())
+			require.Equal(t, uint64(start.UnixNano()), dp.StartTimeUnixNano)
+			require.Equal(t, "interface_name", dp.Attributes[0].Key)
+		case "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters/last_discontinuity_ts":
+			require.Equal(t, 0.5, m.GetGauge().DataPoints[0].GetAsDouble())
+		default:
+			t.Fatalf("unexpected metric %q", m.Name)
+		}
+	}
+}
+
+func TestWriteHTTPDelta(t *testing.T) {
+	requests := make(chan *colmetricspb.ExportMetricsServiceRequest, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		require.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		gz, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		require.NoError(t, err)
+
+		var req colmetricspb.ExportMetricsServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &req))
+		requests <- &req
+	}))
+	defer ts.Close()
+
+	o := NewOpenTelemetry()
+	o.Protocol = "http"
+	o.ServiceAddress = ts.URL + "/v1/metrics"
+	o.Headers = map[string]string{"X-Api-Key": "secret"}
+	o.Temporality = "delta"
+	o.Counters = []string{"*/bytes_*"}
+	require.NoError(t, o.Init())
+	require.NoError(t, o.Connect())
+	defer o.Close()
+
+	start := time.Unix(100, 0)
+	require.NoError(t, o.Write([]models.Metric{newTestMetric(start, 10)}))
+	require.NoError(t, o.Write([]models.Metric{newTestMetric(start.Add(10*time.Second), 25)}))
+
+	// The first point of the delta sum is only a base value
+	first := <-requests
+	require.Len(t, first.ResourceMetrics[0].ScopeMetrics[0].Metrics, 1)
+	require.NotNil(t, first.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetGauge())
+
+	second := <-requests
+	require.Len(t, second.ResourceMetrics[0].ScopeMetrics[0].Metrics, 2)
+	for _, m := range second.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if sum := m.GetSum(); sum != nil {
+			require.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA, sum.AggregationTemporality)
+			require.Equal(t, int64(15), sum.DataPoints[0].GetAsInt())
+			require.Equal(t, uint64(start.UnixNano()), sum.DataPoints[0].StartTimeUnixNano)
+		}
+	}
+}
+
+func TestWriteFailureKeepsStreams(t *testing.T) {
+	var fail atomic.Bool
+	requests := make(chan *colmetricspb.ExportMetricsServiceRequest, 2)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req colmetricspb.ExportMetricsServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &req))
+		requests <- &req
+	}))
+	defer ts.Close()
+
+	o := NewOpenTelemetry()
+	o.Protocol = "http"
+	o.ServiceAddress = ts.URL + "/v1/metrics"
+	o.Compression = "none"
+	o.Temporality = "delta"
+	o.Counters = []string{"*/bytes_*"}
+	require.NoError(t, o.Init())
+	require.NoError(t, o.Connect())
+	defer o.Close()
+
+	start := time.Unix(100, 0)
+	require.NoError(t, o.Write([]models.Metric{newTestMetric(start, 10)}))
+	<-requests
+
+	// The failed batch is written again with the same delta
+	batch := []models.Metric{newTestMetric(start.Add(10*time.Second), 25)}
+	fail.Store(true)
+	require.Error(t, o.Write(batch))
+	fail.Store(false)
+	require.NoError(t, o.Write(batch))
+
+	req := <-requests
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if sum := m.GetSum(); sum != nil {
+			require.Equal(t, int64(15), sum.DataPoints[0].GetAsInt())
+			require.Equal(t, uint64(start.UnixNano()), sum.DataPoints[0].StartTimeUnixNano)
+		}
+	}
+}
+
+func TestStreamTTL(t *testing.T) {
+	c := &converter{streams: make(map[string]stream), ttl: time.Minute}
+	now := time.Now()
+	c.commit(map[string]stream{"a": {value: 1}, "b": {value: 2}}, now.Add(-2*time.Minute))
+	c.commit(map[string]stream{"b": {value: 3}}, now)
+	require.Equal(t, map[string]stream{"b": {value: 3, updated: now}}, c.streams)
+}
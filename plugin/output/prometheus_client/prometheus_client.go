@@ -0,0 +1,211 @@
+package prometheus_client
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"telemetry/internal"
+	"telemetry/models"
+	interTLS "telemetry/plugin/common/tls"
+	"telemetry/plugin/serializers/prometheus"
+)
+
+const (
+	defaultListen             = ":9273"
+	defaultPath               = "/metrics"
+	defaultExpirationInterval = internal.Duration(60 * time.Second)
+	defaultReadTimeout        = 10 * time.Second
+	defaultWriteTimeout       = 10 * time.Second
+
+	contentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+type PrometheusClient struct {
+	Listen             string            `json:"listen"`
+	Path               string            `json:"path"`
+	BasicUsername      string            `json:"basic_username"`
+	BasicPassword      string            `json:"basic_password"`
+	ExpirationInterval internal.Duration `json:"expiration_interval"`
+	ExportTimestamp    bool              `json:"export_timestamp"`
+	Counters           []string          `json:"counters"`
+	Gauges             []string          `json:"gauges"`
+
+	interTLS.ServerConfig
+
+	log *logrus.Entry
+
+	server     *http.Server
+	url        string
+	collection *prometheus.Collection
+	mutex      sync.Mutex
+	wg         sync.WaitGroup
+}
+
+func NewPrometheusClient() *PrometheusClient {
+	return &PrometheusClient{
+		Listen:             defaultListen,
+		Path:               defaultPath,
+		ExpirationInterval: defaultExpirationInterval,
+		log:                models.NewLogger("outputs.prometheus_client"),
+	}
+}
+
+func (p *PrometheusClient) Init() error {
+	serializer, err := prometheus.NewSerializer(p.ExportTimestamp, false, p.Counters, p.Gauges)
+	if err != nil {
+		return err
+	}
+	p.collection = serializer.NewCollection()
+
+	if p.Path == "" {
+		p.Path = defaultPath
+	}
+	if p.Listen == "" {
+		p.Listen = defaultListen
+	}
+	return nil
+}
+
+func (p *PrometheusClient) Connect() error {
+	tlsConfig, err := p.ServerConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(p.Path, p.auth(http.HandlerFunc(p.serveMetrics)))
+
+	p.server = &http.Server{
+		Handler:      mux,
+		ReadTimeout:  defaultReadTimeout,
+		WriteTimeout: defaultWriteTimeout,
+		TLSConfig:    tlsConfig,
+	}
+
+	listener, err := net.Listen("tcp", p.Listen)
+	if err != nil {
+		return err
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+	p.url = fmt.Sprintf("%s://%s%s", scheme, listener.Addr(), p.Path)
+	p.log.Infof("Listening on %s", p.url)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		var err error
+		if tlsConfig != nil {
+			err = p.server.ServeTLS(listener, "", "")
+		} else {
+			err = p.server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			p.log.Errorf("Server error: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+func (p *PrometheusClient) Close() error {
+	if p.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := p.server.Shutdown(ctx)
+	p.wg.Wait()
+	return err
+}
+
+// Write keeps the latest value of every series until it expires.
+func (p *PrometheusClient) Write(metrics []models.Metric) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := time.Now()
+	for _, metric := range metrics {
+		sm, ok := metric.(models.SeriesMetric)
+		if !ok {
+			p.log.Debugf("Could not convert metric of type %T", metric)
+			continue
+		}
+		for _, series := range sm.Series() {
+			p.collection.Add(series, now)
+		}
+	}
+	p.expire(now)
+	return nil
+}
+
+func (p *PrometheusClient) expire(now time.Time) {
+	if p.ExpirationInterval > 0 {
+		p.collection.Expire(now.Add(-time.Duration(p.ExpirationInterval)))
+	}
+}
+
+func (p *PrometheusClient) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+
+	var buf bytes.Buffer
+	p.mutex.Lock()
+	p.expire(time.Now())
+	p.collection.Write(&buf, openMetrics)
+	p.mutex.Unlock()
+
+	if openMetrics {
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", contentTypeText)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		p.log.Debugf("Writing response failed: %v", err)
+	}
+}
+
+func (p *PrometheusClient) auth(next http.Handler) http.Handler {
+	if p.BasicUsername == "" && p.BasicPassword == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(p.BasicUsername)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(p.BasicPassword)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="telemetry"`)
+			http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *PrometheusClient) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, p)
+	if err != nil {
+		return fmt.Errorf("[prometheus_client] config error: %v", err)
+	}
+	return nil
+}
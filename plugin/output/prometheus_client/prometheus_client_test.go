@@ -0,0 +1,136 @@
+package prometheus_client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+func newTestMetric(source string, received uint64) models.Metric {
+	return models.NewSeriesMetric(models.Series{
+		Name:   "interface",
+		Tags:   map[string]string{"source": source},
+		Fields: map[string]any{"bytes_received": received, "name": "Hu0/0/0/1"},
+		Time:   time.UnixMilli(1678183200005),
+	})
+}
+
+func newTestClient(t *testing.T) *PrometheusClient {
+	p := NewPrometheusClient()
+	p.Counters = []string{"*_bytes_received"}
+	require.NoError(t, p.Init())
+	return p
+}
+
+// scrape returns the response of the metrics handler.
+func scrape(p *PrometheusClient, accept string) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, defaultPath, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	p.auth(http.HandlerFunc(p.serveMetrics)).ServeHTTP(w, req)
+	return w.Result()
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestWriteKeepsLatestSample(t *testing.T) {
+	p := newTestClient(t)
+	require.NoError(t, p.Write([]models.Metric{newTestMetric("r1", 10), newTestMetric("r2", 20)}))
+	require.NoError(t, p.Write([]models.Metric{newTestMetric("r1", 30)}))
+
+	resp := scrape(p, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, contentTypeText, resp.Header.Get("Content-Type"))
+	require.Equal(t, `# HELP interface_bytes_received_total Telemetry field bytes_received of interface
+# TYPE interface_bytes_received_total counter
+interface_bytes_received_total{source="r1"} 30
+interface_bytes_received_total{source="r2"} 20
+`, readBody(t, resp))
+}
+
+func TestOpenMetricsNegotiation(t *testing.T) {
+	p := newTestClient(t)
+	require.NoError(t, p.Write([]models.Metric{newTestMetric("r1", 10)}))
+
+	resp := scrape(p, "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	require.Equal(t, contentTypeOpenMetrics, resp.Header.Get("Content-Type"))
+	require.Equal(t, `# HELP interface_bytes_received Telemetry field bytes_received of interface
+# TYPE interface_bytes_received counter
+interface_bytes_received_total{source="r1"} 10
+# EOF
+`, readBody(t, resp))
+
+	resp = scrape(p, "text/plain")
+	require.Equal(t, contentTypeText, resp.Header.Get("Content-Type"))
+	require.NotContains(t, readBody(t, resp), "# EOF")
+}
+
+func TestExpirationInterval(t *testing.T) {
+	p := newTestClient(t)
+	p.ExpirationInterval = internal.Duration(50 * time.Millisecond)
+	require.NoError(t, p.Write([]models.Metric{newTestMetric("r1", 10)}))
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, p.Write([]models.Metric{newTestMetric("r2", 20)}))
+
+	// The sample of r1 expired on the write of r2
+	body := readBody(t, scrape(p, ""))
+	require.NotContains(t, body, `source="r1"`)
+	require.Contains(t, body, `interface_bytes_received_total{source="r2"} 20`)
+
+	// The sample of r2 expires on the scrape
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, readBody(t, scrape(p, "")))
+}
+
+func TestBasicAuth(t *testing.T) {
+	p := newTestClient(t)
+	p.Listen = "127.0.0.1:0"
+	p.BasicUsername = "user"
+	p.BasicPassword = "secret"
+	require.NoError(t, p.Connect())
+	defer p.Close()
+	require.NoError(t, p.Write([]models.Metric{newTestMetric("r1", 10)}))
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		status   int
+	}{
+		{name: "no credentials", status: http.StatusUnauthorized},
+		{name: "wrong password", username: "user", password: "wrong", status: http.StatusUnauthorized},
+		{name: "valid", username: "user", password: "secret", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, p.url, nil)
+			require.NoError(t, err)
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			body := readBody(t, resp)
+			require.Equal(t, tt.status, resp.StatusCode)
+			if tt.status == http.StatusOK {
+				require.Contains(t, body, `interface_bytes_received_total{source="r1"} 10`)
+			} else {
+				require.Equal(t, `Basic realm="telemetry"`, resp.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package socket_writer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"telemetry/internal"
+	"telemetry/models"
+	interTLS "telemetry/plugin/common/tls"
+	"telemetry/plugin/serializers"
+)
+
+const (
+	// Payload of an UDP datagram in an unfragmented ethernet frame
+	defaultMaxDatagramSize = 1472
+
+	defaultTimeout = internal.Duration(5 * time.Second)
+)
+
+type SocketWriter struct {
+	Address         string             `json:"address"`
+	KeepAlivePeriod *internal.Duration `json:"keep_alive_period"`
+	Timeout         internal.Duration  `json:"timeout"`
+	MaxDatagramSize int                `json:"max_datagram_size"`
+
+	interTLS.ClientConfig
+
+	log *logrus.Entry
+
+	network    string
+	addr       string
+	serializer serializers.Serializer
+	conn       net.Conn
+}
+
+func NewSocketWriter() *SocketWriter {
+	return &SocketWriter{
+		Timeout:         defaultTimeout,
+		MaxDatagramSize: defaultMaxDatagramSize,
+		log:             models.NewLogger("outputs.socket_writer"),
+	}
+}
+
+func (sw *SocketWriter) SetSerializer(serializer serializers.Serializer) {
+	sw.serializer = serializer
+}
+
+func (sw *SocketWriter) Init() error {
+	spl := strings.SplitN(sw.Address, "://", 2)
+	if len(spl) != 2 {
+		return fmt.Errorf("invalid address: %s", sw.Address)
+	}
+	sw.network, sw.addr = spl[0], spl[1]
+
+	switch sw.network {
+	case "tcp", "tcp4", "tcp6", "unix":
+	case "udp", "udp4", "udp6", "unixgram":
+		if sw.TLSCA != "" || sw.TLSCert != "" || sw.InsecureSkipVerify {
+			return fmt.Errorf("tls is not supported with %s", sw.network)
+		}
+	default:
+		return fmt.Errorf("unsupported network %q, must be tcp, udp, unix or unixgram", sw.network)
+	}
+
+	if sw.MaxDatagramSize <= 0 {
+		sw.MaxDatagramSize = defaultMaxDatagramSize
+	}
+	return nil
+}
+
+func (sw *SocketWriter) Connect() error {
+	tlsConfig, err := sw.ClientConfig.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: time.Duration(sw.Timeout)}
+	var conn net.Conn
+	if tlsConfig != nil && sw.stream() {
+		conn, err = tls.DialWithDialer(dialer, sw.network, sw.addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial(sw.network, sw.addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := sw.setKeepAlive(conn); err != nil {
+		sw.log.Debugf("Unable to configure keep alive (%s): %s", sw.Address, err)
+	}
+	sw.conn = conn
+	return nil
+}
+
+func (sw *SocketWriter) setKeepAlive(c net.Conn) error {
+	if sw.KeepAlivePeriod == nil {
+		return nil
+	}
+
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		c = tlsConn.NetConn()
+	}
+	tcpc, ok := c.(*net.TCPConn)
+	if !ok {
+		return fmt.Errorf("cannot set keep alive on a %s socket", sw.network)
+	}
+	if *sw.KeepAlivePeriod == 0 {
+		return tcpc.SetKeepAlive(false)
+	}
+	if err := tcpc.SetKeepAlive(true); err != nil {
+		return err
+	}
+	return tcpc.SetKeepAlivePeriod(time.Duration(*sw.KeepAlivePeriod))
+}
+
+func (sw *SocketWriter) Close() error {
+	if sw.conn == nil {
+		return nil
+	}
+	err := sw.conn.Close()
+	sw.conn = nil
+	return err
+}
+
+// Write sends the serialized metrics, on datagram sockets they are packed
+// into datagrams of at most max_datagram_size bytes split between lines.
+func (sw *SocketWriter) Write(metrics []models.Metric) error {
+	if sw.conn == nil {
+		// The connection was closed after a failed write
+		if err := sw.Connect(); err != nil {
+			return err
+		}
+	}
+
+	var payload bytes.Buffer
+	for _, metric := range metrics {
+		b, err := sw.serializer.Serialize(metric)
+		if err != nil {
+			sw.log.Debugf("Could not serialize metric: %v", err)
+			continue
+		}
+		payload.Write(b)
+	}
+	if payload.Len() == 0 {
+		return nil
+	}
+
+	if sw.stream() {
+		return sw.send(payload.Bytes())
+	}
+	for _, datagram := range splitDatagrams(payload.Bytes(), sw.MaxDatagramSize) {
+		if len(datagram) > sw.MaxDatagramSize {
+			sw.log.Warnf("Line of %d bytes exceeds the maximum datagram size of %d bytes", len(datagram), sw.MaxDatagramSize)
+		}
+		if err := sw.send(datagram); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send writes b, reconnecting once if the peer closed the connection.
+func (sw *SocketWriter) send(b []byte) error {
+	err := sw.write(b)
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		sw.log.Debugf("Connection to %s broken, reconnecting: %v", sw.Address, err)
+		sw.Close()
+		if errConnect := sw.Connect(); errConnect == nil {
+			if err = sw.write(b); err == nil {
+				return nil
+			}
+		}
+	}
+
+	// Reconnect on the next write
+	sw.Close()
+	return err
+}
+
+func (sw *SocketWriter) write(b []byte) error {
+	if err := sw.conn.SetWriteDeadline(time.Now().Add(time.Duration(sw.Timeout))); err != nil {
+		return err
+	}
+	_, err := sw.conn.Write(b)
+	return err
+}
+
+func (sw *SocketWriter) stream() bool {
+	switch sw.network {
+	case "tcp", "tcp4", "tcp6", "unix":
+		return true
+	}
+	return false
+}
+
+// splitDatagrams packs the lines of payload into chunks of at most size
+// bytes, a line longer than size is a chunk on its own.
+func splitDatagrams(payload []byte, size int) [][]byte {
+	var datagrams [][]byte
+	var current []byte
+	for len(payload) > 0 {
+		line := payload
+		if i := bytes.IndexByte(payload, '\n'); i >= 0 {
+			line = payload[:i+1]
+		}
+		payload = payload[len(line):]
+
+		if len(current) > 0 && len(current)+len(line) > size {
+			datagrams = append(datagrams, current)
+			current = nil
+		}
+		current = append(current, line...)
+	}
+	if len(current) > 0 {
+		datagrams = append(datagrams, current)
+	}
+	return datagrams
+}
+
+func (sw *SocketWriter) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, sw)
+	if err != nil {
+		return fmt.Errorf("[socket_writer] config error: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package socket_writer
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+	"telemetry/plugin/serializers/influx"
+)
+
+func newTestMetric(n int) models.Metric {
+	series := make([]models.Series, 0, n)
+	for i := 0; i < n; i++ {
+		series = append(series, models.Series{
+			Name:   "cpu",
+			Tags:   map[string]string{"cpu": "cpu0"},
+			Fields: map[string]any{"time_idle": float64(i)},
+			Time:   time.Unix(0, 42),
+		})
+	}
+	return models.NewSeriesMetric(series...)
+}
+
+func newTestOutput(t *testing.T, address string) *SocketWriter {
+	sw := NewSocketWriter()
+	sw.Address = address
+	sw.SetSerializer(influx.NewSerializer(false))
+	require.NoError(t, sw.Init())
+	require.NoError(t, sw.Connect())
+	t.Cleanup(func() { sw.Close() })
+	return sw
+}
+
+func TestWriteUDPSplitsDatagrams(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sw := newTestOutput(t, "udp://"+conn.LocalAddr().String())
+	sw.MaxDatagramSize = 100
+
+	// Each line is 28 bytes, three fit in a datagram
+	require.NoError(t, sw.Write([]models.Metric{newTestMetric(7)}))
+
+	buf := make([]byte, 1024)
+	var sizes []int
+	for i := 0; i < 3; i++ {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		sizes = append(sizes, n)
+	}
+	require.Equal(t, []int{84, 84, 28}, sizes)
+}
+
+func TestWriteTCPReconnects(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	sw := newTestOutput(t, "tcp://"+l.Addr().String())
+
+	// The server closes the first connection
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				lines <- scanner.Text()
+			}
+		}
+	}()
+
+	// Writes on the closed connection fail, until the writer reconnects
+	require.Eventually(t, func() bool {
+		return sw.Write([]models.Metric{newTestMetric(1)}) == nil && len(lines) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, "cpu,cpu=cpu0 time_idle=0 42", <-lines)
+}
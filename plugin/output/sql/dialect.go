@@ -0,0 +1,212 @@
+package sql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// kind is the type of a column.
+type kind int
+
+const (
+	kindText kind = iota
+	kindFloat
+	kindInt
+	kindUint
+	kindBool
+	kindTime
+)
+
+// dialect holds the differences between the supported databases.
+type dialect struct {
+	// maxParams is the number of parameters a statement may have
+	maxParams int
+
+	// maxIdentifierLen is the length of table and column names, longer
+	// names are truncated and made unique with a hash suffix
+	maxIdentifierLen int
+
+	types map[kind]string
+
+	// columnsQuery lists the name and type of the columns of a table
+	columnsQuery string
+
+	// addColumn is the statement adding a column to a table
+	addColumn string
+
+	placeholder func(i int) string
+	kindOf      func(dataType string) kind
+}
+
+var postgres = &dialect{
+	maxParams:        65535,
+	maxIdentifierLen: 63,
+	types: map[kind]string{
+		kindText:  "TEXT",
+		kindFloat: "DOUBLE PRECISION",
+		kindInt:   "BIGINT",
+		kindUint:  "NUMERIC(20,0)",
+		kindBool:  "BOOLEAN",
+		kindTime:  "TIMESTAMPTZ",
+	},
+	columnsQuery: "SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1",
+	addColumn:    "ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s",
+	placeholder: func(i int) string {
+		return "$" + strconv.Itoa(i)
+	},
+	kindOf: func(dataType string) kind {
+		switch strings.ToLower(dataType) {
+		case "double precision", "real":
+			return kindFloat
+		case "bigint", "integer", "smallint":
+			return kindInt
+		case "numeric":
+			return kindUint
+		case "boolean":
+			return kindBool
+		case "timestamp with time zone", "timestamp without time zone":
+			return kindTime
+		}
+		return kindText
+	},
+}
+
+var sqlite = &dialect{
+	maxParams: 32766,
+	types: map[kind]string{
+		kindText:  "TEXT",
+		kindFloat: "REAL",
+		kindInt:   "INTEGER",
+		kindUint:  "INTEGER",
+		kindBool:  "BOOLEAN",
+		kindTime:  "TIMESTAMP",
+	},
+	columnsQuery: "SELECT name, type FROM pragma_table_info(?)",
+	addColumn:    "ALTER TABLE %s ADD COLUMN %s %s",
+	placeholder: func(int) string {
+		return "?"
+	},
+	kindOf: func(dataType string) kind {
+		switch strings.ToUpper(dataType) {
+		case "REAL", "DOUBLE", "FLOAT":
+			return kindFloat
+		case "INTEGER", "BIGINT":
+			return kindInt
+		case "BOOLEAN":
+			return kindBool
+		case "TIMESTAMP", "DATETIME":
+			return kindTime
+		}
+		return kindText
+	},
+}
+
+// identifier shortens name to the maximum identifier length of the dialect.
+func (d *dialect) identifier(name string) string {
+	if d.maxIdentifierLen == 0 || len(name) <= d.maxIdentifierLen {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	n := d.maxIdentifierLen - len(suffix)
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return name[:n] + suffix
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// kindOfValue returns the column kind of a field value.
+func kindOfValue(value any) (kind, bool) {
+	switch value.(type) {
+	case float64, float32:
+		return kindFloat, true
+	case int64, int:
+		return kindInt, true
+	case uint64:
+		return kindUint, true
+	case bool:
+		return kindBool, true
+	case string:
+		return kindText, true
+	case time.Time:
+		return kindTime, true
+	}
+	return kindText, false
+}
+
+// convert returns value as the type of a column of kind k, values which
+// cannot be represented are reported as not ok and written as NULL.
+func convert(value any, k kind, d *dialect) (any, bool) {
+	switch k {
+	case kindFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case float32:
+			return float64(v), true
+		case int64:
+			return float64(v), true
+		case int:
+			return float64(v), true
+		case uint64:
+			return float64(v), true
+		}
+	case kindInt:
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case int:
+			return int64(v), true
+		case uint64:
+			if v <= math.MaxInt64 {
+				return int64(v), true
+			}
+		}
+	case kindUint:
+		switch v := value.(type) {
+		case uint64:
+			if d == sqlite && v > math.MaxInt64 {
+				// SQLite integers are signed
+				return int64(math.MaxInt64), true
+			}
+			return v, true
+		case int64:
+			if v >= 0 {
+				return uint64(v), true
+			}
+		case int:
+			if v >= 0 {
+				return uint64(v), true
+			}
+		}
+	case kindBool:
+		if v, ok := value.(bool); ok {
+			return v, true
+		}
+	case kindTime:
+		if v, ok := value.(time.Time); ok {
+			return v, true
+		}
+	case kindText:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case time.Time:
+			return v.Format(time.RFC3339Nano), true
+		default:
+			return fmt.Sprint(v), true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,423 @@
+package sql
+
+import (
+	"context"
+	gosql "database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+const (
+	defaultTimestampColumn = "timestamp"
+	defaultTimeout         = internal.Duration(30 * time.Second)
+)
+
+type SQL struct {
+	Driver                     string            `json:"driver"`
+	DataSourceName             string            `json:"data_source_name"`
+	TimestampColumn            string            `json:"timestamp_column"`
+	InitSQL                    string            `json:"init_sql"`
+	UseCopy                    bool              `json:"use_copy"`
+	Timeout                    internal.Duration `json:"timeout"`
+	TimescaleHypertable        bool              `json:"timescale_hypertable"`
+	TimescaleChunkTimeInterval internal.Duration `json:"timescale_chunk_time_interval"`
+	ConnectionMaxIdle          int               `json:"connection_max_idle"`
+	ConnectionMaxOpen          int               `json:"connection_max_open"`
+
+	log *logrus.Entry
+
+	db      *gosql.DB
+	dialect *dialect
+
+	// tables caches the columns of the tables written to
+	tables map[string]map[string]kind
+}
+
+// batch is the rows of a table in a write, rows hold the values by column.
+type batch struct {
+	table   string
+	columns map[string]kind
+	tags    map[string]bool
+	rows    []map[string]any
+}
+
+func NewSQL() *SQL {
+	return &SQL{
+		Driver:          "pgx",
+		TimestampColumn: defaultTimestampColumn,
+		Timeout:         defaultTimeout,
+		log:             models.NewLogger("outputs.sql"),
+	}
+}
+
+func (s *SQL) Init() error {
+	switch s.Driver {
+	case "pgx", "postgres":
+		s.Driver = "pgx"
+		s.dialect = postgres
+	case "sqlite":
+		s.dialect = sqlite
+		if s.UseCopy || s.TimescaleHypertable {
+			return fmt.Errorf("use_copy and timescale_hypertable require the pgx driver")
+		}
+	default:
+		return fmt.Errorf("unsupported driver %q, must be \"pgx\" or \"sqlite\"", s.Driver)
+	}
+
+	if s.DataSourceName == "" {
+		return fmt.Errorf("data_source_name is required")
+	}
+	if s.TimestampColumn == "" {
+		s.TimestampColumn = defaultTimestampColumn
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = defaultTimeout
+	}
+	return nil
+}
+
+func (s *SQL) Connect() error {
+	db, err := gosql.Open(s.Driver, s.DataSourceName)
+	if err != nil {
+		return err
+	}
+	if s.ConnectionMaxIdle > 0 {
+		db.SetMaxIdleConns(s.ConnectionMaxIdle)
+	}
+	if s.ConnectionMaxOpen > 0 {
+		db.SetMaxOpenConns(s.ConnectionMaxOpen)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.Timeout))
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return err
+	}
+	if s.InitSQL != "" {
+		if _, err := db.ExecContext(ctx, s.InitSQL); err != nil {
+			db.Close()
+			return fmt.Errorf("init_sql failed: %v", err)
+		}
+	}
+
+	s.db = db
+	s.tables = make(map[string]map[string]kind)
+	return nil
+}
+
+func (s *SQL) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+// Write inserts the series as rows of the table named after their series,
+// the tables and their columns are created as needed. All rows are written
+// in a single transaction.
+func (s *SQL) Write(metrics []models.Metric) error {
+	batches := s.batches(metrics)
+	if len(batches) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.Timeout))
+	defer cancel()
+
+	for _, b := range batches {
+		if err := s.ensureTable(ctx, b); err != nil {
+			// Read the schema again, another writer may have changed it
+			delete(s.tables, b.table)
+			return fmt.Errorf("updating table %q failed: %v", b.table, err)
+		}
+	}
+
+	if s.UseCopy {
+		return s.copy(ctx, batches)
+	}
+	return s.insert(ctx, batches)
+}
+
+// batches groups the series by table. Tags and fields are columns, fields
+// are flattened with "/" and tags take precedence over fields of the same
+// name.
+func (s *SQL) batches(metrics []models.Metric) []*batch {
+	var order []string
+	byTable := make(map[string]*batch)
+	for _, metric := range metrics {
+		sm, ok := metric.(models.SeriesMetric)
+		if !ok {
+			s.log.Debugf("Could not convert metric of type %T", metric)
+			continue
+		}
+		for _, series := range sm.Series() {
+			table := s.dialect.identifier(series.Name)
+			b, ok := byTable[table]
+			if !ok {
+				b = &batch{
+					table:   table,
+					columns: map[string]kind{s.TimestampColumn: kindTime},
+					tags:    make(map[string]bool),
+				}
+				byTable[table] = b
+				order = append(order, table)
+			}
+
+			t := series.Time
+			if t.IsZero() {
+				t = time.Now()
+			}
+			row := map[string]any{s.TimestampColumn: t.UTC()}
+			for k, v := range series.Tags {
+				column := s.dialect.identifier(k)
+				if column == s.TimestampColumn {
+					continue
+				}
+				b.columns[column] = kindText
+				b.tags[column] = true
+				row[column] = v
+			}
+			internal.Flatten("", series.Fields, "/", func(k string, v any) {
+				column := s.dialect.identifier(k)
+				if _, ok := row[column]; ok {
+					s.log.Debugf("Field %q of %q conflicts with a tag or the timestamp, dropping it", k, series.Name)
+					return
+				}
+				valueKind, ok := kindOfValue(v)
+				if !ok {
+					return
+				}
+				if _, ok := b.columns[column]; !ok {
+					b.columns[column] = valueKind
+				}
+				row[column] = v
+			})
+			b.rows = append(b.rows, row)
+		}
+	}
+
+	batches := make([]*batch, 0, len(order))
+	for _, table := range order {
+		batches = append(batches, byTable[table])
+	}
+	return batches
+}
+
+// ensureTable creates the table of a batch, or adds the missing columns to
+// it. The kinds of the batch columns are updated to the existing ones.
+func (s *SQL) ensureTable(ctx context.Context, b *batch) error {
+	columns, ok := s.tables[b.table]
+	if !ok {
+		var err error
+		columns, err = s.columns(ctx, b.table)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			if err := s.createTable(ctx, b); err != nil {
+				return err
+			}
+			columns = make(map[string]kind, len(b.columns))
+			for name, k := range b.columns {
+				columns[name] = k
+			}
+		}
+		s.tables[b.table] = columns
+	}
+
+	for _, name := range sortedColumns(b.columns) {
+		if k, ok := columns[name]; ok {
+			b.columns[name] = k
+			continue
+		}
+		query := fmt.Sprintf(s.dialect.addColumn, quoteIdent(b.table), quoteIdent(name), s.dialect.types[b.columns[name]])
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+		s.log.Debugf("Added column %q to table %q", name, b.table)
+		columns[name] = b.columns[name]
+	}
+	return nil
+}
+
+func (s *SQL) columns(ctx context.Context, table string) (map[string]kind, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.columnsQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]kind)
+	for rows.Next() {
+		var name, dataType string
+		if err := rows.Scan(&name, &dataType); err != nil {
+			return nil, err
+		}
+		columns[name] = s.dialect.kindOf(dataType)
+	}
+	return columns, rows.Err()
+}
+
+func (s *SQL) createTable(ctx context.Context, b *batch) error {
+	var defs []string
+	for _, name := range sortedColumns(b.columns) {
+		defs = append(defs, quoteIdent(name)+" "+s.dialect.types[b.columns[name]])
+	}
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", quoteIdent(b.table), strings.Join(defs, ", "))
+	if _, err := s.db.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	s.log.Infof("Created table %q", b.table)
+
+	if !s.TimescaleHypertable {
+		return nil
+	}
+	query = "SELECT create_hypertable($1::regclass, $2::name, if_not_exists => TRUE)"
+	args := []any{quoteIdent(b.table), s.TimestampColumn}
+	if s.TimescaleChunkTimeInterval > 0 {
+		query = "SELECT create_hypertable($1::regclass, $2::name, if_not_exists => TRUE, chunk_time_interval => $3::interval)"
+		args = append(args, fmt.Sprintf("%d microseconds", time.Duration(s.TimescaleChunkTimeInterval).Microseconds()))
+	}
+	if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("creating hypertable failed: %v", err)
+	}
+	return nil
+}
+
+// values returns the values of a row in the order of columns, converted to
+// the column types.
+func (s *SQL) values(b *batch, columns []string, row map[string]any) []any {
+	values := make([]any, len(columns))
+	for i, name := range columns {
+		v, ok := row[name]
+		if !ok {
+			continue
+		}
+		converted, ok := convert(v, b.columns[name], s.dialect)
+		if !ok {
+			s.log.Warnf("Value %v of column %q in table %q does not match the column type, writing NULL", v, name, b.table)
+			continue
+		}
+		values[i] = converted
+	}
+	return values
+}
+
+func (s *SQL) insert(ctx context.Context, batches []*batch) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	for _, b := range batches {
+		columns := sortedColumns(b.columns)
+		quoted := make([]string, len(columns))
+		for i, name := range columns {
+			quoted[i] = quoteIdent(name)
+		}
+		prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdent(b.table), strings.Join(quoted, ", "))
+
+		// Tables with more columns than parameters are written row by row,
+		// the database reports the error
+		rowsPerStatement := s.dialect.maxParams / len(columns)
+		if rowsPerStatement < 1 {
+			rowsPerStatement = 1
+		}
+		for start := 0; start < len(b.rows); start += rowsPerStatement {
+			end := start + rowsPerStatement
+			if end > len(b.rows) {
+				end = len(b.rows)
+			}
+
+			var query strings.Builder
+			query.WriteString(prefix)
+			args := make([]any, 0, (end-start)*len(columns))
+			for i, row := range b.rows[start:end] {
+				if i > 0 {
+					query.WriteString(", ")
+				}
+				query.WriteByte('(')
+				for j := range columns {
+					if j > 0 {
+						query.WriteString(", ")
+					}
+					query.WriteString(s.dialect.placeholder(len(args) + j + 1))
+				}
+				query.WriteByte(')')
+				args = append(args, s.values(b, columns, row)...)
+			}
+
+			if _, err := tx.ExecContext(ctx, query.String(), args...); err != nil {
+				return fmt.Errorf("inserting into %q failed: %v", b.table, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// copy writes the rows with the COPY protocol of PostgreSQL.
+func (s *SQL) copy(ctx context.Context, batches []*batch) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		tx, err := pgConn.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx) //nolint:errcheck // no-op after commit
+
+		for _, b := range batches {
+			columns := sortedColumns(b.columns)
+			rows := make([][]any, 0, len(b.rows))
+			for _, row := range b.rows {
+				rows = append(rows, s.values(b, columns, row))
+			}
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{b.table}, columns, pgx.CopyFromRows(rows)); err != nil {
+				return fmt.Errorf("copying into %q failed: %v", b.table, err)
+			}
+		}
+		return tx.Commit(ctx)
+	})
+}
+
+func sortedColumns(columns map[string]kind) []string {
+	names := make([]string, 0, len(columns))
+	for name := range columns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *SQL) ParseConfig(cfg map[string]any) error {
+	tmp, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(tmp, s)
+	if err != nil {
+		return fmt.Errorf("[sql] config error: %v", err)
+	}
+	return nil
+}
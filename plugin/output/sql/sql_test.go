@@ -0,0 +1,148 @@
+package sql
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+)
+
+func newTestOutput(t *testing.T) *SQL {
+	s := NewSQL()
+	s.Driver = "sqlite"
+	s.DataSourceName = "file:" + filepath.Join(t.TempDir(), "metrics.db")
+	require.NoError(t, s.Init())
+	require.NoError(t, s.Connect())
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestWriteCreatesTable(t *testing.T) {
+	s := newTestOutput(t)
+
+	ts := time.Date(2023, 3, 7, 10, 0, 0, 0, time.UTC)
+	metric := models.NewSeriesMetric([]models.Series{
+		{
+			Name:   "interfaces",
+			Tags:   map[string]string{"source": "10.0.0.1", "name": "Gi0/0/0/0"},
+			Fields: map[string]any{"bytes_received": int64(10), "state": map[string]any{"up": true}},
+			Time:   ts,
+		},
+		{
+			Name:   "interfaces",
+			Tags:   map[string]string{"source": "10.0.0.1", "name": "Gi0/0/0/1"},
+			Fields: map[string]any{"bytes_received": int64(20), "rate": 1.5},
+			Time:   ts,
+		},
+	}...)
+	require.NoError(t, s.Write([]models.Metric{metric}))
+
+	columns, err := s.columns(context.Background(), "interfaces")
+	require.NoError(t, err)
+	require.Equal(t, map[string]kind{
+		"timestamp":      kindTime,
+		"source":         kindText,
+		"name":           kindText,
+		"bytes_received": kindInt,
+		"state/up":       kindBool,
+		"rate":           kindFloat,
+	}, columns)
+
+	rows, err := s.db.Query(`SELECT "name", "bytes_received", "state/up", "rate" FROM "interfaces" ORDER BY "name"`)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	type row struct {
+		name  string
+		bytes int64
+		up    *bool
+		rate  *float64
+	}
+	var actual []row
+	for rows.Next() {
+		var r row
+		require.NoError(t, rows.Scan(&r.name, &r.bytes, &r.up, &r.rate))
+		actual = append(actual, r)
+	}
+	require.NoError(t, rows.Err())
+
+	up, rate := true, 1.5
+	require.Equal(t, []row{
+		{name: "Gi0/0/0/0", bytes: 10, up: &up},
+		{name: "Gi0/0/0/1", bytes: 20, rate: &rate},
+	}, actual)
+}
+
+func TestWriteAddsColumns(t *testing.T) {
+	s := newTestOutput(t)
+
+	ts := time.Date(2023, 3, 7, 10, 0, 0, 0, time.UTC)
+	first := models.NewSeriesMetric([]models.Series{{
+		Name:   "cpu",
+		Tags:   map[string]string{"source": "10.0.0.1"},
+		Fields: map[string]any{"usage": 10.0},
+		Time:   ts,
+	}}...)
+	require.NoError(t, s.Write([]models.Metric{first}))
+
+	second := models.NewSeriesMetric([]models.Series{{
+		Name:   "cpu",
+		Tags:   map[string]string{"source": "10.0.0.1", "core": "0"},
+		Fields: map[string]any{"usage": int64(20), "idle": 80.0},
+		Time:   ts.Add(time.Second),
+	}}...)
+	require.NoError(t, s.Write([]models.Metric{second}))
+
+	columns, err := s.columns(context.Background(), "cpu")
+	require.NoError(t, err)
+	require.Equal(t, map[string]kind{
+		"timestamp": kindTime,
+		"source":    kindText,
+		"core":      kindText,
+		"usage":     kindFloat,
+		"idle":      kindFloat,
+	}, columns)
+
+	var count int
+	var usage float64
+	require.NoError(t, s.db.QueryRow(`SELECT COUNT(*), SUM("usage") FROM "cpu"`).Scan(&count, &usage))
+	require.Equal(t, 2, count)
+	require.Equal(t, 30.0, usage)
+}
+
+func TestIdentifier(t *testing.T) {
+	name := "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters"
+	id := postgres.identifier(name)
+	require.Len(t, id, 63)
+	require.NotEqual(t, id, postgres.identifier(name+"/x"))
+	require.Equal(t, name, sqlite.identifier(name))
+}
+
+func TestWriteMoreColumnsThanParams(t *testing.T) {
+	s := newTestOutput(t)
+	// Copy the dialect to not change the other tests
+	limited := *s.dialect
+	limited.maxParams = 2
+	s.dialect = &limited
+
+	ts := time.Date(2023, 3, 7, 10, 0, 0, 0, time.UTC)
+	var series []models.Series
+	for i := int64(0); i < 3; i++ {
+		series = append(series, models.Series{
+			Name:   "interfaces",
+			Tags:   map[string]string{"source": "10.0.0.1"},
+			Fields: map[string]any{"bytes_received": i},
+			Time:   ts.Add(time.Duration(i) * time.Second),
+		})
+	}
+	// The rows are inserted one per statement
+	require.NoError(t, s.Write([]models.Metric{models.NewSeriesMetric(series...)}))
+
+	var count int
+	require.NoError(t, s.db.QueryRow(`SELECT COUNT(*) FROM "interfaces"`).Scan(&count))
+	require.Equal(t, 3, count)
+}
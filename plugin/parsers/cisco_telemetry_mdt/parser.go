@@ -0,0 +1,33 @@
+package cisco_telemetry_mdt
+
+import (
+	"telemetry/models"
+	mdt "telemetry/plugin/input/cisco_telemetry_mdt"
+)
+
+// Parser decodes raw Cisco MDT telemetry messages, GPB or JSON encoded,
+// such as the ones published to Kafka by pipeline collectors.
+type Parser struct {
+	decoder *mdt.Decoder
+}
+
+// NewParser returns a parser decoding compact GPB rows with the models of
+// protoDir, see mdt.NewDecoder.
+func NewParser(protoDir string) (*Parser, error) {
+	decoder, err := mdt.NewDecoder(protoDir)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{decoder: decoder}, nil
+}
+
+// Parse returns the metric of a message, the source is not known and only
+// the node_id tag identifies the device. Like the input, the metric of the
+// rows which could be parsed is returned along with the error of the others.
+func (p *Parser) Parse(buf []byte) ([]models.Metric, error) {
+	m, err := p.decoder.Decode(buf, "")
+	if m == nil {
+		return nil, err
+	}
+	return []models.Metric{m}, err
+}
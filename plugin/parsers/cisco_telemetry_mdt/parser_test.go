@@ -0,0 +1,39 @@
+package cisco_telemetry_mdt
+
+import (
+	"testing"
+
+	"github.com/cisco-ie/nx-telemetry-proto/telemetry_bis"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"telemetry/models"
+)
+
+func TestParsePartialMessage(t *testing.T) {
+	// Compact GPB rows cannot be decoded without proto_dir, the metric of
+	// the header is returned along with the error like in the input
+	data, err := proto.Marshal(&telemetry_bis.Telemetry{
+		NodeId:       &telemetry_bis.Telemetry_NodeIdStr{NodeIdStr: "router-1"},
+		EncodingPath: "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+		DataGpb: &telemetry_bis.TelemetryGPBTable{
+			Row: []*telemetry_bis.TelemetryRowGPB{{Timestamp: 1678183200005}},
+		},
+	})
+	require.NoError(t, err)
+
+	p, err := NewParser("")
+	require.NoError(t, err)
+	metrics, err := p.Parse(data)
+	require.Error(t, err)
+	require.Len(t, metrics, 1)
+	require.Implements(t, (*models.SeriesMetric)(nil), metrics[0])
+}
+
+func TestParseInvalidMessage(t *testing.T) {
+	p, err := NewParser("")
+	require.NoError(t, err)
+	metrics, err := p.Parse([]byte{0xff, 0xff})
+	require.Error(t, err)
+	require.Empty(t, metrics)
+}
@@ -0,0 +1,74 @@
+package influx
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+
+	"telemetry/models"
+)
+
+// Parser reads the InfluxDB line protocol, each line is a series.
+type Parser struct{}
+
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+func (p *Parser) Parse(buf []byte) ([]models.Metric, error) {
+	var metrics []models.Metric
+	dec := lineprotocol.NewDecoderWithBytes(buf)
+	for dec.Next() {
+		s, err := p.series(dec)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, models.NewSeriesMetric(s))
+	}
+	return metrics, nil
+}
+
+func (p *Parser) series(dec *lineprotocol.Decoder) (models.Series, error) {
+	name, err := dec.Measurement()
+	if err != nil {
+		return models.Series{}, err
+	}
+	s := models.Series{
+		Name:   string(name),
+		Tags:   make(map[string]string),
+		Fields: make(map[string]any),
+	}
+
+	for {
+		key, value, err := dec.NextTag()
+		if err != nil {
+			return models.Series{}, err
+		}
+		if key == nil {
+			break
+		}
+		s.Tags[string(key)] = string(value)
+	}
+
+	for {
+		key, value, err := dec.NextField()
+		if err != nil {
+			return models.Series{}, err
+		}
+		if key == nil {
+			break
+		}
+		s.Fields[string(key)] = value.Interface()
+	}
+	if len(s.Fields) == 0 {
+		return models.Series{}, fmt.Errorf("%s: no fields", s.Name)
+	}
+
+	t, err := dec.Time(lineprotocol.Nanosecond, time.Now())
+	if err != nil {
+		return models.Series{}, err
+	}
+	s.Time = t
+	return s, nil
+}
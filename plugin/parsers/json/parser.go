@@ -0,0 +1,154 @@
+package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+const (
+	defaultNameKey = "name"
+	defaultName    = "json"
+	defaultTimeKey = "timestamp"
+)
+
+// Parser reads JSON objects, or arrays of objects, as series. It reads the
+// flat objects written by the json serializer.
+type Parser struct {
+	NameKey    string
+	Name       string
+	TimeKey    string
+	TimeFormat string
+	TagKeys    map[string]bool
+}
+
+func NewParser(nameKey, name, timeKey, timeFormat string, tagKeys []string) (*Parser, error) {
+	if nameKey == "" {
+		nameKey = defaultNameKey
+	}
+	if name == "" {
+		name = defaultName
+	}
+	if timeKey == "" {
+		timeKey = defaultTimeKey
+	}
+
+	p := &Parser{
+		NameKey:    nameKey,
+		Name:       name,
+		TimeKey:    timeKey,
+		TimeFormat: timeFormat,
+		TagKeys:    make(map[string]bool, len(tagKeys)),
+	}
+	for _, key := range tagKeys {
+		p.TagKeys[key] = true
+	}
+	return p, nil
+}
+
+func (p *Parser) Parse(buf []byte) ([]models.Metric, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	var metrics []models.Metric
+	for dec.More() {
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+
+		var objects []any
+		switch v := doc.(type) {
+		case map[string]any:
+			objects = []any{v}
+		case []any:
+			objects = v
+		default:
+			return nil, fmt.Errorf("expected an object or an array of objects, got %T", doc)
+		}
+
+		for _, item := range objects {
+			obj, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("expected an object, got %T", item)
+			}
+			series, err := p.series(obj)
+			if err != nil {
+				return nil, err
+			}
+			metrics = append(metrics, models.NewSeriesMetric(series))
+		}
+	}
+	return metrics, nil
+}
+
+func (p *Parser) series(obj map[string]any) (models.Series, error) {
+	s := models.Series{
+		Name:   p.Name,
+		Tags:   make(map[string]string),
+		Fields: make(map[string]any),
+		Time:   time.Now(),
+	}
+
+	for k, v := range obj {
+		switch {
+		case k == p.NameKey:
+			if name, ok := v.(string); ok {
+				s.Name = name
+				continue
+			}
+		case k == p.TimeKey:
+			t, err := p.parseTime(v)
+			if err != nil {
+				return models.Series{}, fmt.Errorf("parsing %q failed: %v", k, err)
+			}
+			s.Time = t
+			continue
+		case p.TagKeys[k]:
+			if v != nil {
+				s.Tags[k] = fmt.Sprint(v)
+			}
+			continue
+		}
+		s.Fields[k] = internal.ConvertJSONNumbers(v)
+	}
+	return s, nil
+}
+
+// parseTime reads the time with the time format, without a format numbers
+// are milliseconds like the json serializer writes and strings are RFC3339.
+func (p *Parser) parseTime(value any) (time.Time, error) {
+	switch v := value.(type) {
+	case json.Number:
+		units := map[string]time.Duration{
+			"":        time.Millisecond,
+			"unix":    time.Second,
+			"unix_ms": time.Millisecond,
+			"unix_us": time.Microsecond,
+			"unix_ns": time.Nanosecond,
+		}
+		unit, ok := units[p.TimeFormat]
+		if !ok {
+			return time.Time{}, fmt.Errorf("number %s does not match time format %q", v, p.TimeFormat)
+		}
+		if i, err := v.Int64(); err == nil {
+			return time.Unix(0, i*int64(unit)), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(0, int64(f*float64(unit))), nil
+	case string:
+		layout := p.TimeFormat
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		return time.Parse(layout, v)
+	}
+	return time.Time{}, fmt.Errorf("unsupported time value %v", value)
+}
@@ -0,0 +1,53 @@
+package json
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+)
+
+func TestParse(t *testing.T) {
+	p, err := NewParser("", "", "", "", []string{"source", "interface_name"})
+	require.NoError(t, err)
+
+	metrics, err := p.Parse([]byte(`[
+		{"name": "interfaces", "timestamp": 1678183200000, "source": "10.0.0.1", "interface_name": "Gi0/0/0/0",
+		 "bytes_received": 18446744073709551615, "state": {"up": true, "mtu": 1514}, "rate": 1.5},
+		{"timestamp": 1678183200000, "source": "10.0.0.2", "drops": -1}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+
+	ts := time.UnixMilli(1678183200000)
+	require.Equal(t, []models.Series{{
+		Name: "interfaces",
+		Tags: map[string]string{"source": "10.0.0.1", "interface_name": "Gi0/0/0/0"},
+		Fields: map[string]any{
+			"bytes_received": uint64(18446744073709551615),
+			"state":          map[string]any{"up": true, "mtu": int64(1514)},
+			"rate":           1.5,
+		},
+		Time: ts,
+	}}, metrics[0].(models.SeriesMetric).Series())
+	require.Equal(t, []models.Series{{
+		Name:   "json",
+		Tags:   map[string]string{"source": "10.0.0.2"},
+		Fields: map[string]any{"drops": int64(-1)},
+		Time:   ts,
+	}}, metrics[1].(models.SeriesMetric).Series())
+}
+
+func TestParseTimeFormat(t *testing.T) {
+	p, err := NewParser("", "", "time", "2006-01-02T15:04:05", nil)
+	require.NoError(t, err)
+
+	metrics, err := p.Parse([]byte(`{"time": "2023-03-07T10:00:00", "value": 1}`))
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2023, 3, 7, 10, 0, 0, 0, time.UTC), metrics[0].(models.SeriesMetric).Series()[0].Time)
+
+	_, err = p.Parse([]byte(`{"time": 1678183200, "value": 1}`))
+	require.Error(t, err)
+}
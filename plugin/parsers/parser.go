@@ -0,0 +1,60 @@
+package parsers
+
+import (
+	"fmt"
+
+	"telemetry/models"
+	"telemetry/plugin/parsers/cisco_telemetry_mdt"
+	"telemetry/plugin/parsers/influx"
+	"telemetry/plugin/parsers/json"
+)
+
+type ParserInput interface {
+	// SetParser sets the parser function for the interface.
+	SetParser(parser Parser)
+}
+
+type Parser interface {
+	// Parse takes a message, such as a Kafka record, and turns it into
+	// metrics. When only part of the message is parsed, the metrics of
+	// that part are returned along with the error.
+	Parse(buf []byte) ([]models.Metric, error)
+}
+
+// Config is the parser part of an input configuration, it selects the
+// parser with DataFormat and holds the options of every format.
+type Config struct {
+	// DataFormat can be one of the parser types listed in NewParser.
+	DataFormat string `json:"data_format"`
+
+	// Key of the series name, the name is JSONName when it is missing
+	JSONNameKey string `json:"json_name_key"`
+	JSONName    string `json:"json_name"`
+
+	// Key and format of the series time, the format is one of "unix",
+	// "unix_ms", "unix_us", "unix_ns" or a Go time layout
+	JSONTimeKey    string `json:"json_time_key"`
+	JSONTimeFormat string `json:"json_time_format"`
+
+	// Keys used as tags, all other keys are fields
+	JSONTagKeys []string `json:"json_tag_keys"`
+
+	// Directory of the models decoding Cisco MDT compact GPB rows
+	CiscoMDTProtoDir string `json:"cisco_telemetry_mdt_proto_dir"`
+}
+
+// NewParser returns the parser selected by the DataFormat of config, json
+// is used when no data format is set.
+func NewParser(config *Config) (Parser, error) {
+	switch config.DataFormat {
+	case "json", "":
+		return json.NewParser(config.JSONNameKey, config.JSONName, config.JSONTimeKey, config.JSONTimeFormat,
+			config.JSONTagKeys)
+	case "influx":
+		return influx.NewParser(), nil
+	case "cisco_telemetry_mdt":
+		return cisco_telemetry_mdt.NewParser(config.CiscoMDTProtoDir)
+	default:
+		return nil, fmt.Errorf("invalid data format: %s", config.DataFormat)
+	}
+}
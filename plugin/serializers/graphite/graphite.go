@@ -0,0 +1,239 @@
+package graphite
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+const DefaultTemplate = "source.tags.measurement.field"
+
+var (
+	// allowedChars are the characters kept as is in a path node, everything
+	// else is replaced by an underscore.
+	allowedChars = regexp.MustCompile(`[^a-zA-Z0-9\-_:]`)
+
+	// tagReplacer escapes the characters not allowed in Graphite 1.1 tags.
+	tagReplacer = strings.NewReplacer(";", "_", "!", "_", "^", "_", "=", "_", "~", "_", " ", "_")
+)
+
+type Serializer struct {
+	Prefix     string
+	Template   string
+	TagSupport bool
+
+	templates []*template
+}
+
+// template is a template restricted to the measurements matching filter.
+type template struct {
+	filter *regexp.Regexp
+	parts  []string
+}
+
+// NewSerializer returns a graphite serializer. Templates are given as
+// "filter template" where filter is a glob matched against the measurement
+// name, the first matching template wins and Template is used otherwise.
+func NewSerializer(prefix, tmpl string, templates []string, tagSupport bool) (*Serializer, error) {
+	if tmpl == "" {
+		tmpl = DefaultTemplate
+	}
+
+	s := &Serializer{
+		Prefix:     prefix,
+		Template:   tmpl,
+		TagSupport: tagSupport,
+	}
+
+	for _, t := range templates {
+		parts := strings.Fields(t)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid graphite template %q, expected \"filter template\"", t)
+		}
+		filter, err := internal.CompileGlob(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid graphite template filter %q: %v", parts[0], err)
+		}
+		s.templates = append(s.templates, &template{filter: filter, parts: strings.Split(parts[1], ".")})
+	}
+	s.templates = append(s.templates, &template{parts: strings.Split(tmpl, ".")})
+
+	return s, nil
+}
+
+func (s *Serializer) Serialize(metric models.Metric) ([]byte, error) {
+	sm, ok := metric.(models.SeriesMetric)
+	if !ok {
+		return nil, fmt.Errorf("graphite: unsupported metric type %T", metric)
+	}
+
+	var buf bytes.Buffer
+	for _, series := range sm.Series() {
+		timestamp := series.Time.Unix()
+		tmpl := s.template(series.Name)
+
+		fields := make(map[string]any)
+		internal.Flatten("", series.Fields, ".", func(k string, v any) {
+			fields[k] = v
+		})
+
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, field := range keys {
+			value, ok := formatValue(fields[field])
+			if !ok {
+				continue
+			}
+
+			var path string
+			if s.TagSupport {
+				path = s.taggedPath(series, field)
+			} else {
+				path = s.templatedPath(tmpl, series, field)
+			}
+			if path == "" {
+				continue
+			}
+			fmt.Fprintf(&buf, "%s %s %d\n", path, value, timestamp)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *Serializer) template(name string) *template {
+	for _, t := range s.templates {
+		if t.filter == nil || t.filter.MatchString(name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// templatedPath builds the metric path from the template. "measurement",
+// "field" and "tags" are replaced by the series name, the field and all tags
+// not used elsewhere in the template, any other part is looked up as a tag.
+func (s *Serializer) templatedPath(tmpl *template, series models.Series, field string) string {
+	used := make(map[string]bool)
+	for _, part := range tmpl.parts {
+		used[part] = true
+	}
+
+	var nodes []string
+	if s.Prefix != "" {
+		nodes = append(nodes, s.Prefix)
+	}
+
+	for _, part := range tmpl.parts {
+		switch part {
+		case "measurement":
+			nodes = append(nodes, sanitizePath(series.Name))
+		case "field":
+			if field != "value" {
+				nodes = append(nodes, sanitizePath(field))
+			}
+		case "tags":
+			keys := make([]string, 0, len(series.Tags))
+			for k := range series.Tags {
+				if !used[k] {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				if v := sanitizeNode(series.Tags[k]); v != "" {
+					nodes = append(nodes, v)
+				}
+			}
+		default:
+			if v := sanitizeNode(series.Tags[part]); v != "" {
+				nodes = append(nodes, v)
+			}
+		}
+	}
+
+	return strings.Join(nodes, ".")
+}
+
+// taggedPath builds a Graphite 1.1 tagged path, "name;tag=value;...".
+func (s *Serializer) taggedPath(series models.Series, field string) string {
+	var nodes []string
+	if s.Prefix != "" {
+		nodes = append(nodes, s.Prefix)
+	}
+	nodes = append(nodes, sanitizePath(series.Name))
+	if field != "value" {
+		nodes = append(nodes, sanitizePath(field))
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Join(nodes, "."))
+
+	keys := make([]string, 0, len(series.Tags))
+	for k := range series.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := tagReplacer.Replace(series.Tags[k])
+		if v == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ";%s=%s", tagReplacer.Replace(k), v)
+	}
+
+	return b.String()
+}
+
+// sanitizePath sanitizes names that are paths by themselves, such as
+// encoding paths and flattened fields, keeping their hierarchy as nodes.
+func sanitizePath(name string) string {
+	parts := strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '.' })
+	nodes := parts[:0]
+	for _, p := range parts {
+		if p = sanitizeNode(p); p != "" {
+			nodes = append(nodes, p)
+		}
+	}
+	return strings.Join(nodes, ".")
+}
+
+// sanitizeNode returns a value usable as a single path node.
+func sanitizeNode(value string) string {
+	return allowedChars.ReplaceAllString(value, "_")
+}
+
+func formatValue(value any) (string, bool) {
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return formatValue(float64(v))
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case int:
+		return strconv.Itoa(v), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	}
+	return "", false
+}
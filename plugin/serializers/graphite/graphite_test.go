@@ -0,0 +1,74 @@
+package graphite
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+)
+
+func newTestMetric() models.Metric {
+	return models.NewSeriesMetric(models.Series{
+		Name: "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+		Tags: map[string]string{"source": "10.0.0.1", "interface-name": "Hu0/0/0/1"},
+		Fields: map[string]any{
+			"bytes-received": uint64(10),
+			"errors":         map[string]any{"crc": int64(1)},
+			"up":             true,
+			"description":    "uplink",
+			"ratio":          math.NaN(),
+		},
+		Time: time.Unix(1678183200, 5),
+	})
+}
+
+func TestSerialize(t *testing.T) {
+	path := "Cisco-IOS-XR-infra-statsd-oper:infra-statistics.interfaces.interface.latest.generic-counters"
+	tests := []struct {
+		name       string
+		prefix     string
+		template   string
+		templates  []string
+		tagSupport bool
+		expected   string
+	}{
+		{
+			name: "default template",
+			expected: "10_0_0_1.Hu0_0_0_1." + path + ".bytes-received 10 1678183200\n" +
+				"10_0_0_1.Hu0_0_0_1." + path + ".errors.crc 1 1678183200\n" +
+				"10_0_0_1.Hu0_0_0_1." + path + ".up 1 1678183200\n",
+		},
+		{
+			name:      "filtered template",
+			prefix:    "telemetry",
+			templates: []string{"Cisco-IOS-XR-infra-* source.measurement.interface-name.field", "* measurement.field"},
+			expected: "telemetry.10_0_0_1." + path + ".Hu0_0_0_1.bytes-received 10 1678183200\n" +
+				"telemetry.10_0_0_1." + path + ".Hu0_0_0_1.errors.crc 1 1678183200\n" +
+				"telemetry.10_0_0_1." + path + ".Hu0_0_0_1.up 1 1678183200\n",
+		},
+		{
+			name:       "tag support",
+			tagSupport: true,
+			expected: path + ".bytes-received;interface-name=Hu0/0/0/1;source=10.0.0.1 10 1678183200\n" +
+				path + ".errors.crc;interface-name=Hu0/0/0/1;source=10.0.0.1 1 1678183200\n" +
+				path + ".up;interface-name=Hu0/0/0/1;source=10.0.0.1 1 1678183200\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSerializer(tt.prefix, tt.template, tt.templates, tt.tagSupport)
+			require.NoError(t, err)
+			out, err := s.Serialize(newTestMetric())
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(out))
+		})
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	_, err := NewSerializer("", "", []string{"measurement.field"}, false)
+	require.Error(t, err)
+}
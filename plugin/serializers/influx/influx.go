@@ -0,0 +1,135 @@
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// Serializer writes series in the InfluxDB line protocol, nested fields are
+// joined with "/" like the YANG paths they come from.
+type Serializer struct {
+	UintSupport bool
+}
+
+func NewSerializer(uintSupport bool) *Serializer {
+	return &Serializer{
+		UintSupport: uintSupport,
+	}
+}
+
+func (s *Serializer) Serialize(metric models.Metric) ([]byte, error) {
+	sm, ok := metric.(models.SeriesMetric)
+	if !ok {
+		return nil, fmt.Errorf("influx: unsupported metric type %T", metric)
+	}
+
+	var buf bytes.Buffer
+	for _, series := range sm.Series() {
+		s.writeSeries(&buf, series)
+	}
+	return buf.Bytes(), nil
+}
+
+// SerializeBatch writes the lines of all metrics.
+func (s *Serializer) SerializeBatch(metrics []models.Metric) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, metric := range metrics {
+		b, err := s.Serialize(metric)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Serializer) writeSeries(buf *bytes.Buffer, series models.Series) {
+	fields := make(map[string]string)
+	internal.Flatten("", series.Fields, "/", func(k string, v any) {
+		if value, ok := s.formatValue(v); ok {
+			fields[k] = value
+		}
+	})
+	// A line without fields is invalid
+	if len(fields) == 0 {
+		return
+	}
+
+	buf.WriteString(measurementEscaper.Replace(series.Name))
+
+	tagKeys := make([]string, 0, len(series.Tags))
+	for k, v := range series.Tags {
+		if k != "" && v != "" {
+			tagKeys = append(tagKeys, k)
+		}
+	}
+	sort.Strings(tagKeys)
+	for _, k := range tagKeys {
+		buf.WriteByte(',')
+		buf.WriteString(keyEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(keyEscaper.Replace(series.Tags[k]))
+	}
+
+	fieldKeys := make([]string, 0, len(fields))
+	for k := range fields {
+		fieldKeys = append(fieldKeys, k)
+	}
+	sort.Strings(fieldKeys)
+	for i, k := range fieldKeys {
+		if i == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(keyEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(fields[k])
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(series.Time.UnixNano(), 10))
+	buf.WriteByte('\n')
+}
+
+func (s *Serializer) formatValue(value any) (string, bool) {
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", false
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return s.formatValue(float64(v))
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", true
+	case int:
+		return strconv.Itoa(v) + "i", true
+	case uint64:
+		if s.UintSupport {
+			return strconv.FormatUint(v, 10) + "u", true
+		}
+		if v > math.MaxInt64 {
+			v = math.MaxInt64
+		}
+		return strconv.FormatUint(v, 10) + "i", true
+	case bool:
+		return strconv.FormatBool(v), true
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`, true
+	}
+	return "", false
+}
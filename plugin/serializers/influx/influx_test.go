@@ -0,0 +1,76 @@
+package influx
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+)
+
+func TestSerializeEscaping(t *testing.T) {
+	s := NewSerializer(false)
+	out, err := s.Serialize(models.NewSeriesMetric(models.Series{
+		Name: "if stats,v1",
+		Tags: map[string]string{"interface name": "Hu0/0/0/1,a=b", "empty": "", "line": "a\nb"},
+		Fields: map[string]any{
+			"description": `uplink "to" \\core`,
+			"in bytes":    int64(10),
+			"a=b,c":       1.5,
+		},
+		Time: time.Unix(0, 42),
+	}))
+	require.NoError(t, err)
+	require.Equal(t,
+		`if\ stats\,v1,interface\ name=Hu0/0/0/1\,a\=b,line=a\nb a\=b\,c=1.5,description="uplink \"to\" \\\\core",in\ bytes=10i 42`+"\n",
+		string(out))
+}
+
+func TestSerializeFields(t *testing.T) {
+	series := models.Series{
+		Name: "counters",
+		Fields: map[string]any{
+			"errors": map[string]any{"crc": int64(-1)},
+			"large":  uint64(math.MaxUint64),
+			"small":  uint64(7),
+			"nan":    math.NaN(),
+			"inf":    math.Inf(1),
+			"up":     true,
+			"list":   []any{"a"},
+		},
+		Time: time.Unix(0, 42),
+	}
+	tests := []struct {
+		name        string
+		uintSupport bool
+		expected    string
+	}{
+		{
+			name:     "uint64 clamped to int64",
+			expected: `counters errors/crc=-1i,large=9223372036854775807i,list/0="a",small=7i,up=true 42` + "\n",
+		},
+		{
+			name:        "uint support",
+			uintSupport: true,
+			expected:    `counters errors/crc=-1i,large=18446744073709551615u,list/0="a",small=7u,up=true 42` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := NewSerializer(tt.uintSupport).Serialize(models.NewSeriesMetric(series))
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(out))
+		})
+	}
+}
+
+func TestSerializeWithoutFields(t *testing.T) {
+	out, err := NewSerializer(false).SerializeBatch([]models.Metric{
+		models.NewSeriesMetric(models.Series{Name: "empty", Fields: map[string]any{"nan": math.NaN()}}),
+		models.NewSeriesMetric(models.Series{Name: "cpu", Fields: map[string]any{"value": 1.0}, Time: time.Unix(0, 1)}),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "cpu value=1 1\n", string(out))
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	jsonata "github.com/blues/jsonata-go"
@@ -11,10 +12,25 @@ import (
 	"telemetry/models"
 )
 
+// Array handling of the flatten mode
+const (
+	// ArraysIndex joins the element index like any other key, "a.0.b".
+	ArraysIndex = "index"
+	// ArraysBrackets appends the element index in brackets, "a[0].b".
+	ArraysBrackets = "brackets"
+	// ArraysKeep keeps arrays as JSON arrays, their elements are not flattened.
+	ArraysKeep = "keep"
+)
+
 type Serializer struct {
 	TimestampUnits  time.Duration
 	TimestampFormat string
 
+	// Flatten writes one flat object per series instead of the metric.
+	Flatten          bool
+	FlattenSeparator string
+	FlattenArrays    string
+
 	transformation *jsonata.Expr
 }
 
@@ -35,7 +51,37 @@ func NewSerializer(timestampUnits time.Duration, timestampFormat, transform stri
 	return s, nil
 }
 
+// NewFlattenSerializer returns a serializer writing one flat object per
+// series, nested fields are joined with separator and arrays are handled as
+// set by arrays.
+func NewFlattenSerializer(timestampUnits time.Duration, timestampFormat, transform, separator, arrays string) (*Serializer, error) {
+	s, err := NewSerializer(timestampUnits, timestampFormat, transform)
+	if err != nil {
+		return nil, err
+	}
+
+	if separator == "" {
+		separator = "."
+	}
+	switch arrays {
+	case "":
+		arrays = ArraysIndex
+	case ArraysIndex, ArraysBrackets, ArraysKeep:
+	default:
+		return nil, fmt.Errorf("invalid json flatten arrays mode: %s", arrays)
+	}
+
+	s.Flatten = true
+	s.FlattenSeparator = separator
+	s.FlattenArrays = arrays
+	return s, nil
+}
+
 func (s *Serializer) Serialize(metric models.Metric) ([]byte, error) {
+	if s.Flatten {
+		return s.serializeFlat(metric)
+	}
+
 	var obj interface{}
 	obj = s.createObject(metric)
 
@@ -58,6 +104,90 @@ func (s *Serializer) Serialize(metric models.Metric) ([]byte, error) {
 	return serialized, nil
 }
 
+// serializeFlat writes one object per line for every series of the metric,
+// made of the series header, name, timestamp, tags and flattened fields.
+func (s *Serializer) serializeFlat(metric models.Metric) ([]byte, error) {
+	sm, ok := metric.(models.SeriesMetric)
+	if !ok {
+		return nil, fmt.Errorf("json flatten: unsupported metric type %T", metric)
+	}
+
+	var out []byte
+	for _, series := range sm.Series() {
+		var obj interface{}
+		obj = s.createFlatObject(series)
+
+		if s.transformation != nil {
+			var err error
+			if obj, err = s.transform(obj); err != nil {
+				return nil, err
+			}
+		}
+
+		serialized, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, serialized...)
+		out = append(out, '\n')
+	}
+
+	return out, nil
+}
+
+func (s *Serializer) createFlatObject(series models.Series) map[string]any {
+	m := make(map[string]any, len(series.Header)+len(series.Tags)+len(series.Fields)+2)
+	for k, v := range series.Header {
+		m[k] = v
+	}
+	m["name"] = series.Name
+	if s.TimestampFormat != "" {
+		m["timestamp"] = series.Time.Format(s.TimestampFormat)
+	} else {
+		m["timestamp"] = series.Time.UnixNano() / int64(s.TimestampUnits)
+	}
+	for k, v := range series.Tags {
+		m[k] = v
+	}
+
+	fields := make(map[string]any)
+	for k, v := range series.Fields {
+		s.flatten(fields, k, v)
+	}
+	for k, v := range fields {
+		// Keep fields colliding with the header or tags, such as a "name"
+		// leaf, under the "content" key.
+		if _, exists := m[k]; exists {
+			k = "content" + s.FlattenSeparator + k
+		}
+		m[k] = v
+	}
+	return m
+}
+
+func (s *Serializer) flatten(m map[string]any, key string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, item := range v {
+			s.flatten(m, key+s.FlattenSeparator+k, item)
+		}
+	case []any:
+		if s.FlattenArrays == ArraysKeep {
+			m[key] = v
+			return
+		}
+		for i, item := range v {
+			if s.FlattenArrays == ArraysBrackets {
+				s.flatten(m, key+"["+strconv.Itoa(i)+"]", item)
+			} else {
+				s.flatten(m, key+s.FlattenSeparator+strconv.Itoa(i), item)
+			}
+		}
+	default:
+		m[key] = v
+	}
+}
+
 func (s *Serializer) transform(obj interface{}) (interface{}, error) {
 	return s.transformation.Eval(obj)
 }
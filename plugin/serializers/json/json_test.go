@@ -0,0 +1,120 @@
+package json
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+)
+
+func newTestMetric() models.Metric {
+	return models.NewSeriesMetric(models.Series{
+		Name:   "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters",
+		Tags:   map[string]string{"source": "10.0.0.1", "interface-name": "Hu0/0/0/1"},
+		Header: map[string]any{"node_id": "r1"},
+		Fields: map[string]any{
+			"bytes-received": uint64(10),
+			"errors":         map[string]any{"crc": int64(1)},
+			"queues":         []any{map[string]any{"drops": int64(2)}, map[string]any{"drops": int64(3)}},
+			"name":           "uplink",
+		},
+		Time: time.Unix(1678183200, 5000000).UTC(),
+	})
+}
+
+func TestSerializeFlat(t *testing.T) {
+	name := "Cisco-IOS-XR-infra-statsd-oper:infra-statistics/interfaces/interface/latest/generic-counters"
+	tests := []struct {
+		name      string
+		units     time.Duration
+		format    string
+		separator string
+		arrays    string
+		expected  map[string]any
+	}{
+		{
+			name:   "index",
+			format: "2006-01-02 15:04:05.000",
+			expected: map[string]any{
+				"node_id":        "r1",
+				"name":           name,
+				"timestamp":      "2023-03-07 10:00:00.005",
+				"source":         "10.0.0.1",
+				"interface-name": "Hu0/0/0/1",
+				"bytes-received": float64(10),
+				"errors.crc":     float64(1),
+				"queues.0.drops": float64(2),
+				"queues.1.drops": float64(3),
+				"content.name":   "uplink",
+			},
+		},
+		{
+			name:      "brackets",
+			units:     time.Millisecond,
+			separator: "_",
+			arrays:    ArraysBrackets,
+			expected: map[string]any{
+				"node_id":         "r1",
+				"name":            name,
+				"timestamp":       float64(1678183200005),
+				"source":          "10.0.0.1",
+				"interface-name":  "Hu0/0/0/1",
+				"bytes-received":  float64(10),
+				"errors_crc":      float64(1),
+				"queues[0]_drops": float64(2),
+				"queues[1]_drops": float64(3),
+				"content_name":    "uplink",
+			},
+		},
+		{
+			name:   "keep",
+			units:  time.Second,
+			arrays: ArraysKeep,
+			expected: map[string]any{
+				"node_id":        "r1",
+				"name":           name,
+				"timestamp":      float64(1678183200),
+				"source":         "10.0.0.1",
+				"interface-name": "Hu0/0/0/1",
+				"bytes-received": float64(10),
+				"errors.crc":     float64(1),
+				"queues":         []any{map[string]any{"drops": float64(2)}, map[string]any{"drops": float64(3)}},
+				"content.name":   "uplink",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewFlattenSerializer(tt.units, tt.format, "", tt.separator, tt.arrays)
+			require.NoError(t, err)
+			out, err := s.Serialize(newTestMetric())
+			require.NoError(t, err)
+			require.True(t, strings.HasSuffix(string(out), "\n"))
+
+			var actual map[string]any
+			require.NoError(t, json.Unmarshal(out, &actual))
+			require.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestSerializeFlatLinePerSeries(t *testing.T) {
+	s, err := NewFlattenSerializer(time.Second, "", "", "", "")
+	require.NoError(t, err)
+	metric := models.NewSeriesMetric(
+		models.Series{Name: "a", Fields: map[string]any{"v": int64(1)}, Time: time.Unix(1, 0)},
+		models.Series{Name: "b", Fields: map[string]any{"v": int64(2)}, Time: time.Unix(2, 0)},
+	)
+	out, err := s.Serialize(metric)
+	require.NoError(t, err)
+	require.Equal(t, `{"name":"a","timestamp":1,"v":1}`+"\n"+`{"name":"b","timestamp":2,"v":2}`+"\n", string(out))
+}
+
+func TestInvalidFlattenArrays(t *testing.T) {
+	_, err := NewFlattenSerializer(time.Second, "", "", "", "flat")
+	require.Error(t, err)
+}
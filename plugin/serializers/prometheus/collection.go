@@ -0,0 +1,340 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+var (
+	invalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+// Collection holds the latest sample of every series grouped by metric
+// family, until it is expired.
+type Collection struct {
+	serializer *Serializer
+	families   map[string]*family
+}
+
+type family struct {
+	name    string
+	typ     string
+	help    string
+	samples map[string]sample
+}
+
+type sample struct {
+	group     string
+	labels    string
+	suffix    string
+	bound     float64
+	value     float64
+	timestamp int64
+	added     time.Time
+}
+
+// NewCollection returns an empty collection typing and writing samples as
+// configured on the serializer.
+func (s *Serializer) NewCollection() *Collection {
+	return &Collection{
+		serializer: s,
+		families:   make(map[string]*family),
+	}
+}
+
+// Add adds the fields of series to the collection, replacing the previous
+// samples of the same series.
+func (c *Collection) Add(series models.Series, added time.Time) {
+	fields := make(map[string]float64)
+	internal.Flatten("", series.Fields, "_", func(k string, v any) {
+		if f, ok := toFloat(v); ok {
+			fields[k] = f
+		}
+	})
+
+	timestamp := series.Time.UnixMilli()
+	baseName := SanitizeName(series.Name)
+	if typ, ok := aggregateType(series.Type, fields); ok {
+		fam := c.family(baseName, typ, fmt.Sprintf("Telemetry %s %s", typ, series.Name))
+		le := "quantile"
+		if typ == Histogram {
+			le = "le"
+		}
+		group := formatLabels(series.Tags, "", "")
+		for k, v := range fields {
+			switch k {
+			case "sum", "count":
+				fam.add(sample{group: group, labels: group, suffix: "_" + k, value: v, timestamp: timestamp, added: added})
+			default:
+				suffix := ""
+				if typ == Histogram {
+					suffix = "_bucket"
+				}
+				bound, _ := strconv.ParseFloat(k, 64)
+				fam.add(sample{
+					group:     group,
+					labels:    formatLabels(series.Tags, le, k),
+					suffix:    suffix,
+					bound:     bound,
+					value:     v,
+					timestamp: timestamp,
+					added:     added,
+				})
+			}
+		}
+		return
+	}
+
+	labelled, isLabelled := labelledFamilies[series.Name]
+	for k, v := range fields {
+		name := baseName
+		labels := formatLabels(series.Tags, "", "")
+		help := fmt.Sprintf("Telemetry field %s of %s", k, series.Name)
+		if isLabelled && strings.HasPrefix(k, labelled.prefix) {
+			name, help = labelled.name, labelled.help
+			labels = formatLabels(series.Tags, labelled.label, strings.TrimPrefix(k, labelled.prefix))
+		} else if k != "value" {
+			name = SanitizeName(series.Name + "_" + k)
+		}
+		typ := c.serializer.metricType(name, series)
+		if typ == Counter && !strings.HasSuffix(name, "_total") {
+			name += "_total"
+		}
+		fam := c.family(name, typ, help)
+		fam.add(sample{group: labels, labels: labels, value: v, timestamp: timestamp, added: added})
+	}
+}
+
+// Expire removes the samples added before the given time.
+func (c *Collection) Expire(before time.Time) {
+	for name, fam := range c.families {
+		for k, smp := range fam.samples {
+			if smp.added.Before(before) {
+				delete(fam.samples, k)
+			}
+		}
+		if len(fam.samples) == 0 {
+			delete(c.families, name)
+		}
+	}
+}
+
+// Write writes the collection in the Prometheus text format, or OpenMetrics
+// when openMetrics is set.
+func (c *Collection) Write(buf *bytes.Buffer, openMetrics bool) {
+	names := make([]string, 0, len(c.families))
+	for name := range c.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		c.writeFamily(buf, c.families[name], openMetrics)
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+	}
+}
+
+func (c *Collection) family(name, typ, help string) *family {
+	fam, ok := c.families[name]
+	if !ok {
+		fam = &family{
+			name:    name,
+			typ:     typ,
+			help:    help,
+			samples: make(map[string]sample),
+		}
+		c.families[name] = fam
+	}
+	return fam
+}
+
+func (c *Collection) writeFamily(buf *bytes.Buffer, fam *family, openMetrics bool) {
+	// OpenMetrics counter families are named without the "_total" suffix
+	// that every sample carries.
+	name, counterSuffix := fam.name, ""
+	if openMetrics && fam.typ == Counter {
+		name, counterSuffix = strings.TrimSuffix(fam.name, "_total"), "_total"
+	}
+
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, helpReplacer.Replace(fam.help))
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, fam.typ)
+
+	samples := make([]sample, 0, len(fam.samples))
+	for _, smp := range fam.samples {
+		samples = append(samples, smp)
+	}
+	// Order by series, then buckets or quantiles by bound followed by the
+	// sum and count.
+	sort.Slice(samples, func(i, j int) bool {
+		a, b := samples[i], samples[j]
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		if suffixRank(a.suffix) != suffixRank(b.suffix) {
+			return suffixRank(a.suffix) < suffixRank(b.suffix)
+		}
+		return a.bound < b.bound
+	})
+
+	for _, smp := range samples {
+		buf.WriteString(name)
+		buf.WriteString(smp.suffix)
+		buf.WriteString(counterSuffix)
+		buf.WriteString(smp.labels)
+		buf.WriteByte(' ')
+		buf.WriteString(formatFloat(smp.value))
+		if c.serializer.ExportTimestamp {
+			buf.WriteByte(' ')
+			if openMetrics {
+				// OpenMetrics timestamps are in seconds
+				buf.WriteString(strconv.FormatFloat(float64(smp.timestamp)/1e3, 'f', -1, 64))
+			} else {
+				buf.WriteString(strconv.FormatInt(smp.timestamp, 10))
+			}
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+func (f *family) add(smp sample) {
+	f.samples[smp.suffix+smp.labels] = smp
+}
+
+func suffixRank(suffix string) int {
+	switch suffix {
+	case "_sum":
+		return 1
+	case "_count":
+		return 2
+	}
+	return 0
+}
+
+// aggregateType detects aggregated series, they have "sum" and "count" fields
+// and all other fields are named after their bound. Histograms have a "+Inf"
+// bucket, summaries are made of quantiles.
+func aggregateType(typ models.ValueType, fields map[string]float64) (string, bool) {
+	_, hasSum := fields["sum"]
+	_, hasCount := fields["count"]
+	if !hasSum || !hasCount || len(fields) < 3 {
+		return "", false
+	}
+
+	for k := range fields {
+		if k == "sum" || k == "count" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(k, 64); err != nil {
+			return "", false
+		}
+	}
+
+	switch typ {
+	case models.Histogram:
+		return Histogram, true
+	case models.Summary:
+		return Summary, true
+	}
+	if _, ok := fields["+Inf"]; ok {
+		return Histogram, true
+	}
+	return Summary, true
+}
+
+// SanitizeName returns name as a valid Prometheus metric name.
+func SanitizeName(name string) string {
+	name = strings.Trim(invalidChars.ReplaceAllString(name, "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+func sanitizeLabelName(name string) string {
+	name = invalidChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// formatLabels returns the sorted label set of tags, extra is added when set.
+func formatLabels(tags map[string]string, extraName, extraValue string) string {
+	labels := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		if v == "" {
+			continue
+		}
+		labels[sanitizeLabelName(k)] = v
+	}
+	if extraName != "" {
+		labels[extraName] = extraValue
+	}
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", k, labelValueReplacer.Replace(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func toFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,144 @@
+package prometheus
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"telemetry/internal"
+	"telemetry/models"
+)
+
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
+	Summary   = "summary"
+)
+
+// defaultCounters are globs of the cumulative leaves of the Cisco MDT
+// interface counters, typed as counters unless configured otherwise.
+var defaultCounters = compileGlobs(
+	"*_bytes_received", "*_bytes_sent", "*_packets_received", "*_packets_sent",
+	"*_packets", "*_drops", "*_errors", "*_errors_received", "*_overruns",
+	"*_underruns", "*_aborts", "*_failures", "*_swapped_out", "*_resets",
+	"*_transitions",
+)
+
+// labelledFamilies fold the fields of a series with a common prefix into a
+// single family labelled with the rest of the field name, e.g. the cpu times
+// become cpu_seconds_total{mode="user"}.
+var labelledFamilies = map[string]labelledFamily{
+	"cpu": {prefix: "time_", name: "cpu_seconds", label: "mode", help: "Seconds the cpus spent in each mode"},
+}
+
+type labelledFamily struct {
+	prefix string
+	name   string
+	label  string
+	help   string
+}
+
+type Serializer struct {
+	ExportTimestamp bool
+	OpenMetrics     bool
+
+	counters []*regexp.Regexp
+	gauges   []*regexp.Regexp
+}
+
+// NewSerializer returns a Prometheus exposition format serializer, or an
+// OpenMetrics one when openMetrics is set. Counters and gauges are globs
+// matched against the metric names to force their type, otherwise the series
+// type is used and names ending with "_total" are counters and all others
+// gauges, apart from the well-known counters such as the Cisco MDT interface
+// counters.
+func NewSerializer(exportTimestamp, openMetrics bool, counters, gauges []string) (*Serializer, error) {
+	s := &Serializer{
+		ExportTimestamp: exportTimestamp,
+		OpenMetrics:     openMetrics,
+	}
+
+	for _, c := range counters {
+		re, err := internal.CompileGlob(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prometheus counter filter %q: %v", c, err)
+		}
+		s.counters = append(s.counters, re)
+	}
+	for _, g := range gauges {
+		re, err := internal.CompileGlob(g)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prometheus gauge filter %q: %v", g, err)
+		}
+		s.gauges = append(s.gauges, re)
+	}
+
+	return s, nil
+}
+
+func (s *Serializer) Serialize(metric models.Metric) ([]byte, error) {
+	return s.SerializeBatch([]models.Metric{metric})
+}
+
+// SerializeBatch writes all metrics as a single exposition, each metric family
+// is written once and the latest sample of a series wins.
+func (s *Serializer) SerializeBatch(metrics []models.Metric) ([]byte, error) {
+	c := s.NewCollection()
+	now := time.Now()
+	for _, metric := range metrics {
+		sm, ok := metric.(models.SeriesMetric)
+		if !ok {
+			return nil, fmt.Errorf("prometheus: unsupported metric type %T", metric)
+		}
+		for _, series := range sm.Series() {
+			c.Add(series, now)
+		}
+	}
+
+	var buf bytes.Buffer
+	c.Write(&buf, s.OpenMetrics)
+	return buf.Bytes(), nil
+}
+
+func (s *Serializer) metricType(name string, series models.Series) string {
+	for _, re := range s.counters {
+		if re.MatchString(name) {
+			return Counter
+		}
+	}
+	for _, re := range s.gauges {
+		if re.MatchString(name) {
+			return Gauge
+		}
+	}
+	switch series.Type {
+	case models.Counter:
+		return Counter
+	case models.Gauge:
+		return Gauge
+	}
+	for _, re := range defaultCounters {
+		if re.MatchString(name) {
+			return Counter
+		}
+	}
+	if strings.HasSuffix(name, "_total") {
+		return Counter
+	}
+	return Gauge
+}
+
+func compileGlobs(globs ...string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(globs))
+	for _, g := range globs {
+		re, err := internal.CompileGlob(g)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, re)
+	}
+	return res
+}
@@ -0,0 +1,192 @@
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"telemetry/models"
+)
+
+func newTestMetric(source string, received uint64) models.Metric {
+	return models.NewSeriesMetric(models.Series{
+		Name:   "interface",
+		Tags:   map[string]string{"source": source},
+		Fields: map[string]any{"bytes_received": received, "up": true, "name": "Hu0/0/0/1"},
+		Time:   time.UnixMilli(1678183200005),
+	})
+}
+
+func TestSerializeBatch(t *testing.T) {
+	metrics := []models.Metric{newTestMetric("r1", 10), newTestMetric("r2", 20), newTestMetric("r1", 30)}
+	tests := []struct {
+		name            string
+		exportTimestamp bool
+		openMetrics     bool
+		expected        string
+	}{
+		{
+			name: "prometheus",
+			expected: `# HELP interface_bytes_received_total Telemetry field bytes_received of interface
+# TYPE interface_bytes_received_total counter
+interface_bytes_received_total{source="r1"} 30
+interface_bytes_received_total{source="r2"} 20
+# HELP interface_up Telemetry field up of interface
+# TYPE interface_up gauge
+interface_up{source="r1"} 1
+interface_up{source="r2"} 1
+`,
+		},
+		{
+			name:            "openmetrics with timestamps",
+			exportTimestamp: true,
+			openMetrics:     true,
+			expected: `# HELP interface_bytes_received Telemetry field bytes_received of interface
+# TYPE interface_bytes_received counter
+interface_bytes_received_total{source="r1"} 30 1678183200.005
+interface_bytes_received_total{source="r2"} 20 1678183200.005
+# HELP interface_up Telemetry field up of interface
+# TYPE interface_up gauge
+interface_up{source="r1"} 1 1678183200.005
+interface_up{source="r2"} 1 1678183200.005
+# EOF
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSerializer(tt.exportTimestamp, tt.openMetrics, []string{"*_bytes_received"}, nil)
+			require.NoError(t, err)
+			out, err := s.SerializeBatch(metrics)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(out))
+		})
+	}
+}
+
+func TestSerializeSummary(t *testing.T) {
+	s, err := NewSerializer(false, false, nil, nil)
+	require.NoError(t, err)
+	out, err := s.Serialize(models.NewSeriesMetric(models.Series{
+		Name:   "rtt",
+		Type:   models.Summary,
+		Fields: map[string]any{"0.5": 1.5, "0.9": 4.0, "sum": 30.0, "count": uint64(10)},
+		Time:   time.UnixMilli(1678183200005),
+	}))
+	require.NoError(t, err)
+	require.Equal(t, `# HELP rtt Telemetry summary rtt
+# TYPE rtt summary
+rtt{quantile="0.5"} 1.5
+rtt{quantile="0.9"} 4
+rtt_sum 30
+rtt_count 10
+`, string(out))
+}
+
+func TestCollectionExpire(t *testing.T) {
+	s, err := NewSerializer(false, false, nil, nil)
+	require.NoError(t, err)
+	c := s.NewCollection()
+	now := time.Now()
+	c.Add(models.Series{Name: "cpu", Tags: map[string]string{"source": "r1"}, Fields: map[string]any{"value": 1.0}}, now.Add(-time.Minute))
+	c.Add(models.Series{Name: "cpu", Tags: map[string]string{"source": "r2"}, Fields: map[string]any{"value": 2.0}}, now)
+	c.Add(models.Series{Name: "mem", Fields: map[string]any{"value": 3.0}}, now.Add(-time.Minute))
+
+	c.Expire(now.Add(-time.Second))
+	var buf bytes.Buffer
+	c.Write(&buf, false)
+	require.Equal(t, `# HELP cpu Telemetry field value of cpu
+# TYPE cpu gauge
+cpu{source="r2"} 2
+`, buf.String())
+}
+
+func TestSerializeCPUTimes(t *testing.T) {
+	s, err := NewSerializer(false, false, nil, nil)
+	require.NoError(t, err)
+	out, err := s.Serialize(models.NewSeriesMetric(
+		models.Series{
+			Name:   "cpu",
+			Tags:   map[string]string{"cpu": "cpu0"},
+			Fields: map[string]any{"time_user": 10.5, "time_idle": 100.0},
+			Type:   models.Counter,
+		},
+		models.Series{
+			Name:   "cpu",
+			Tags:   map[string]string{"cpu": "cpu1"},
+			Fields: map[string]any{"time_user": 20.0, "time_idle": 90.0},
+			Type:   models.Counter,
+		},
+	))
+	require.NoError(t, err)
+	require.Equal(t, `# HELP cpu_seconds_total Seconds the cpus spent in each mode
+# TYPE cpu_seconds_total counter
+cpu_seconds_total{cpu="cpu0",mode="idle"} 100
+cpu_seconds_total{cpu="cpu0",mode="user"} 10.5
+cpu_seconds_total{cpu="cpu1",mode="idle"} 90
+cpu_seconds_total{cpu="cpu1",mode="user"} 20
+`, string(out))
+}
+
+func TestSerializeMDTCounters(t *testing.T) {
+	metric := models.NewSeriesMetric(models.Series{
+		Name: "generic-counters",
+		Tags: map[string]string{"interface-name": "Hu0/0/0/1"},
+		Fields: map[string]any{
+			"bytes-received":    uint64(1000),
+			"input-queue-drops": uint64(2),
+			"crc-errors":        uint64(1),
+			"input-data-rate":   uint64(80),
+		},
+	})
+	tests := []struct {
+		name     string
+		gauges   []string
+		expected string
+	}{
+		{
+			name: "defaults",
+			expected: `# HELP generic_counters_bytes_received_total Telemetry field bytes-received of generic-counters
+# TYPE generic_counters_bytes_received_total counter
+generic_counters_bytes_received_total{interface_name="Hu0/0/0/1"} 1000
+# HELP generic_counters_crc_errors_total Telemetry field crc-errors of generic-counters
+# TYPE generic_counters_crc_errors_total counter
+generic_counters_crc_errors_total{interface_name="Hu0/0/0/1"} 1
+# HELP generic_counters_input_data_rate Telemetry field input-data-rate of generic-counters
+# TYPE generic_counters_input_data_rate gauge
+generic_counters_input_data_rate{interface_name="Hu0/0/0/1"} 80
+# HELP generic_counters_input_queue_drops_total Telemetry field input-queue-drops of generic-counters
+# TYPE generic_counters_input_queue_drops_total counter
+generic_counters_input_queue_drops_total{interface_name="Hu0/0/0/1"} 2
+`,
+		},
+		{
+			name:   "configured gauge",
+			gauges: []string{"*_crc_errors"},
+			expected: `# HELP generic_counters_bytes_received_total Telemetry field bytes-received of generic-counters
+# TYPE generic_counters_bytes_received_total counter
+generic_counters_bytes_received_total{interface_name="Hu0/0/0/1"} 1000
+# HELP generic_counters_crc_errors Telemetry field crc-errors of generic-counters
+# TYPE generic_counters_crc_errors gauge
+generic_counters_crc_errors{interface_name="Hu0/0/0/1"} 1
+# HELP generic_counters_input_data_rate Telemetry field input-data-rate of generic-counters
+# TYPE generic_counters_input_data_rate gauge
+generic_counters_input_data_rate{interface_name="Hu0/0/0/1"} 80
+# HELP generic_counters_input_queue_drops_total Telemetry field input-queue-drops of generic-counters
+# TYPE generic_counters_input_queue_drops_total counter
+generic_counters_input_queue_drops_total{interface_name="Hu0/0/0/1"} 2
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSerializer(false, false, nil, tt.gauges)
+			require.NoError(t, err)
+			out, err := s.Serialize(metric)
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, string(out))
+		})
+	}
+}
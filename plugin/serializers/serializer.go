@@ -1,6 +1,16 @@
 package serializers
 
-import "telemetry/models"
+import (
+	"fmt"
+	"time"
+
+	"telemetry/internal"
+	"telemetry/models"
+	"telemetry/plugin/serializers/graphite"
+	"telemetry/plugin/serializers/influx"
+	"telemetry/plugin/serializers/json"
+	"telemetry/plugin/serializers/prometheus"
+)
 
 type SerializerOutput interface {
 	// SetSerializer sets the serializer function for the interface.
@@ -16,3 +26,100 @@ type Serializer interface {
 	// delimited metrics.
 	Serialize(metric models.Metric) ([]byte, error)
 }
+
+// BatchSerializer is implemented by serializers whose format needs to see
+// all metrics at once, such as formats that group samples by family.
+type BatchSerializer interface {
+	Serializer
+
+	// SerializeBatch takes an array of telegraf metric and serializes it into
+	// a byte buffer.
+	SerializeBatch(metrics []models.Metric) ([]byte, error)
+}
+
+// Config is the serializer part of an output configuration, it selects the
+// serializer with DataFormat and holds the options of every format.
+type Config struct {
+	// DataFormat can be one of the serializer types listed in NewSerializer.
+	DataFormat string `json:"data_format"`
+
+	// Prefix to add to all measurements, only supports Graphite
+	Prefix string `json:"prefix"`
+
+	// Template for converting telemetry series into Graphite paths, only
+	// supports Graphite
+	Template string `json:"template"`
+
+	// Templates same Template, but multiple template with filters
+	Templates []string `json:"templates"`
+
+	// Support tags in graphite protocol
+	GraphiteTagSupport bool `json:"graphite_tag_support"`
+
+	// Support unsigned integer output; influx format only
+	InfluxUintSupport bool `json:"influx_uint_support"`
+
+	// Timestamp units to use for JSON formatted output
+	JSONTimestampUnits internal.Duration `json:"json_timestamp_units"`
+
+	// Timestamp format to use for JSON formatted output
+	JSONTimestampFormat string `json:"json_timestamp_format"`
+
+	// Transformation as JSONata expression to use for JSON formatted output
+	JSONTransformation string `json:"json_transformation"`
+
+	// Write one flat JSON object per series, such as Cisco MDT rows
+	JSONFlatten bool `json:"json_flatten"`
+
+	// Separator joining nested keys in flatten mode
+	JSONFlattenSeparator string `json:"json_flatten_separator"`
+
+	// Array handling in flatten mode, one of "index", "brackets" or "keep"
+	JSONFlattenArrays string `json:"json_flatten_arrays"`
+
+	// Include the metric timestamp on each sample.
+	PrometheusExportTimestamp bool `json:"prometheus_export_timestamp"`
+
+	// Write OpenMetrics instead of the Prometheus text format.
+	PrometheusOpenMetrics bool `json:"prometheus_openmetrics"`
+
+	// Globs of metric names always typed as counter or gauge.
+	PrometheusCounters []string `json:"prometheus_counters"`
+	PrometheusGauges   []string `json:"prometheus_gauges"`
+}
+
+// NewSerializer returns the serializer selected by the DataFormat of config,
+// json is used when no data format is set.
+func NewSerializer(config *Config) (Serializer, error) {
+	switch config.DataFormat {
+	case "json", "":
+		return newJSONSerializer(config)
+	case "graphite":
+		return graphite.NewSerializer(config.Prefix, config.Template, config.Templates, config.GraphiteTagSupport)
+	case "influx":
+		return influx.NewSerializer(config.InfluxUintSupport), nil
+	case "prometheus":
+		return prometheus.NewSerializer(config.PrometheusExportTimestamp, config.PrometheusOpenMetrics,
+			config.PrometheusCounters, config.PrometheusGauges)
+	default:
+		return nil, fmt.Errorf("invalid data format: %s", config.DataFormat)
+	}
+}
+
+func newJSONSerializer(config *Config) (Serializer, error) {
+	// Timestamps are numbers in the configured units unless a format is
+	// set, formatted by default.
+	format := config.JSONTimestampFormat
+	if format == "" && config.JSONTimestampUnits == 0 {
+		format = "2006-01-02 15:04:05.000"
+	}
+	units := time.Duration(config.JSONTimestampUnits)
+	if units == 0 {
+		units = time.Millisecond
+	}
+	if config.JSONFlatten {
+		return json.NewFlattenSerializer(units, format, config.JSONTransformation,
+			config.JSONFlattenSeparator, config.JSONFlattenArrays)
+	}
+	return json.NewSerializer(units, format, config.JSONTransformation)
+}